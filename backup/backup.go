@@ -29,19 +29,33 @@ const (
 )
 
 func marshalTagVersion() []byte {
+	return marshalTag(version)
+}
+
+func checkMarshalledTagVersion(b []byte) error {
+	return checkMarshalledTag(b, version)
+}
+
+// marshalTag returns the tag followed by the given version.
+func marshalTag(v int) []byte {
 	out := make([]byte, tagSize+versionSize)
 	copy(out[:tagSize], tag)
-	out[tagSize] = byte(version)
+	out[tagSize] = byte(v)
 	return out
 }
 
-func checkMarshalledTagVersion(b []byte) error {
+// checkMarshalledTag returns an error if the data does not start with the tag
+// followed by the given version.
+func checkMarshalledTag(b []byte, v int) error {
+	if len(b) < tagSize+versionSize {
+		return errors.New("tag and version missing")
+	}
 	acquiredTag := b[:tagSize]
 	if !hmac.Equal(acquiredTag, []byte(tag)) {
 		return errors.New("tag mismatch")
 	}
 	acquiredVersion := int(b[tagSize])
-	if acquiredVersion != version {
+	if acquiredVersion != v {
 		return errors.New("version mismatch")
 	}
 	return nil
@@ -119,15 +133,25 @@ type Backup struct {
 // Decrypt decrypts the encrypted serialized backup. Returns an error for
 // invalid version or invalid tag.
 func (b *Backup) Decrypt(password string, blob []byte) error {
+	_, err := b.decrypt(password, blob)
+	return err
+}
+
+// decrypt decrypts the encrypted serialized version 0 backup and returns the
+// key derived from the password.
+func (b *Backup) decrypt(password string, blob []byte) ([]byte, error) {
 
 	if err := checkMarshalledTagVersion(blob); err != nil {
-		return err
+		return nil, err
+	}
+	if len(blob) < tagSize+versionSize+SaltLen+ParamsLen {
+		return nil, errors.New("salt and params missing")
 	}
 
 	saltParams := blob[tagSize+versionSize : tagSize+versionSize+SaltLen+ParamsLen]
 	salt, params, err := unmarshalSaltParams(saltParams)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	key := DeriveKey(password, salt, params)
@@ -136,10 +160,10 @@ func (b *Backup) Decrypt(password string, blob []byte) error {
 
 	plaintext, err := Decrypt(blob, key)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return json.Unmarshal(plaintext, b)
+	return key, json.Unmarshal(plaintext, b)
 }
 
 // Encrypt returns the encrypted serialized backup with the format for account
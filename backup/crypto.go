@@ -16,6 +16,13 @@ import (
 )
 
 func Encrypt(rand csprng.Source, plaintext, key []byte) ([]byte, error) {
+	return encrypt(rand, plaintext, key, nil)
+}
+
+// encrypt encrypts the plaintext and authenticates it with the additional
+// data. The additional data is not included in the returned ciphertext.
+func encrypt(rand csprng.Source, plaintext, key, additionalData []byte) (
+	[]byte, error) {
 	if len(key) != chacha20poly1305.KeySize {
 		return nil, errors.New("Backup.Store: incorrect key size")
 	}
@@ -34,12 +41,18 @@ func Encrypt(rand csprng.Source, plaintext, key []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	ciphertext := cipher.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := cipher.Seal(nonce, nonce, plaintext, additionalData)
 
 	return ciphertext, nil
 }
 
 func Decrypt(blob, key []byte) ([]byte, error) {
+	return decrypt(blob, key, nil)
+}
+
+// decrypt decrypts the ciphertext returned by encrypt. The additional data
+// must match the data passed to encrypt.
+func decrypt(blob, key, additionalData []byte) ([]byte, error) {
 
 	if len(key) != chacha20poly1305.KeySize {
 		return nil, errors.New("Backup.Store: incorrect key size")
@@ -57,7 +70,7 @@ func Decrypt(blob, key []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	plaintext, err := cipher.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := cipher.Open(nil, nonce, ciphertext, additionalData)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,440 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package backup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/primitives/fact"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// version1 is the version of incremental backups, which are made of a base
+	// snapshot followed by a chain of deltas.
+	version1 = 1
+
+	// The kind of a version 1 blob follows the version.
+	kindSize     = 1
+	snapshotKind = 0
+	deltaKind    = 1
+
+	// blobIDLen is the length of the ID of a snapshot or delta, which is the
+	// hash of the entire blob.
+	blobIDLen    = blake2b.Size256
+	sequenceSize = 8
+
+	// signatureLenSize is the size of the length of the signature at the start
+	// of the plaintext of a delta.
+	signatureLenSize = 2
+
+	snapshotHeaderSize = tagSize + versionSize + kindSize + SaltLen + ParamsLen
+	deltaHeaderSize    = tagSize + versionSize + kindSize + blobIDLen +
+		sequenceSize + blobIDLen
+)
+
+// Error messages.
+const (
+	errBlobKind          = "blob is not a %s"
+	errBlobLen           = "%s of %d bytes is shorter than its %d byte header"
+	errNoSigningKey      = "backup has no transmission identity key to verify deltas"
+	errDeltaSnapshot     = "delta %d does not belong to the snapshot"
+	errForkedChain       = "found more than one delta with sequence %d"
+	errMissingDelta      = "delta %d is missing from the chain"
+	errDeltaPrevious     = "delta %d does not follow the previous blob in the chain"
+	errDeltaSignatureLen = "delta %d has an invalid signature length"
+	errDeltaSignature    = "failed to verify signature of delta %d: %+v"
+)
+
+// Delta is a change made to a Backup after its base snapshot. Deltas only hold
+// changes to the contacts and to the facts registered with user discovery; any
+// other change requires a new snapshot.
+type Delta struct {
+	ContactsAdded   []*id.ID      `json:"contactsAdded,omitempty"`
+	ContactsRemoved []*id.ID      `json:"contactsRemoved,omitempty"`
+	FactsAdded      fact.FactList `json:"factsAdded,omitempty"`
+	FactsRemoved    fact.FactList `json:"factsRemoved,omitempty"`
+}
+
+// MakeDelta returns the Delta that changes the contacts and user discovery
+// facts of the previous backup into those of the next backup.
+func MakeDelta(prev, next *Backup) Delta {
+	var d Delta
+	prevContacts := prev.Contacts.Identities
+	nextContacts := next.Contacts.Identities
+	for _, c := range nextContacts {
+		if !containsID(prevContacts, c) {
+			d.ContactsAdded = append(d.ContactsAdded, c)
+		}
+	}
+	for _, c := range prevContacts {
+		if !containsID(nextContacts, c) {
+			d.ContactsRemoved = append(d.ContactsRemoved, c)
+		}
+	}
+
+	prevFacts := prev.UserDiscoveryRegistration.FactList
+	nextFacts := next.UserDiscoveryRegistration.FactList
+	for _, f := range nextFacts {
+		if !containsFact(prevFacts, f) {
+			d.FactsAdded = append(d.FactsAdded, f)
+		}
+	}
+	for _, f := range prevFacts {
+		if !containsFact(nextFacts, f) {
+			d.FactsRemoved = append(d.FactsRemoved, f)
+		}
+	}
+
+	return d
+}
+
+// Apply applies the Delta to the backup. Contacts and facts that were already
+// added or removed are skipped.
+func (b *Backup) Apply(d Delta) {
+	var contacts []*id.ID
+	for _, c := range b.Contacts.Identities {
+		if !containsID(d.ContactsRemoved, c) {
+			contacts = append(contacts, c)
+		}
+	}
+	for _, c := range d.ContactsAdded {
+		if !containsID(contacts, c) {
+			contacts = append(contacts, c)
+		}
+	}
+	b.Contacts.Identities = contacts
+
+	var facts fact.FactList
+	for _, f := range b.UserDiscoveryRegistration.FactList {
+		if !containsFact(d.FactsRemoved, f) {
+			facts = append(facts, f)
+		}
+	}
+	for _, f := range d.FactsAdded {
+		if !containsFact(facts, f) {
+			facts = append(facts, f)
+		}
+	}
+	b.UserDiscoveryRegistration.FactList = facts
+}
+
+// EncryptSnapshot returns the encrypted serialized backup as the base snapshot
+// of an incremental backup with the format:
+//
+//	"XXACCTBK" | [1] | [0] | [salt and params] | [DATA]
+//
+// The header before the data is authenticated with the data. Deltas can then
+// be added to the backup with Delta.Encrypt instead of encrypting the entire
+// backup again.
+//
+// The key passed in must be derived via DeriveKey and the salt must be the same
+// used to derive the key.
+func (b *Backup) EncryptSnapshot(rand csprng.Source, key, salt []byte,
+	params Params) ([]byte, error) {
+
+	blob, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(marshalTag(version1), snapshotKind)
+	header = append(header, marshalSaltParams(salt, params)...)
+
+	ciphertext, err := encrypt(rand, blob, key, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, ciphertext...), nil
+}
+
+// Encrypt returns the encrypted and signed serialized Delta that follows the
+// previous blob in the chain, which is either the base snapshot or the last
+// delta. The base snapshot may be an encrypted backup of version 0. The format
+// is:
+//
+//	"XXACCTBK" | [1] | [1] | [snapshot ID] | [sequence] | [previous ID] | [DATA]
+//
+// The data is the signature followed by the serialized delta. The header is
+// signed with the delta and authenticated with the data, and the signature is
+// encrypted, so that it does not reveal the identity that signed it.
+//
+// The key must be the key of the base snapshot and the signing key must be the
+// RSA signing key of its transmission identity.
+func (d *Delta) Encrypt(rand csprng.Source, key []byte,
+	signingKey *rsa.PrivateKey, previous []byte) ([]byte, error) {
+
+	snapshotID, sequence, err := nextInChain(previous)
+	if err != nil {
+		return nil, err
+	}
+	prevID := blobID(previous)
+	header := marshalDeltaHeader(snapshotID, sequence, prevID[:])
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, hashed := deltaSignatureHash(header, data)
+	signature, err := rsa.Sign(rand, signingKey, opts.Hash, hashed, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, signatureLenSize, signatureLenSize+
+		len(signature)+len(data))
+	binary.BigEndian.PutUint16(plaintext, uint16(len(signature)))
+	plaintext = append(append(plaintext, signature...), data...)
+
+	ciphertext, err := encrypt(rand, plaintext, key, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, ciphertext...), nil
+}
+
+// DecryptIncremental decrypts the base snapshot and applies the deltas to it.
+// The snapshot may be an encrypted backup of version 0. The deltas may be in
+// any order.
+//
+// Returns an error if the deltas do not form a single unbroken chain from the
+// snapshot, such as when a delta is missing or when two devices each added a
+// delta after the same blob, or if any delta is not signed by the transmission
+// identity of the snapshot. No delta is applied if any delta is invalid.
+func (b *Backup) DecryptIncremental(
+	password string, snapshot []byte, deltas [][]byte) error {
+
+	var key []byte
+	var err error
+	if len(snapshot) > tagSize && snapshot[tagSize] == version1 {
+		key, err = b.decryptSnapshot(password, snapshot)
+	} else {
+		key, err = b.decrypt(password, snapshot)
+	}
+	if err != nil {
+		return err
+	}
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	type chainDelta struct {
+		header, ciphertext []byte
+		snapshotID, prevID []byte
+		sequence           uint64
+		id                 [blobIDLen]byte
+	}
+
+	// Order the deltas by sequence
+	chain := make([]chainDelta, len(deltas))
+	for i, delta := range deltas {
+		if err = checkBlobKind(delta, deltaKind, deltaHeaderSize); err != nil {
+			return err
+		}
+		cd := chainDelta{
+			header:     delta[:deltaHeaderSize],
+			ciphertext: delta[deltaHeaderSize:],
+			id:         blobID(delta),
+		}
+		cd.snapshotID, cd.sequence, cd.prevID = unmarshalDeltaHeader(cd.header)
+		chain[i] = cd
+	}
+	sort.Slice(chain, func(i, j int) bool {
+		return chain[i].sequence < chain[j].sequence
+	})
+
+	// Check that the deltas form a chain from the snapshot
+	snapshotID := blobID(snapshot)
+	prevID := snapshotID
+	for i, cd := range chain {
+		sequence := uint64(i + 1)
+		if cd.sequence < sequence {
+			return errors.Errorf(errForkedChain, cd.sequence)
+		} else if cd.sequence > sequence {
+			return errors.Errorf(errMissingDelta, sequence)
+		} else if !bytes.Equal(cd.snapshotID, snapshotID[:]) {
+			return errors.Errorf(errDeltaSnapshot, cd.sequence)
+		} else if !bytes.Equal(cd.prevID, prevID[:]) {
+			return errors.Errorf(errDeltaPrevious, cd.sequence)
+		}
+		prevID = cd.id
+	}
+
+	if b.TransmissionIdentity.RSASigningPrivateKey == nil {
+		return errors.New(errNoSigningKey)
+	}
+	publicKey := b.TransmissionIdentity.RSASigningPrivateKey.GetPublic()
+
+	// Decrypt and verify every delta before applying any
+	decrypted := make([]Delta, len(chain))
+	for i, cd := range chain {
+		plaintext, err := decrypt(cd.ciphertext, key, cd.header)
+		if err != nil {
+			return err
+		}
+
+		if len(plaintext) < signatureLenSize {
+			return errors.Errorf(errDeltaSignatureLen, cd.sequence)
+		}
+		signatureLen := int(binary.BigEndian.Uint16(plaintext))
+		plaintext = plaintext[signatureLenSize:]
+		if len(plaintext) < signatureLen {
+			return errors.Errorf(errDeltaSignatureLen, cd.sequence)
+		}
+		signature, data := plaintext[:signatureLen], plaintext[signatureLen:]
+
+		opts, hashed := deltaSignatureHash(cd.header, data)
+		err = rsa.Verify(publicKey, opts.Hash, hashed, signature, opts)
+		if err != nil {
+			return errors.Errorf(errDeltaSignature, cd.sequence, err)
+		}
+
+		if err = json.Unmarshal(data, &decrypted[i]); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range decrypted {
+		b.Apply(d)
+	}
+
+	return nil
+}
+
+// decryptSnapshot decrypts the encrypted serialized base snapshot returned by
+// Backup.EncryptSnapshot and returns the key derived from the password.
+func (b *Backup) decryptSnapshot(password string, blob []byte) ([]byte, error) {
+	if err := checkBlobKind(blob, snapshotKind, snapshotHeaderSize); err != nil {
+		return nil, err
+	}
+
+	header := blob[:snapshotHeaderSize]
+	salt, params, err := unmarshalSaltParams(
+		header[tagSize+versionSize+kindSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	key := DeriveKey(password, salt, params)
+
+	plaintext, err := decrypt(blob[snapshotHeaderSize:], key, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, json.Unmarshal(plaintext, b)
+}
+
+// nextInChain returns the snapshot ID and sequence of the delta that follows
+// the previous blob.
+func nextInChain(previous []byte) ([]byte, uint64, error) {
+	if checkMarshalledTagVersion(previous) == nil {
+		id := blobID(previous)
+		return id[:], 1, nil
+	}
+
+	if len(previous) > tagSize+versionSize &&
+		previous[tagSize+versionSize] == snapshotKind {
+		err := checkBlobKind(previous, snapshotKind, snapshotHeaderSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		id := blobID(previous)
+		return id[:], 1, nil
+	}
+
+	err := checkBlobKind(previous, deltaKind, deltaHeaderSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	snapshotID, sequence, _ := unmarshalDeltaHeader(previous)
+	return snapshotID, sequence + 1, nil
+}
+
+// checkBlobKind returns an error if the blob is not a version 1 blob of the
+// given kind with a full header.
+func checkBlobKind(blob []byte, kind byte, headerSize int) error {
+	name := "snapshot"
+	if kind == deltaKind {
+		name = "delta"
+	}
+
+	if err := checkMarshalledTag(blob, version1); err != nil {
+		return err
+	} else if len(blob) < tagSize+versionSize+kindSize ||
+		blob[tagSize+versionSize] != kind {
+		return errors.Errorf(errBlobKind, name)
+	} else if len(blob) < headerSize {
+		return errors.Errorf(errBlobLen, name, len(blob), headerSize)
+	}
+	return nil
+}
+
+// marshalDeltaHeader returns the header of a delta.
+func marshalDeltaHeader(
+	snapshotID []byte, sequence uint64, prevID []byte) []byte {
+	header := make([]byte, 0, deltaHeaderSize)
+	header = append(append(header, marshalTag(version1)...), deltaKind)
+	header = append(header, snapshotID...)
+	header = binary.BigEndian.AppendUint64(header, sequence)
+	return append(header, prevID...)
+}
+
+// unmarshalDeltaHeader returns the snapshot ID, sequence, and previous ID from
+// the header of a delta.
+func unmarshalDeltaHeader(header []byte) ([]byte, uint64, []byte) {
+	header = header[tagSize+versionSize+kindSize:]
+	snapshotID, header := header[:blobIDLen], header[blobIDLen:]
+	sequence := binary.BigEndian.Uint64(header[:sequenceSize])
+	return snapshotID, sequence, header[sequenceSize : sequenceSize+blobIDLen]
+}
+
+// deltaSignatureHash returns the signing options and the hash signed by the
+// transmission identity of a delta.
+func deltaSignatureHash(header, data []byte) (*rsa.Options, []byte) {
+	opts := rsa.NewDefaultOptions()
+	h := opts.Hash.New()
+	h.Write(header)
+	h.Write(data)
+	return opts, h.Sum(nil)
+}
+
+// blobID returns the ID of a snapshot or delta.
+func blobID(blob []byte) [blobIDLen]byte {
+	return blake2b.Sum256(blob)
+}
+
+// containsID returns true if the list contains the ID.
+func containsID(list []*id.ID, target *id.ID) bool {
+	for _, c := range list {
+		if c.Cmp(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFact returns true if the list contains the fact.
+func containsFact(list fact.FactList, target fact.Fact) bool {
+	for _, f := range list {
+		if f == target {
+			return true
+		}
+	}
+	return false
+}
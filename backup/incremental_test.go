@@ -0,0 +1,211 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/elixxir/primitives/fact"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// newIncrementalTestBackup returns a backup with a transmission identity, two
+// contacts, and a fact, and the key derived from the password.
+func newIncrementalTestBackup(t *testing.T, password string) (
+	*Backup, []byte, []byte) {
+	rsaPrivKey, err := rsa.GenerateKey(csprng.NewSystemRNG(), 2048)
+	require.NoError(t, err)
+
+	b := &Backup{
+		RegistrationCode: "code",
+		TransmissionIdentity: TransmissionIdentity{
+			RSASigningPrivateKey: rsaPrivKey,
+		},
+		Contacts: Contacts{Identities: []*id.ID{
+			id.NewIdFromString("contact1", id.User, t),
+			id.NewIdFromString("contact2", id.User, t),
+		}},
+	}
+	b.UserDiscoveryRegistration.FactList = fact.FactList{
+		{Fact: "alice", T: fact.Username},
+	}
+
+	salt, err := MakeSalt(csprng.NewSystemRNG())
+	require.NoError(t, err)
+	return b, salt, DeriveKey(password, salt, testParams())
+}
+
+// copyBackup returns a copy of the backup with its own contacts and facts.
+func copyBackup(b *Backup) *Backup {
+	c := *b
+	c.Contacts.Identities = append([]*id.ID{}, b.Contacts.Identities...)
+	c.UserDiscoveryRegistration.FactList =
+		append(fact.FactList{}, b.UserDiscoveryRegistration.FactList...)
+	return &c
+}
+
+// Tests that a backup decrypted from its snapshot and deltas, given in any
+// order, has the contacts and facts of the last delta.
+func TestBackup_DecryptIncremental(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	password := "password"
+	b, salt, key := newIncrementalTestBackup(t, password)
+	signingKey := b.TransmissionIdentity.RSASigningPrivateKey
+
+	snapshot, err := b.EncryptSnapshot(rng, key, salt, testParams())
+	require.NoError(t, err)
+
+	// Add a contact and change the username
+	next := copyBackup(b)
+	next.Contacts.Identities = append(next.Contacts.Identities,
+		id.NewIdFromString("contact3", id.User, t))
+	next.UserDiscoveryRegistration.FactList = fact.FactList{
+		{Fact: "bob", T: fact.Username},
+		{Fact: "bob@example.com", T: fact.Email},
+	}
+	d1 := MakeDelta(b, next)
+	delta1, err := d1.Encrypt(rng, key, signingKey, snapshot)
+	require.NoError(t, err)
+
+	// Remove a contact and the email
+	last := copyBackup(next)
+	last.Contacts.Identities = last.Contacts.Identities[1:]
+	last.UserDiscoveryRegistration.FactList =
+		last.UserDiscoveryRegistration.FactList[:1]
+	d2 := MakeDelta(next, last)
+	require.Len(t, d2.ContactsRemoved, 1)
+	require.Len(t, d2.FactsRemoved, 1)
+	delta2, err := d2.Encrypt(rng, key, signingKey, delta1)
+	require.NoError(t, err)
+
+	decrypted := &Backup{}
+	err = decrypted.DecryptIncremental(
+		password, snapshot, [][]byte{delta2, delta1})
+	require.NoError(t, err)
+	require.Equal(t, b.RegistrationCode, decrypted.RegistrationCode)
+	require.ElementsMatch(t,
+		last.Contacts.Identities, decrypted.Contacts.Identities)
+	require.ElementsMatch(t, last.UserDiscoveryRegistration.FactList,
+		decrypted.UserDiscoveryRegistration.FactList)
+
+	// The snapshot alone decrypts to the original backup
+	decrypted = &Backup{}
+	require.NoError(t, decrypted.DecryptIncremental(password, snapshot, nil))
+	require.Equal(t, b.Contacts, decrypted.Contacts)
+
+	// A version 1 snapshot is not a version 0 backup
+	require.Error(t, (&Backup{}).Decrypt(password, snapshot))
+}
+
+// Tests that deltas can be added to a version 0 backup.
+func TestBackup_DecryptIncremental_Version0(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	password := "password"
+	b, salt, key := newIncrementalTestBackup(t, password)
+
+	v0, err := b.Encrypt(rng, key, salt, testParams())
+	require.NoError(t, err)
+
+	contact := id.NewIdFromString("contact3", id.User, t)
+	d := Delta{ContactsAdded: []*id.ID{contact}}
+	delta, err := d.Encrypt(
+		rng, key, b.TransmissionIdentity.RSASigningPrivateKey, v0)
+	require.NoError(t, err)
+
+	decrypted := &Backup{}
+	require.NoError(t,
+		decrypted.DecryptIncremental(password, v0, [][]byte{delta}))
+	require.Contains(t, decrypted.Contacts.Identities, contact)
+	require.Len(t, decrypted.Contacts.Identities, 3)
+}
+
+// Error path: tests that DecryptIncremental rejects deltas that are missing,
+// forked, from another snapshot, modified, or signed by another identity.
+func TestBackup_DecryptIncremental_InvalidChain(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	password := "password"
+	b, salt, key := newIncrementalTestBackup(t, password)
+	signingKey := b.TransmissionIdentity.RSASigningPrivateKey
+
+	snapshot, err := b.EncryptSnapshot(rng, key, salt, testParams())
+	require.NoError(t, err)
+	otherSnapshot, err := b.EncryptSnapshot(rng, key, salt, testParams())
+	require.NoError(t, err)
+
+	d := Delta{ContactsRemoved: b.Contacts.Identities[:1]}
+	delta1, err := d.Encrypt(rng, key, signingKey, snapshot)
+	require.NoError(t, err)
+	delta2, err := d.Encrypt(rng, key, signingKey, delta1)
+	require.NoError(t, err)
+	fork, err := d.Encrypt(rng, key, signingKey, snapshot)
+	require.NoError(t, err)
+	otherDelta, err := d.Encrypt(rng, key, signingKey, otherSnapshot)
+	require.NoError(t, err)
+
+	otherSigningKey, err := rsa.GenerateKey(rng, 2048)
+	require.NoError(t, err)
+	unsigned, err := d.Encrypt(rng, key, otherSigningKey, snapshot)
+	require.NoError(t, err)
+
+	modifiedHeader := append([]byte{}, delta1...)
+	modifiedHeader[deltaHeaderSize-1] ^= 1
+	modifiedData := append([]byte{}, delta1...)
+	modifiedData[len(modifiedData)-1] ^= 1
+
+	tests := map[string][][]byte{
+		"missing delta":   {delta2},
+		"forked chain":    {delta1, fork},
+		"other snapshot":  {otherDelta},
+		"modified header": {modifiedHeader},
+		"modified data":   {modifiedData},
+		"wrong signer":    {unsigned},
+		"snapshot":        {snapshot},
+		"short":           {delta1[:deltaHeaderSize-1]},
+	}
+	for name, deltas := range tests {
+		decrypted := &Backup{}
+		err = decrypted.DecryptIncremental(password, snapshot, deltas)
+		require.Error(t, err, name)
+		require.Len(t, decrypted.Contacts.Identities, 2, name)
+	}
+
+	err = (&Backup{}).DecryptIncremental("wrong", snapshot, [][]byte{delta1})
+	require.Error(t, err)
+
+	_, err = d.Encrypt(rng, key, signingKey, []byte("not a backup"))
+	require.Error(t, err)
+}
+
+// Tests that Backup.Apply skips contacts and facts that were already added or
+// removed.
+func TestBackup_Apply(t *testing.T) {
+	c1 := id.NewIdFromString("contact1", id.User, t)
+	c2 := id.NewIdFromString("contact2", id.User, t)
+	username := fact.Fact{Fact: "alice", T: fact.Username}
+
+	b := &Backup{Contacts: Contacts{Identities: []*id.ID{c1}}}
+	b.Apply(Delta{
+		ContactsAdded:   []*id.ID{c1, c2},
+		ContactsRemoved: []*id.ID{id.NewIdFromString("none", id.User, t)},
+		FactsAdded:      fact.FactList{username, username},
+	})
+	require.Equal(t, []*id.ID{c1, c2}, b.Contacts.Identities)
+	require.Equal(t,
+		fact.FactList{username}, b.UserDiscoveryRegistration.FactList)
+
+	b.Apply(Delta{
+		ContactsRemoved: []*id.ID{c1},
+		FactsRemoved:    fact.FactList{username},
+	})
+	require.Equal(t, []*id.ID{c2}, b.Contacts.Identities)
+	require.Empty(t, b.UserDiscoveryRegistration.FactList)
+}
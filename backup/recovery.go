@@ -0,0 +1,243 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package backup
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/crypto/contact"
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/elixxir/crypto/diffieHellman"
+	"gitlab.com/elixxir/crypto/nike"
+	"gitlab.com/xx_network/crypto/csprng"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// shareKeyVector separates the key that encrypts a share from other uses
+	// of the shared secret.
+	shareKeyVector = "BackupRecoveryShareKey"
+
+	// The type of key a share is encrypted to precedes the length of the
+	// ephemeral public key and the key itself.
+	shareKeyTypeLen     = 1
+	dhShareKeyType      = 0
+	nikeShareKeyType    = 1
+	ephemeralKeyLenSize = 2
+)
+
+// Error messages.
+const (
+	// EncryptShareToContact
+	errInvalidRecipientKey = "contact DH public key is not a valid key in " +
+		"the group"
+
+	// DecryptShareWithDH and DecryptShareWithNIKE
+	errEncryptedShareLen   = "encrypted share of %d bytes is too short"
+	errShareKeyType        = "share is not encrypted to a %s key"
+	errInvalidEphemeralKey = "ephemeral public key is invalid: %+v"
+	errDecryptShare        = "failed to decrypt share: %+v"
+	errDecryptedShareLen   = "decrypted share of %d bytes is too short"
+)
+
+// EncryptShareToContact encrypts the share and the Recovery to the DH public
+// key of a trusted contact, who decrypts it with DecryptShareWithDH and returns
+// it when the user recovers their account. The share is encrypted under a key
+// from an ephemeral DH key exchange in the group, which must be the group of
+// the contact's key.
+//
+// The encrypted share has the format:
+//
+//	[0] | [ephemeral key length] | [ephemeral key] | [DATA]
+func EncryptShareToContact(grp *cyclic.Group, share Share, recovery Recovery,
+	recipient contact.Contact, rng csprng.Source) ([]byte, error) {
+	if recipient.DhPubKey == nil ||
+		!diffieHellman.CheckPublicKey(grp, recipient.DhPubKey) {
+		return nil, errors.New(errInvalidRecipientKey)
+	}
+
+	privKey := diffieHellman.GeneratePrivateKey(
+		diffieHellman.DefaultPrivateKeyLength, grp, rng)
+	pubKey := diffieHellman.GeneratePublicKey(privKey, grp)
+	secret := diffieHellman.GenerateSessionKey(privKey, recipient.DhPubKey, grp)
+
+	keyLen := uint64(len(grp.GetPBytes()))
+	return encryptShare(grp, share, recovery, dhShareKeyType,
+		pubKey.LeftpadBytes(keyLen), recipient.DhPubKey.LeftpadBytes(keyLen),
+		secret.Bytes(), rng)
+}
+
+// DecryptShareWithDH decrypts a share and Recovery encrypted by
+// EncryptShareToContact with the contact's DH private key. The share is
+// verified against the commitments before it is returned.
+func DecryptShareWithDH(grp *cyclic.Group, encryptedShare []byte,
+	dhPrivateKey *cyclic.Int) (Share, Recovery, error) {
+	header, ephemeral, ciphertext, err :=
+		unmarshalEncryptedShare(encryptedShare, dhShareKeyType)
+	if err != nil {
+		return Share{}, Recovery{}, err
+	}
+
+	if len(ephemeral) != len(grp.GetPBytes()) ||
+		!grp.BytesInside(ephemeral) {
+		return Share{}, Recovery{}, errors.Errorf(
+			errInvalidEphemeralKey, "not in the group")
+	}
+	pubKey := grp.NewIntFromBytes(ephemeral)
+	if !diffieHellman.CheckPublicKey(grp, pubKey) {
+		return Share{}, Recovery{}, errors.Errorf(
+			errInvalidEphemeralKey, "failed public key check")
+	}
+	secret := diffieHellman.GenerateSessionKey(dhPrivateKey, pubKey, grp)
+
+	recipient := diffieHellman.GeneratePublicKey(dhPrivateKey, grp)
+	keyLen := uint64(len(grp.GetPBytes()))
+	return decryptShare(grp, header, recipient.LeftpadBytes(keyLen),
+		secret.Bytes(), ciphertext)
+}
+
+// EncryptShareToNIKE encrypts the share and the Recovery to the NIKE public key
+// of a trusted contact, such as an ecdh key, who decrypts it with
+// DecryptShareWithNIKE and returns it when the user recovers their account. The
+// share is encrypted under a key from a key exchange with an ephemeral key of
+// the same scheme.
+//
+// An ed25519 identity key can be converted to an ecdh key with
+// ecdh.Edwards2EcdhNikePublicKey.
+//
+// The encrypted share has the format:
+//
+//	[1] | [ephemeral key length] | [ephemeral key] | [DATA]
+func EncryptShareToNIKE(grp *cyclic.Group, share Share, recovery Recovery,
+	recipient nike.PublicKey, rng csprng.Source) ([]byte, error) {
+	privKey, pubKey := recipient.Scheme().NewKeypair(rng)
+	secret := privKey.DeriveSecret(recipient)
+
+	return encryptShare(grp, share, recovery, nikeShareKeyType,
+		pubKey.Bytes(), recipient.Bytes(), secret, rng)
+}
+
+// DecryptShareWithNIKE decrypts a share and Recovery encrypted by
+// EncryptShareToNIKE with the contact's NIKE private key. The share is verified
+// against the commitments before it is returned.
+//
+// An ed25519 identity key can be converted to an ecdh key with
+// ecdh.Edwards2EcdhNikePrivateKey.
+func DecryptShareWithNIKE(grp *cyclic.Group, encryptedShare []byte,
+	privateKey nike.PrivateKey) (Share, Recovery, error) {
+	header, ephemeral, ciphertext, err :=
+		unmarshalEncryptedShare(encryptedShare, nikeShareKeyType)
+	if err != nil {
+		return Share{}, Recovery{}, err
+	}
+
+	scheme := privateKey.Scheme()
+	pubKey, err := scheme.UnmarshalBinaryPublicKey(ephemeral)
+	if err != nil {
+		return Share{}, Recovery{}, errors.Errorf(errInvalidEphemeralKey, err)
+	}
+	secret := privateKey.DeriveSecret(pubKey)
+
+	recipient := scheme.DerivePublicKey(privateKey)
+	return decryptShare(grp, header, recipient.Bytes(), secret, ciphertext)
+}
+
+// encryptShare encrypts the marshalled share and Recovery under a key derived
+// from the shared secret. The header, which holds the key type and
+// ephemeral public key, is authenticated with the ciphertext.
+func encryptShare(grp *cyclic.Group, share Share, recovery Recovery,
+	keyType byte, ephemeral, recipient, secret []byte,
+	rng csprng.Source) ([]byte, error) {
+	header := make([]byte, shareKeyTypeLen+ephemeralKeyLenSize, shareKeyTypeLen+
+		ephemeralKeyLenSize+len(ephemeral))
+	header[0] = keyType
+	binary.BigEndian.PutUint16(header[shareKeyTypeLen:], uint16(len(ephemeral)))
+	header = append(header, ephemeral...)
+
+	plaintext := append(share.Marshal(grp), recovery.Marshal(grp)...)
+	ciphertext, err := encrypt(
+		rng, plaintext, deriveShareKey(secret, header, recipient), header)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, ciphertext...), nil
+}
+
+// decryptShare decrypts and verifies the share and Recovery encrypted by
+// encryptShare.
+func decryptShare(grp *cyclic.Group, header, recipient, secret,
+	ciphertext []byte) (Share, Recovery, error) {
+	plaintext, err := decrypt(
+		ciphertext, deriveShareKey(secret, header, recipient), header)
+	if err != nil {
+		return Share{}, Recovery{}, errors.Errorf(errDecryptShare, err)
+	}
+
+	shareLen := shareIndexLen + len(grp.GetPBytes())
+	if len(plaintext) < shareLen {
+		return Share{}, Recovery{},
+			errors.Errorf(errDecryptedShareLen, len(plaintext))
+	}
+	share, err := UnmarshalShare(grp, plaintext[:shareLen])
+	if err != nil {
+		return Share{}, Recovery{}, err
+	}
+	recovery, err := UnmarshalRecovery(grp, plaintext[shareLen:])
+	if err != nil {
+		return Share{}, Recovery{}, err
+	}
+
+	if !VerifyShare(grp, share, recovery.Commitments) {
+		return Share{}, Recovery{}, errors.Errorf(errInvalidShare, share.Index)
+	}
+	return share, recovery, nil
+}
+
+// unmarshalEncryptedShare returns the header, ephemeral public key, and
+// ciphertext of an encrypted share. Returns an error if the share is not
+// encrypted to the given key type.
+func unmarshalEncryptedShare(encryptedShare []byte, keyType byte) (
+	header, ephemeral, ciphertext []byte, err error) {
+	if len(encryptedShare) < shareKeyTypeLen+ephemeralKeyLenSize {
+		return nil, nil, nil,
+			errors.Errorf(errEncryptedShareLen, len(encryptedShare))
+	}
+	if encryptedShare[0] != keyType {
+		name := "DH"
+		if keyType == nikeShareKeyType {
+			name = "NIKE"
+		}
+		return nil, nil, nil, errors.Errorf(errShareKeyType, name)
+	}
+
+	ephemeralLen := int(binary.BigEndian.Uint16(
+		encryptedShare[shareKeyTypeLen:]))
+	headerLen := shareKeyTypeLen + ephemeralKeyLenSize + ephemeralLen
+	if len(encryptedShare) < headerLen {
+		return nil, nil, nil,
+			errors.Errorf(errEncryptedShareLen, len(encryptedShare))
+	}
+
+	header = encryptedShare[:headerLen]
+	ephemeral = header[shareKeyTypeLen+ephemeralKeyLenSize:]
+	return header, ephemeral, encryptedShare[headerLen:], nil
+}
+
+// deriveShareKey derives the key that encrypts a share from the shared secret,
+// the header, which holds the ephemeral public key, and the recipient's public
+// key.
+func deriveShareKey(secret, header, recipient []byte) []byte {
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte(shareKeyVector))
+	h.Write(secret)
+	h.Write(header)
+	h.Write(recipient)
+	return h.Sum(nil)
+}
@@ -0,0 +1,135 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package backup
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/elixxir/crypto/contact"
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/elixxir/crypto/diffieHellman"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// newTestContact returns a contact with a new DH key and its private key.
+func newTestContact(t *testing.T, grp *cyclic.Group, name string) (
+	contact.Contact, *cyclic.Int) {
+	privKey := diffieHellman.GeneratePrivateKey(
+		diffieHellman.DefaultPrivateKeyLength, grp, csprng.NewSystemRNG())
+	return contact.Contact{
+		ID:       id.NewIdFromString(name, id.User, t),
+		DhPubKey: diffieHellman.GeneratePublicKey(privKey, grp),
+	}, privKey
+}
+
+// Tests that a key split into shares encrypted to a contact's DH key, an ecdh
+// key, and an ed25519 identity is recovered from the shares the contacts
+// decrypt.
+func TestEncryptShare_Recovery(t *testing.T) {
+	grp := newTestGroup()
+	rng := csprng.NewSystemRNG()
+	key := newTestKey(t)
+
+	shares, recovery, err := SplitKey(grp, key, 3, 3, rng)
+	require.NoError(t, err)
+
+	// Contact DH key
+	c, dhPrivKey := newTestContact(t, grp, "contact")
+	encrypted, err := EncryptShareToContact(grp, shares[0], recovery, c, rng)
+	require.NoError(t, err)
+	dhShare, dhRecovery, err := DecryptShareWithDH(grp, encrypted, dhPrivKey)
+	require.NoError(t, err)
+	require.Equal(t, recovery.Marshal(grp), dhRecovery.Marshal(grp))
+
+	// ecdh key
+	nikePrivKey, nikePubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	encrypted, err = EncryptShareToNIKE(
+		grp, shares[1], recovery, nikePubKey, rng)
+	require.NoError(t, err)
+	nikeShare, _, err := DecryptShareWithNIKE(grp, encrypted, nikePrivKey)
+	require.NoError(t, err)
+
+	// ed25519 identity
+	edPubKey, edPrivKey, err := ed25519.GenerateKey(rng)
+	require.NoError(t, err)
+	encrypted, err = EncryptShareToNIKE(grp, shares[2], recovery,
+		ecdh.Edwards2EcdhNikePublicKey(edPubKey), rng)
+	require.NoError(t, err)
+	edShare, _, err := DecryptShareWithNIKE(
+		grp, encrypted, ecdh.Edwards2EcdhNikePrivateKey(edPrivKey))
+	require.NoError(t, err)
+
+	combined, err := CombineShares(
+		grp, []Share{dhShare, nikeShare, edShare}, dhRecovery)
+	require.NoError(t, err)
+	require.Equal(t, key, combined)
+}
+
+// Error path: tests that encrypted shares cannot be decrypted with the wrong
+// key or key type, or when modified.
+func TestDecryptShare_Errors(t *testing.T) {
+	grp := newTestGroup()
+	rng := csprng.NewSystemRNG()
+	shares, recovery, err := SplitKey(grp, newTestKey(t), 2, 2, rng)
+	require.NoError(t, err)
+
+	c, dhPrivKey := newTestContact(t, grp, "contact")
+	_, otherDHPrivKey := newTestContact(t, grp, "other")
+	dhEncrypted, err :=
+		EncryptShareToContact(grp, shares[0], recovery, c, rng)
+	require.NoError(t, err)
+
+	nikePrivKey, nikePubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	otherNikePrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	nikeEncrypted, err := EncryptShareToNIKE(
+		grp, shares[0], recovery, nikePubKey, rng)
+	require.NoError(t, err)
+
+	_, _, err = DecryptShareWithDH(grp, dhEncrypted, otherDHPrivKey)
+	require.Error(t, err, "wrong DH key")
+	_, _, err = DecryptShareWithNIKE(grp, nikeEncrypted, otherNikePrivKey)
+	require.Error(t, err, "wrong NIKE key")
+	_, _, err = DecryptShareWithDH(grp, nikeEncrypted, dhPrivKey)
+	require.Error(t, err, "NIKE share with DH key")
+	_, _, err = DecryptShareWithNIKE(grp, dhEncrypted, nikePrivKey)
+	require.Error(t, err, "DH share with NIKE key")
+
+	for i, encrypted := range [][]byte{dhEncrypted, nikeEncrypted} {
+		modifiedKey := append([]byte{}, encrypted...)
+		modifiedKey[shareKeyTypeLen+ephemeralKeyLenSize] ^= 1
+		modifiedData := append([]byte{}, encrypted...)
+		modifiedData[len(modifiedData)-1] ^= 1
+		tests := map[string][]byte{
+			"modified key":  modifiedKey,
+			"modified data": modifiedData,
+			"short header":  encrypted[:shareKeyTypeLen],
+			"short key":     encrypted[:shareKeyTypeLen+ephemeralKeyLenSize+1],
+		}
+		for name, data := range tests {
+			if i == 0 {
+				_, _, err = DecryptShareWithDH(grp, data, dhPrivKey)
+			} else {
+				_, _, err = DecryptShareWithNIKE(grp, data, nikePrivKey)
+			}
+			require.Error(t, err, name)
+		}
+	}
+
+	// A contact without a valid DH key
+	_, err = EncryptShareToContact(grp, shares[0], recovery,
+		contact.Contact{DhPubKey: grp.NewInt(1)}, rng)
+	require.Error(t, err)
+	_, err = EncryptShareToContact(
+		grp, shares[0], recovery, contact.Contact{}, rng)
+	require.Error(t, err)
+}
@@ -0,0 +1,357 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package backup
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/large"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// MaxShares is the largest number of shares a backup key can be split into.
+const MaxShares = 255
+
+// shareIndexLen is the size of the index of a marshalled Share.
+const shareIndexLen = 1
+
+// encryptedKeyLen is the size of the backup key encrypted under the recovery
+// key, which is the nonce, the key, and the tag.
+const encryptedKeyLen = chacha20poly1305.NonceSizeX + KeyLen +
+	chacha20poly1305.Overhead
+
+// Error messages.
+const (
+	// SplitKey
+	errInvalidThreshold = "threshold %d must be between 1 and the number of " +
+		"shares %d, which must be at most %d"
+	errShareKeyLen     = "key of %d bytes must be %d bytes"
+	errSubgroupOrder   = "subgroup order of %d bits must be larger than %d bits"
+	errReadCoefficient = "failed to read coefficient: %+v"
+	errReadRecoveryKey = "failed to read recovery key: %+v"
+
+	// CombineShares
+	errNoCommitments    = "there must be at least one commitment"
+	errInvalidShare     = "share %d does not match the commitments"
+	errNotEnoughShares  = "%d unique shares are fewer than the threshold %d"
+	errCombinedKeyLen   = "reconstructed key is larger than %d bytes"
+	errCombinedMismatch = "reconstructed key does not match the commitments"
+	errDecryptKey       = "failed to decrypt backup key: %+v"
+
+	// UnmarshalShare
+	errShareLen   = "share of %d bytes must be %d bytes"
+	errShareIndex = "share index must be at least 1"
+	errShareValue = "share value is outside of the subgroup order"
+
+	// UnmarshalCommitments
+	errCommitmentsLen = "commitments of %d bytes must be a non-zero " +
+		"multiple of %d bytes"
+	errCommitmentValue = "commitment %d is outside of the group"
+
+	// UnmarshalRecovery
+	errRecoveryLen = "recovery of %d bytes is too short"
+)
+
+// Share is one of the shares that a backup key is split into by SplitKey. Any
+// threshold number of shares reconstruct the key with CombineShares, while
+// fewer reveal nothing about it.
+//
+// The shares are of a random recovery key rather than of the backup key itself,
+// which is derived from a password. The backup key is encrypted under the
+// recovery key, so nothing a contact holds can be used to check a guess of the
+// password.
+type Share struct {
+	// Index is the x-coordinate of the share, from 1 to the number of shares.
+	Index uint8
+
+	// Value is the sharing polynomial evaluated at Index, modulo the order of
+	// the prime order subgroup of the group.
+	Value *large.Int
+}
+
+// Commitments are the Feldman commitments to the coefficients of the sharing
+// polynomial, (g^2)^a_j mod p for each coefficient a_j, where g is the
+// generator and p is the prime of the group. They are published with the
+// shares so that each share can be verified. The number of commitments is the
+// threshold.
+//
+// Note that the first commitment is (g^2)^r for the random recovery key r.
+// Recovering r from it requires a discrete logarithm of a uniformly random
+// KeyLen byte exponent, which gives 128-bit security.
+type Commitments []*cyclic.Int
+
+// Recovery is held by every contact along with their share. It holds the
+// commitments that verify the shares and the backup key encrypted under the
+// recovery key that the shares reconstruct.
+type Recovery struct {
+	Commitments Commitments
+
+	// EncryptedKey is the backup key encrypted under the recovery key, with
+	// the marshalled commitments as additional data.
+	EncryptedKey []byte
+}
+
+// SplitKey splits the backup key into the given number of shares with Shamir
+// secret sharing, any threshold number of which reconstruct the key, and
+// returns the shares with the Recovery that every contact holds. The shares
+// are of a new random recovery key, under which the backup key is encrypted.
+// The group must have a safe prime with a subgroup order larger than
+// 2^(8*KeyLen).
+func SplitKey(grp *cyclic.Group, key []byte, threshold, shares int,
+	rng csprng.Source) ([]Share, Recovery, error) {
+	q := grp.GetPSub1Factor()
+	if threshold < 1 || shares < threshold || shares > MaxShares {
+		return nil, Recovery{}, errors.Errorf(
+			errInvalidThreshold, threshold, shares, MaxShares)
+	} else if len(key) != KeyLen {
+		return nil, Recovery{}, errors.Errorf(errShareKeyLen, len(key), KeyLen)
+	} else if q.BitLen() <= 8*KeyLen {
+		return nil, Recovery{},
+			errors.Errorf(errSubgroupOrder, q.BitLen(), 8*KeyLen)
+	}
+
+	recoveryKey := make([]byte, KeyLen)
+	if _, err := io.ReadFull(rng, recoveryKey); err != nil {
+		return nil, Recovery{}, errors.Errorf(errReadRecoveryKey, err)
+	}
+
+	base := commitmentBase(grp)
+
+	// The polynomial f(x) = a_0 + a_1*x + ... + a_(t-1)*x^(t-1) mod q, where
+	// a_0 is the recovery key and the other coefficients are random
+	coefficients := make([]*large.Int, threshold)
+	commitments := make(Commitments, threshold)
+	coefficients[0] = large.NewIntFromBytes(recoveryKey)
+	for j := range coefficients {
+		if j > 0 {
+			a, err := randomExponent(q, rng)
+			if err != nil {
+				return nil, Recovery{}, err
+			}
+			coefficients[j] = a
+		}
+		commitments[j] = grp.NewIntFromLargeInt(
+			large.NewInt(1).Exp(base, coefficients[j], grp.GetP()))
+	}
+
+	out := make([]Share, shares)
+	for i := range out {
+		x := large.NewInt(int64(i + 1))
+
+		// Evaluate the polynomial with Horner's method
+		y := large.NewInt(0)
+		for j := threshold - 1; j >= 0; j-- {
+			y.Mul(y, x)
+			y.Add(y, coefficients[j])
+			y.Mod(y, q)
+		}
+		out[i] = Share{Index: uint8(i + 1), Value: y}
+	}
+
+	encryptedKey, err :=
+		encrypt(rng, key, recoveryKey, commitments.Marshal(grp))
+	if err != nil {
+		return nil, Recovery{}, err
+	}
+
+	return out, Recovery{commitments, encryptedKey}, nil
+}
+
+// VerifyShare returns true if the share is a share of the recovery key
+// committed to by the commitments.
+func VerifyShare(grp *cyclic.Group, share Share, commitments Commitments) bool {
+	q := grp.GetPSub1Factor()
+	if share.Index == 0 || share.Value == nil ||
+		share.Value.Cmp(large.NewInt(0)) < 0 || share.Value.Cmp(q) >= 0 {
+		return false
+	}
+
+	// The share is valid if (g^2)^f(i) = product of C_j^(i^j) mod p
+	p := grp.GetP()
+	expected := large.NewInt(1).Exp(commitmentBase(grp), share.Value, p)
+
+	x := large.NewInt(int64(share.Index))
+	xPow := large.NewInt(1)
+	product := large.NewInt(1)
+	for _, c := range commitments {
+		term := large.NewInt(1).Exp(c.GetLargeInt(), xPow, p)
+		product.Mod(product.Mul(product, term), p)
+		xPow.Mod(xPow.Mul(xPow, x), q)
+	}
+
+	return expected.Cmp(product) == 0
+}
+
+// CombineShares reconstructs the recovery key from at least a threshold number
+// of shares and decrypts the backup key with it. Every share is verified
+// against the commitments, as is the reconstructed recovery key, and an error
+// is returned if any does not match.
+func CombineShares(
+	grp *cyclic.Group, shares []Share, recovery Recovery) ([]byte, error) {
+	commitments := recovery.Commitments
+	threshold := len(commitments)
+	if threshold == 0 {
+		return nil, errors.New(errNoCommitments)
+	}
+
+	// Use the first threshold shares with unique indexes
+	unique := make([]Share, 0, threshold)
+	seen := make(map[uint8]bool, len(shares))
+	for _, share := range shares {
+		if seen[share.Index] {
+			continue
+		} else if !VerifyShare(grp, share, commitments) {
+			return nil, errors.Errorf(errInvalidShare, share.Index)
+		}
+		seen[share.Index] = true
+		unique = append(unique, share)
+		if len(unique) == threshold {
+			break
+		}
+	}
+	if len(unique) < threshold {
+		return nil, errors.Errorf(errNotEnoughShares, len(unique), threshold)
+	}
+
+	// Lagrange interpolation of f(0) = sum of y_i * l_i(0) mod q, where
+	// l_i(0) = product of x_j / (x_j - x_i) mod q for every j != i
+	q := grp.GetPSub1Factor()
+	recoveryKey := large.NewInt(0)
+	for i, si := range unique {
+		xi := large.NewInt(int64(si.Index))
+		num, den := large.NewInt(1), large.NewInt(1)
+		for j, sj := range unique {
+			if i == j {
+				continue
+			}
+			xj := large.NewInt(int64(sj.Index))
+			num.Mod(num.Mul(num, xj), q)
+			diff := large.NewInt(0).Sub(xj, xi)
+			den.Mod(den.Mul(den, diff), q)
+		}
+		l := num.Mul(num, large.NewInt(0).ModInverse(den, q))
+		recoveryKey.Mod(recoveryKey.Add(recoveryKey, l.Mul(l, si.Value)), q)
+	}
+
+	if recoveryKey.ByteLen() > KeyLen {
+		return nil, errors.Errorf(errCombinedKeyLen, KeyLen)
+	}
+	committed :=
+		large.NewInt(1).Exp(commitmentBase(grp), recoveryKey, grp.GetP())
+	if committed.Cmp(commitments[0].GetLargeInt()) != 0 {
+		return nil, errors.New(errCombinedMismatch)
+	}
+
+	key, err := decrypt(recovery.EncryptedKey,
+		recoveryKey.LeftpadBytes(KeyLen), commitments.Marshal(grp))
+	if err != nil {
+		return nil, errors.Errorf(errDecryptKey, err)
+	}
+	return key, nil
+}
+
+// Marshal returns the share as the index followed by the value padded to the
+// length of the prime of the group.
+func (s Share) Marshal(grp *cyclic.Group) []byte {
+	valueLen := uint64(len(grp.GetPBytes()))
+	out := make([]byte, 0, shareIndexLen+valueLen)
+	out = append(out, s.Index)
+	return append(out, s.Value.LeftpadBytes(valueLen)...)
+}
+
+// UnmarshalShare unmarshals a share returned by Share.Marshal.
+func UnmarshalShare(grp *cyclic.Group, b []byte) (Share, error) {
+	size := shareIndexLen + len(grp.GetPBytes())
+	if len(b) != size {
+		return Share{}, errors.Errorf(errShareLen, len(b), size)
+	}
+
+	s := Share{Index: b[0], Value: large.NewIntFromBytes(b[shareIndexLen:])}
+	if s.Index == 0 {
+		return Share{}, errors.New(errShareIndex)
+	} else if s.Value.Cmp(grp.GetPSub1Factor()) >= 0 {
+		return Share{}, errors.New(errShareValue)
+	}
+	return s, nil
+}
+
+// Marshal returns the commitments, each padded to the length of the prime of
+// the group.
+func (c Commitments) Marshal(grp *cyclic.Group) []byte {
+	commitmentLen := uint64(len(grp.GetPBytes()))
+	out := make([]byte, 0, uint64(len(c))*commitmentLen)
+	for _, commitment := range c {
+		out = append(out, commitment.LeftpadBytes(commitmentLen)...)
+	}
+	return out
+}
+
+// UnmarshalCommitments unmarshals commitments returned by Commitments.Marshal.
+func UnmarshalCommitments(grp *cyclic.Group, b []byte) (Commitments, error) {
+	commitmentLen := len(grp.GetPBytes())
+	if len(b) == 0 || len(b)%commitmentLen != 0 {
+		return nil, errors.Errorf(errCommitmentsLen, len(b), commitmentLen)
+	}
+
+	c := make(Commitments, len(b)/commitmentLen)
+	for i := range c {
+		buf := b[i*commitmentLen : (i+1)*commitmentLen]
+		value := large.NewIntFromBytes(buf)
+		if !grp.Inside(value) {
+			return nil, errors.Errorf(errCommitmentValue, i)
+		}
+		c[i] = grp.NewIntFromLargeInt(value)
+	}
+	return c, nil
+}
+
+// Marshal returns the recovery as the encrypted key followed by the marshalled
+// commitments.
+func (r Recovery) Marshal(grp *cyclic.Group) []byte {
+	out := make([]byte, 0, len(r.EncryptedKey)+
+		len(r.Commitments)*len(grp.GetPBytes()))
+	out = append(out, r.EncryptedKey...)
+	return append(out, r.Commitments.Marshal(grp)...)
+}
+
+// UnmarshalRecovery unmarshals a recovery returned by Recovery.Marshal.
+func UnmarshalRecovery(grp *cyclic.Group, b []byte) (Recovery, error) {
+	if len(b) < encryptedKeyLen {
+		return Recovery{}, errors.Errorf(errRecoveryLen, len(b))
+	}
+
+	commitments, err := UnmarshalCommitments(grp, b[encryptedKeyLen:])
+	if err != nil {
+		return Recovery{}, err
+	}
+	return Recovery{
+		Commitments:  commitments,
+		EncryptedKey: append([]byte{}, b[:encryptedKeyLen]...),
+	}, nil
+}
+
+// commitmentBase returns g^2 mod p, which generates the prime order subgroup
+// of a group with a safe prime, whatever the order of the group's generator.
+func commitmentBase(grp *cyclic.Group) *large.Int {
+	return large.NewInt(1).Exp(grp.GetG(), large.NewInt(2), grp.GetP())
+}
+
+// randomExponent returns a uniformly random exponent modulo q. It reads 8
+// bytes more than the length of q so that the bias of the modulo is
+// negligible.
+func randomExponent(q *large.Int, rng csprng.Source) (*large.Int, error) {
+	b := make([]byte, q.ByteLen()+8)
+	if _, err := io.ReadFull(rng, b); err != nil {
+		return nil, errors.Errorf(errReadCoefficient, err)
+	}
+	a := large.NewIntFromBytes(b)
+	return a.Mod(a, q), nil
+}
@@ -0,0 +1,253 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/large"
+)
+
+// newTestGroup returns the 2048-bit MODP group from RFC 3526.
+func newTestGroup() *cyclic.Group {
+	primeString := "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+		"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+		"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+		"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+		"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+		"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+		"15728E5A8AACAA68FFFFFFFFFFFFFFFF"
+	p := large.NewInt(1)
+	p.SetString(primeString, 16)
+	return cyclic.NewGroup(p, large.NewInt(2))
+}
+
+// newTestKey returns a random backup key.
+func newTestKey(t *testing.T) []byte {
+	key := make([]byte, KeyLen)
+	_, err := csprng.NewSystemRNG().Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+// Tests that any threshold number of shares, in any order, reconstruct the key.
+func TestSplitKey_CombineShares(t *testing.T) {
+	grp := newTestGroup()
+	rng := csprng.NewSystemRNG()
+	key := newTestKey(t)
+
+	tests := []struct{ threshold, shares int }{{1, 1}, {1, 3}, {2, 3}, {3, 5}}
+	for _, tt := range tests {
+		shares, recovery, err :=
+			SplitKey(grp, key, tt.threshold, tt.shares, rng)
+		require.NoError(t, err)
+		require.Len(t, shares, tt.shares)
+		require.Len(t, recovery.Commitments, tt.threshold)
+		require.Len(t, recovery.EncryptedKey, encryptedKeyLen)
+
+		for _, share := range shares {
+			require.True(t, VerifyShare(grp, share, recovery.Commitments))
+		}
+
+		// The first and last threshold shares
+		combined, err := CombineShares(grp, shares[:tt.threshold], recovery)
+		require.NoError(t, err)
+		require.Equal(t, key, combined)
+
+		subset := shares[tt.shares-tt.threshold:]
+		reversed := make([]Share, len(subset))
+		for i, share := range subset {
+			reversed[len(subset)-1-i] = share
+		}
+		combined, err = CombineShares(grp, reversed, recovery)
+		require.NoError(t, err)
+		require.Equal(t, key, combined)
+	}
+
+	// A key with leading zeros is returned at its full length
+	key[0], key[1] = 0, 0
+	shares, recovery, err := SplitKey(grp, key, 2, 2, rng)
+	require.NoError(t, err)
+	combined, err := CombineShares(grp, shares, recovery)
+	require.NoError(t, err)
+	require.Equal(t, key, combined)
+}
+
+// Tests that a contact holding a share and the Recovery cannot confirm a guess
+// of the password that the backup key is derived from: the commitments are to
+// the random recovery key, and the backup key is encrypted under it.
+func TestSplitKey_PasswordGuess(t *testing.T) {
+	grp := newTestGroup()
+	rng := csprng.NewSystemRNG()
+	salt, err := MakeSalt(rng)
+	require.NoError(t, err)
+	key := DeriveKey("password", salt, testParams())
+
+	shares, recovery, err := SplitKey(grp, key, 2, 3, rng)
+	require.NoError(t, err)
+	share := shares[0]
+
+	for _, guess := range []string{"password", "wrong"} {
+		candidate := DeriveKey(guess, salt, testParams())
+		candidateInt := large.NewIntFromBytes(candidate)
+
+		// The first commitment is not to the candidate key
+		committed := large.NewInt(1).Exp(
+			commitmentBase(grp), candidateInt, grp.GetP())
+		require.NotZero(t,
+			committed.Cmp(recovery.Commitments[0].GetLargeInt()), guess)
+
+		// The candidate key does not decrypt the encrypted key
+		_, err = decrypt(recovery.EncryptedKey, candidate,
+			recovery.Commitments.Marshal(grp))
+		require.Error(t, err, guess)
+
+		// A share with the candidate key in place of the secret does not
+		// match the commitments, whatever the other coefficients are
+		require.NotZero(t, share.Value.Cmp(candidateInt), guess)
+	}
+
+	combined, err := CombineShares(grp, shares[1:], recovery)
+	require.NoError(t, err)
+	require.Equal(t, key, combined)
+}
+
+// Error path: tests that CombineShares rejects too few unique shares, shares
+// that do not match the commitments, and a modified encrypted key.
+func TestCombineShares_Errors(t *testing.T) {
+	grp := newTestGroup()
+	rng := csprng.NewSystemRNG()
+	shares, recovery, err := SplitKey(grp, newTestKey(t), 3, 5, rng)
+	require.NoError(t, err)
+	commitments := recovery.Commitments
+
+	_, err = CombineShares(grp, shares[:2], recovery)
+	require.Error(t, err)
+
+	_, err = CombineShares(
+		grp, []Share{shares[0], shares[0], shares[1]}, recovery)
+	require.Error(t, err)
+
+	_, err = CombineShares(grp, shares, Recovery{})
+	require.Error(t, err)
+
+	tampered := Share{Index: shares[0].Index,
+		Value: large.NewInt(0).Add(shares[0].Value, large.NewInt(1))}
+	require.False(t, VerifyShare(grp, tampered, commitments))
+	_, err = CombineShares(
+		grp, []Share{tampered, shares[1], shares[2]}, recovery)
+	require.Error(t, err)
+
+	// Shares of another key do not match the commitments
+	other, otherRecovery, err := SplitKey(grp, newTestKey(t), 3, 5, rng)
+	require.NoError(t, err)
+	require.False(t, VerifyShare(grp, other[0], commitments))
+	_, err = CombineShares(grp, other, recovery)
+	require.Error(t, err)
+
+	// The encrypted key of another split does not decrypt
+	_, err = CombineShares(grp, shares, Recovery{
+		Commitments:  commitments,
+		EncryptedKey: otherRecovery.EncryptedKey,
+	})
+	require.Error(t, err)
+
+	modified := Recovery{Commitments: commitments,
+		EncryptedKey: append([]byte{}, recovery.EncryptedKey...)}
+	modified.EncryptedKey[encryptedKeyLen-1] ^= 1
+	_, err = CombineShares(grp, shares, modified)
+	require.Error(t, err)
+}
+
+// Error path: tests that SplitKey rejects invalid thresholds and keys.
+func TestSplitKey_Errors(t *testing.T) {
+	grp := newTestGroup()
+	rng := csprng.NewSystemRNG()
+	key := newTestKey(t)
+
+	tests := []struct{ threshold, shares int }{
+		{0, 3}, {4, 3}, {2, MaxShares + 1}}
+	for _, tt := range tests {
+		_, _, err := SplitKey(grp, key, tt.threshold, tt.shares, rng)
+		require.Error(t, err, "threshold %d of %d", tt.threshold, tt.shares)
+	}
+
+	_, _, err := SplitKey(grp, key[:KeyLen-1], 2, 3, rng)
+	require.Error(t, err)
+
+	// A subgroup order too small to hold the recovery key
+	small := cyclic.NewGroup(large.NewInt(23), large.NewInt(2))
+	_, _, err = SplitKey(small, key, 2, 3, rng)
+	require.Error(t, err)
+}
+
+// Tests that a share and its Recovery are unmarshalled to their original
+// values.
+func TestShare_Marshal_UnmarshalShare(t *testing.T) {
+	grp := newTestGroup()
+	shares, recovery, err :=
+		SplitKey(grp, newTestKey(t), 2, 3, csprng.NewSystemRNG())
+	require.NoError(t, err)
+
+	for _, share := range shares {
+		data := share.Marshal(grp)
+		require.Len(t, data, shareIndexLen+len(grp.GetPBytes()))
+		unmarshalled, err := UnmarshalShare(grp, data)
+		require.NoError(t, err)
+		require.Equal(t, share.Index, unmarshalled.Index)
+		require.Zero(t, share.Value.Cmp(unmarshalled.Value))
+	}
+
+	unmarshalled, err := UnmarshalRecovery(grp, recovery.Marshal(grp))
+	require.NoError(t, err)
+	require.Equal(t, recovery.EncryptedKey, unmarshalled.EncryptedKey)
+	require.Len(t, unmarshalled.Commitments, len(recovery.Commitments))
+	for i := range recovery.Commitments {
+		require.Zero(t,
+			recovery.Commitments[i].Cmp(unmarshalled.Commitments[i]))
+	}
+}
+
+// Error path: tests that UnmarshalShare, UnmarshalCommitments, and
+// UnmarshalRecovery reject invalid data.
+func TestUnmarshalShare_Errors(t *testing.T) {
+	grp := newTestGroup()
+	pLen := len(grp.GetPBytes())
+
+	_, err := UnmarshalShare(grp, make([]byte, pLen))
+	require.Error(t, err)
+
+	data := make([]byte, shareIndexLen+pLen)
+	_, err = UnmarshalShare(grp, data)
+	require.Error(t, err, "zero index")
+
+	data[0] = 1
+	copy(data[shareIndexLen:], grp.GetPBytes())
+	_, err = UnmarshalShare(grp, data)
+	require.Error(t, err, "value too large")
+
+	_, err = UnmarshalCommitments(grp, nil)
+	require.Error(t, err)
+	_, err = UnmarshalCommitments(grp, make([]byte, pLen+1))
+	require.Error(t, err)
+	_, err = UnmarshalCommitments(grp, grp.GetPBytes())
+	require.Error(t, err, "outside of the group")
+
+	_, err = UnmarshalRecovery(grp, make([]byte, encryptedKeyLen-1))
+	require.Error(t, err)
+	_, err = UnmarshalRecovery(grp, make([]byte, encryptedKeyLen))
+	require.Error(t, err, "no commitments")
+}
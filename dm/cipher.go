@@ -21,6 +21,7 @@ package dm
 import (
 	"encoding/binary"
 	"io"
+	"math"
 
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -34,7 +35,13 @@ const (
 )
 
 var (
+	// Cipher is the original DMCipher. Its Encrypt panics on failure, so
+	// new code should use CipherV2.
 	Cipher DMCipher = &dmCipher{}
+
+	// CipherV2 encrypts the same Direct Messages as Cipher, but returns
+	// errors instead of panicking.
+	CipherV2 DMCipherV2 = &dmCipherV2{}
 )
 
 // DMCipher is a minimal abstraction for building the DMCipher Protocol layer
@@ -72,8 +79,49 @@ type DMCipher interface {
 		partnerstaticPubKey nike.PublicKey, plaintext []byte, err error)
 }
 
+// DMCipherV2 is the DMCipher interface with an Encrypt that returns an
+// error, such as ErrPlaintextTooLarge, instead of panicking.
+type DMCipherV2 interface {
+	// CiphertextOverhead returns the ciphertext overhead in bytes.
+	CiphertextOverhead() int
+
+	// Encrypt encrypts the given plaintext as an encrypted Direct message.
+	Encrypt(plaintext []byte,
+		senderStaticPrivKey nike.PrivateKey,
+		partnerStaticPubKey nike.PublicKey,
+		rng io.Reader,
+		maxPayloadSize int) (ciphertext []byte, err error)
+
+	// Decrypt decrypts the given ciphertext encrypted as a Direct
+	// message.
+	Decrypt(ciphertext []byte, senderStaticPrivKey nike.PrivateKey) (
+		partnerStaticPublicKey nike.PublicKey, plaintext []byte,
+		err error)
+
+	// IsSelfEncrypted will return whether the ciphertext provided has been
+	// encrypted by the owner of the passed in private key. Returns true
+	// if the ciphertext has been encrypted by the user.
+	IsSelfEncrypted(data []byte, myPrivateKey nike.PrivateKey) bool
+
+	// EncryptSelf will encrypt the passed plaintext. This will simulate the
+	// encryption protocol in Encrypt, using just the user's public key.
+	EncryptSelf(plaintext []byte, myPrivateKey nike.PrivateKey,
+		partnerStaticPubKey nike.PublicKey,
+		maxPayloadSize int) (ciphertext []byte, err error)
+
+	// DecryptSelf will decrypt the passed ciphertext. This will
+	// check if the ciphertext is expected using IsSelfEncrypted.
+	DecryptSelf(ciphertext []byte, myPrivateKey nike.PrivateKey) (
+		partnerstaticPubKey nike.PublicKey, plaintext []byte, err error)
+}
+
 type dmCipher struct{}
 
+// dmCipherV2 shares everything but Encrypt with dmCipher.
+type dmCipherV2 struct {
+	dmCipher
+}
+
 func (s *dmCipher) CiphertextOverhead() int {
 	return (NoiseX.CiphertextOverhead() + ecdh.ECDHNIKE.PublicKeySize() +
 		bengerCodeSize + prologueSize)
@@ -82,17 +130,55 @@ func (s *dmCipher) CiphertextOverhead() int {
 // Encrypt encrypts the given plaintext as an encrypted Direct message.
 // Direct Messages are Noise X messages with a payload that includes
 // a keyed MAC based on the sender/partner static key derivation.
+//
+// Encrypt panics if the plaintext is too large or the keys are invalid.
 func (s *dmCipher) Encrypt(plaintext []byte,
 	senderStaticPrivKey nike.PrivateKey,
 	partnerStaticPubKey nike.PublicKey,
 	rng io.Reader,
 	maxCiphertextSize int) (ciphertext []byte) {
+	ciphertext, err := s.encrypt(plaintext, senderStaticPrivKey,
+		partnerStaticPubKey, rng, maxCiphertextSize)
+	if err != nil {
+		jww.FATAL.Panicf("%+v", err)
+	}
+	return ciphertext
+}
+
+// Encrypt encrypts the given plaintext as an encrypted Direct message.
+// Returns ErrPlaintextTooLarge if the plaintext does not fit in
+// maxCiphertextSize.
+func (s *dmCipherV2) Encrypt(plaintext []byte,
+	senderStaticPrivKey nike.PrivateKey,
+	partnerStaticPubKey nike.PublicKey,
+	rng io.Reader,
+	maxCiphertextSize int) (ciphertext []byte, err error) {
+	return s.encrypt(plaintext, senderStaticPrivKey, partnerStaticPubKey, rng,
+		maxCiphertextSize)
+}
+
+// encrypt is the shared implementation of the Encrypt methods.
+func (s *dmCipher) encrypt(plaintext []byte,
+	senderStaticPrivKey nike.PrivateKey,
+	partnerStaticPubKey nike.PublicKey,
+	rng io.Reader,
+	maxCiphertextSize int) ([]byte, error) {
 
 	if len(plaintext)+s.CiphertextOverhead() > maxCiphertextSize {
-		jww.FATAL.Panicf("plaintext too large")
+		return nil, errors.Wrapf(ErrPlaintextTooLarge, "%d > %d",
+			len(plaintext)+s.CiphertextOverhead(), maxCiphertextSize)
+	} else if len(plaintext) > math.MaxUint16 {
+		return nil, errors.Wrapf(ErrPlaintextTooLarge, "%d > %d",
+			len(plaintext), math.MaxUint16)
+	}
+	if _, ok := senderStaticPrivKey.(*ecdh.PrivateKey); !ok {
+		return nil, errors.Wrap(ErrInvalidKeyType, "private key")
 	}
 
-	k := senderStaticPrivKey.DeriveSecret(partnerStaticPubKey)
+	k, err := deriveSecret(senderStaticPrivKey, partnerStaticPubKey)
+	if err != nil {
+		return nil, err
+	}
 	bengerCode := makeBengerCode(k, plaintext)
 	senderPubKey := ecdh.ECDHNIKE.DerivePublicKey(senderStaticPrivKey)
 	senderPubKeyBytes := senderPubKey.Bytes()
@@ -110,7 +196,7 @@ func (s *dmCipher) Encrypt(plaintext []byte,
 	offset += prologueSize
 	copy(msg[offset:offset+len(plaintext)], plaintext)
 
-	return NoiseX.Encrypt(msg, partnerStaticPubKey, rng)
+	return NoiseX.(*noiseX).encrypt(msg, partnerStaticPubKey, rng)
 }
 
 // Decrypt decrypts the given ciphertext encrypted as a Direct
@@ -125,9 +211,15 @@ func (s *dmCipher) Decrypt(ciphertext []byte,
 		return nil, nil, err
 	}
 
-	// Format: PubKey | bengerCode | msg
-	pubKey := ecdh.ECDHNIKE.NewEmptyPublicKey()
+	// Format: PubKey | bengerCode | len(msg) | msg
 	pubSize := ecdh.ECDHNIKE.PublicKeySize()
+	headerSize := pubSize + bengerCodeSize + prologueSize
+	if len(msg) < headerSize {
+		return nil, nil, errors.Wrapf(ErrCiphertextTooSmall,
+			"payload %d < %d", len(msg), headerSize)
+	}
+
+	pubKey := ecdh.ECDHNIKE.NewEmptyPublicKey()
 	err = pubKey.FromBytes(msg[:pubSize])
 	if err != nil {
 		return nil, nil, err
@@ -137,13 +229,20 @@ func (s *dmCipher) Decrypt(ciphertext []byte,
 	readBengerCode := msg[offset : offset+bengerCodeSize]
 	offset += bengerCodeSize
 
-	readMsgSize := binary.BigEndian.Uint16(
-		msg[offset : offset+prologueSize])
+	readMsgSize := int(binary.BigEndian.Uint16(
+		msg[offset : offset+prologueSize]))
 	offset += prologueSize
 
-	plaintext = msg[offset : offset+int(readMsgSize)]
+	if readMsgSize > len(msg)-offset {
+		return nil, nil, errors.Wrapf(ErrInvalidLength, "%d > %d",
+			readMsgSize, len(msg)-offset)
+	}
+	plaintext = msg[offset : offset+readMsgSize]
 
-	k := receiverStaticPrivKey.DeriveSecret(pubKey)
+	k, err := deriveSecret(receiverStaticPrivKey, pubKey)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	if !isValidBengerCode(readBengerCode, k, plaintext) {
 		return nil, nil, errors.Errorf("[DM] failed benger mac check")
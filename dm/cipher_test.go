@@ -7,9 +7,13 @@
 package dm
 
 import (
+	"encoding/binary"
+	"math"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	"gitlab.com/elixxir/crypto/nike/dh"
 	"gitlab.com/elixxir/crypto/nike/ecdh"
 	"gitlab.com/xx_network/crypto/csprng"
 )
@@ -37,3 +41,101 @@ func TestEncryptDecrypt(t *testing.T) {
 
 	require.Equal(t, message1, message2)
 }
+
+func TestCipherV2_EncryptDecrypt(t *testing.T) {
+	message1 := []byte("i am a message")
+
+	rng := csprng.NewSystemRNG()
+
+	alicePrivKey, expAlicePubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	bobPrivKey, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	ciphertext, err := CipherV2.Encrypt(message1, alicePrivKey, bobPubKey,
+		rng, 10000)
+	require.NoError(t, err)
+	require.Equal(t, 10000, len(ciphertext))
+
+	// Ciphertexts from both versions are interchangeable
+	alicePubKey, message2, err := Cipher.Decrypt(ciphertext, bobPrivKey)
+	require.NoError(t, err)
+	require.Equal(t, expAlicePubKey.Bytes(), alicePubKey.Bytes())
+	require.Equal(t, message1, message2)
+}
+
+func TestCipherV2_Encrypt_PlaintextTooLarge(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	_, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	maxPayloadSize := 1000
+	plaintext := make([]byte, maxPayloadSize-CipherV2.CiphertextOverhead()+1)
+	_, err := CipherV2.Encrypt(plaintext, alicePrivKey, bobPubKey, rng,
+		maxPayloadSize)
+	require.True(t, errors.Is(err, ErrPlaintextTooLarge))
+
+	// The length prefix cannot hold a larger plaintext
+	plaintext = make([]byte, math.MaxUint16+1)
+	_, err = CipherV2.Encrypt(plaintext, alicePrivKey, bobPubKey, rng,
+		2*math.MaxUint16)
+	require.True(t, errors.Is(err, ErrPlaintextTooLarge))
+
+	_, err = CipherV2.EncryptSelf(plaintext, alicePrivKey, bobPubKey,
+		maxPayloadSize)
+	require.True(t, errors.Is(err, ErrPlaintextTooLarge))
+}
+
+func TestCipherV2_Encrypt_InvalidKeyType(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, _ := dh.DHNIKE.NewKeypair(rng)
+	_, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	_, err := CipherV2.Encrypt([]byte("hello"), alicePrivKey, bobPubKey,
+		rng, 1000)
+	require.True(t, errors.Is(err, ErrInvalidKeyType))
+}
+
+// Tests that Cipher.Encrypt still panics when the plaintext is too large.
+func TestCipher_Encrypt_PlaintextTooLarge(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	_, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	require.Panics(t, func() {
+		Cipher.Encrypt(make([]byte, 1000), alicePrivKey, bobPubKey, rng,
+			1000)
+	})
+}
+
+// Tests that Decrypt returns errors for truncated ciphertexts and for
+// payloads whose length prefix is larger than the payload.
+func TestCipherV2_Decrypt_Bounds(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	bobPrivKey, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	ciphertext, err := CipherV2.Encrypt([]byte("hello"), alicePrivKey,
+		bobPubKey, rng, 1000)
+	require.NoError(t, err)
+
+	for _, size := range []int{0, 1, NoiseX.CiphertextOverhead() - 1} {
+		_, _, err = CipherV2.Decrypt(ciphertext[:size], bobPrivKey)
+		require.Error(t, err, "size %d", size)
+	}
+
+	// A payload too small to hold the header
+	short, err := NoiseX.(*noiseX).encrypt(make([]byte, 10), bobPubKey, rng)
+	require.NoError(t, err)
+	_, _, err = CipherV2.Decrypt(short, bobPrivKey)
+	require.True(t, errors.Is(err, ErrCiphertextTooSmall))
+
+	// A payload with a length prefix past its end
+	alicePubKey := ecdh.ECDHNIKE.DerivePublicKey(alicePrivKey)
+	payload := make([]byte, 100)
+	copy(payload, alicePubKey.Bytes())
+	binary.BigEndian.PutUint16(
+		payload[ecdh.ECDHNIKE.PublicKeySize()+bengerCodeSize:], 500)
+	long, err := NoiseX.(*noiseX).encrypt(payload, bobPubKey, rng)
+	require.NoError(t, err)
+	_, _, err = CipherV2.Decrypt(long, bobPrivKey)
+	require.True(t, errors.Is(err, ErrInvalidLength))
+}
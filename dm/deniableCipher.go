@@ -0,0 +1,175 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                           //
+//                                                                            //
+// Use of this source code is governed by a license that can be found         //
+// in the LICENSE file                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+package dm
+
+// Deniable Direct Messages are Noise X messages, like those of Cipher, but
+// their payload carries neither the sender's static public key nor any value
+// that only the sender could have produced. The message is authenticated with
+// a MAC keyed by the secret derived from both parties' static keys. The
+// recipient learns that the message came from the partner because they did
+// not write it themselves, but since the recipient holds the same key they
+// could have forged any message, so the message proves nothing about its
+// sender to a third party, even one given the recipient's private key.
+//
+// The recipient must already know who the partner is, for example from the
+// SIH tag the message was received with, because the sender's identity is not
+// part of the message.
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+
+	"gitlab.com/elixxir/crypto/nike"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+)
+
+const (
+	deniableAuthKeySalt = "dmDeniableAuthKeySalt"
+	deniableAuthSize    = blake2b.Size256
+)
+
+// DeniableCipher encrypts deniable Direct Messages.
+var DeniableCipher DeniableDMCipher = &deniableCipher{}
+
+// DeniableDMCipher is the interface for deniable Direct Messages.
+type DeniableDMCipher interface {
+	// CiphertextOverhead returns the ciphertext overhead in bytes.
+	CiphertextOverhead() int
+
+	// Encrypt encrypts the given plaintext as a deniable Direct message.
+	Encrypt(plaintext []byte,
+		senderStaticPrivKey nike.PrivateKey,
+		partnerStaticPubKey nike.PublicKey,
+		rng io.Reader,
+		maxPayloadSize int) (ciphertext []byte, err error)
+
+	// Decrypt decrypts the given deniable Direct message from the
+	// partner.
+	Decrypt(ciphertext []byte,
+		receiverStaticPrivKey nike.PrivateKey,
+		partnerStaticPubKey nike.PublicKey) (plaintext []byte, err error)
+}
+
+type deniableCipher struct{}
+
+func (s *deniableCipher) CiphertextOverhead() int {
+	return NoiseX.CiphertextOverhead() + deniableAuthSize + prologueSize
+}
+
+// Encrypt encrypts the given plaintext as a deniable Direct message.
+func (s *deniableCipher) Encrypt(plaintext []byte,
+	senderStaticPrivKey nike.PrivateKey,
+	partnerStaticPubKey nike.PublicKey,
+	rng io.Reader,
+	maxPayloadSize int) ([]byte, error) {
+	if _, ok := senderStaticPrivKey.(*ecdh.PrivateKey); !ok {
+		return nil, errors.Wrap(ErrInvalidKeyType, "private key")
+	}
+
+	authKey, err := deriveDeniableAuthKey(senderStaticPrivKey,
+		partnerStaticPubKey)
+	if err != nil {
+		return nil, err
+	}
+	senderPubKey := ecdh.ECDHNIKE.DerivePublicKey(senderStaticPrivKey)
+
+	return s.seal(plaintext, authKey, senderPubKey, partnerStaticPubKey, rng,
+		maxPayloadSize)
+}
+
+// seal builds and encrypts the payload using the given authentication key.
+// Either party can call it, which is what makes the messages deniable.
+func (s *deniableCipher) seal(plaintext, authKey []byte,
+	senderPubKey, receiverPubKey nike.PublicKey, rng io.Reader,
+	maxPayloadSize int) ([]byte, error) {
+	if len(plaintext)+s.CiphertextOverhead() > maxPayloadSize {
+		return nil, errors.Wrapf(ErrPlaintextTooLarge, "%d > %d",
+			len(plaintext)+s.CiphertextOverhead(), maxPayloadSize)
+	} else if len(plaintext) > math.MaxUint16 {
+		return nil, errors.Wrapf(ErrPlaintextTooLarge, "%d > %d",
+			len(plaintext), math.MaxUint16)
+	}
+
+	// Format: authCode | len(msg) | msg
+	msg := make([]byte, maxPayloadSize-NoiseX.CiphertextOverhead())
+	copy(msg, makeDeniableAuthCode(authKey, senderPubKey, receiverPubKey,
+		plaintext))
+	offset := deniableAuthSize
+	binary.BigEndian.PutUint16(msg[offset:], uint16(len(plaintext)))
+	offset += prologueSize
+	copy(msg[offset:], plaintext)
+
+	return NoiseX.(*noiseX).encrypt(msg, receiverPubKey, rng)
+}
+
+// Decrypt decrypts the given deniable Direct message from the partner.
+func (s *deniableCipher) Decrypt(ciphertext []byte,
+	receiverStaticPrivKey nike.PrivateKey,
+	partnerStaticPubKey nike.PublicKey) ([]byte, error) {
+	msg, err := NoiseX.Decrypt(ciphertext, receiverStaticPrivKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Format: authCode | len(msg) | msg
+	headerSize := deniableAuthSize + prologueSize
+	if len(msg) < headerSize {
+		return nil, errors.Wrapf(ErrCiphertextTooSmall,
+			"payload %d < %d", len(msg), headerSize)
+	}
+	readAuthCode := msg[:deniableAuthSize]
+	msgSize := int(binary.BigEndian.Uint16(msg[deniableAuthSize:]))
+	if msgSize > len(msg)-headerSize {
+		return nil, errors.Wrapf(ErrInvalidLength, "%d > %d",
+			msgSize, len(msg)-headerSize)
+	}
+	plaintext := msg[headerSize : headerSize+msgSize]
+
+	authKey, err := deriveDeniableAuthKey(receiverStaticPrivKey,
+		partnerStaticPubKey)
+	if err != nil {
+		return nil, err
+	}
+	receiverPubKey := ecdh.ECDHNIKE.DerivePublicKey(receiverStaticPrivKey)
+	expected := makeDeniableAuthCode(authKey, partnerStaticPubKey,
+		receiverPubKey, plaintext)
+	if !hmac.Equal(readAuthCode, expected) {
+		return nil, errors.Errorf("[DM] failed deniable mac check")
+	}
+
+	return plaintext, nil
+}
+
+// deriveDeniableAuthKey derives the MAC key shared by both partners.
+func deriveDeniableAuthKey(privKey nike.PrivateKey,
+	pubKey nike.PublicKey) ([]byte, error) {
+	k, err := deriveSecret(privKey, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte(deniableAuthKeySalt))
+	h.Write(k)
+	return h.Sum(nil), nil
+}
+
+// makeDeniableAuthCode computes the keyed BLAKE2b MAC of the message. The
+// direction is included so a message cannot be reflected back to its sender.
+func makeDeniableAuthCode(authKey []byte, senderPubKey,
+	receiverPubKey nike.PublicKey, plaintext []byte) []byte {
+	h, _ := blake2b.New256(authKey)
+	h.Write(senderPubKey.Bytes())
+	h.Write(receiverPubKey.Bytes())
+	h.Write(plaintext)
+	return h.Sum(nil)
+}
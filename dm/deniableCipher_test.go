@@ -0,0 +1,112 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                           //
+//                                                                            //
+// Use of this source code is governed by a license that can be found         //
+// in the LICENSE file                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+package dm
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/crypto/csprng"
+
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+)
+
+func TestDeniableCipher_EncryptDecrypt(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, alicePubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	bobPrivKey, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	message := []byte("i am a deniable message")
+
+	ciphertext, err := DeniableCipher.Encrypt(message, alicePrivKey,
+		bobPubKey, rng, 1000)
+	require.NoError(t, err)
+	require.Len(t, ciphertext, 1000)
+
+	plaintext, err := DeniableCipher.Decrypt(ciphertext, bobPrivKey,
+		alicePubKey)
+	require.NoError(t, err)
+	require.Equal(t, message, plaintext)
+
+	// The message does not verify as coming from anyone else
+	_, malloryPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	_, err = DeniableCipher.Decrypt(ciphertext, bobPrivKey, malloryPubKey)
+	require.Error(t, err)
+
+	// Deniable messages are not accepted by the regular cipher
+	_, _, err = CipherV2.Decrypt(ciphertext, bobPrivKey)
+	require.Error(t, err)
+}
+
+// Tests that the recipient alone can produce a message that is accepted as
+// coming from the sender, so a transcript proves nothing about who wrote it.
+func TestDeniableCipher_RecipientForgery(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, alicePubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	bobPrivKey, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	genuine, err := DeniableCipher.Encrypt([]byte("genuine"), alicePrivKey,
+		bobPubKey, rng, 1000)
+	require.NoError(t, err)
+
+	// Bob derives the same authentication key from their own private key
+	// and writes a message "from" Alice
+	authKey, err := deriveDeniableAuthKey(bobPrivKey, alicePubKey)
+	require.NoError(t, err)
+	forged, err := DeniableCipher.(*deniableCipher).seal([]byte("forged"),
+		authKey, alicePubKey, bobPubKey, rng, 1000)
+	require.NoError(t, err)
+
+	// Both messages are indistinguishable to anyone checking with Bob's
+	// key, including a judge Bob hands the private key to
+	for expected, ciphertext := range map[string][]byte{
+		"genuine": genuine, "forged": forged} {
+		require.Len(t, ciphertext, len(genuine))
+		plaintext, err := DeniableCipher.Decrypt(ciphertext, bobPrivKey,
+			alicePubKey)
+		require.NoError(t, err)
+		require.Equal(t, []byte(expected), plaintext)
+	}
+}
+
+func TestDeniableCipher_Encrypt_PlaintextTooLarge(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	_, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	plaintext := make([]byte, 1000-DeniableCipher.CiphertextOverhead()+1)
+	_, err := DeniableCipher.Encrypt(plaintext, alicePrivKey, bobPubKey, rng,
+		1000)
+	require.True(t, errors.Is(err, ErrPlaintextTooLarge))
+}
+
+func TestDeniableCipher_Decrypt_Bounds(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, alicePubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	bobPrivKey, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	// A payload too small to hold the header
+	short, err := NoiseX.(*noiseX).encrypt(make([]byte, 10), bobPubKey, rng)
+	require.NoError(t, err)
+	_, err = DeniableCipher.Decrypt(short, bobPrivKey, alicePubKey)
+	require.True(t, errors.Is(err, ErrCiphertextTooSmall))
+
+	// A payload with a length prefix past its end
+	payload := make([]byte, 100)
+	payload[deniableAuthSize] = 0xFF
+	long, err := NoiseX.(*noiseX).encrypt(payload, bobPubKey, rng)
+	require.NoError(t, err)
+	_, err = DeniableCipher.Decrypt(long, bobPrivKey, alicePubKey)
+	require.True(t, errors.Is(err, ErrInvalidLength))
+
+	ciphertext, err := DeniableCipher.Encrypt([]byte("hello"), alicePrivKey,
+		bobPubKey, rng, 1000)
+	require.NoError(t, err)
+	_, err = DeniableCipher.Decrypt(ciphertext[:10], bobPrivKey, alicePubKey)
+	require.Error(t, err)
+}
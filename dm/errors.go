@@ -9,10 +9,28 @@ package dm
 import (
 	"fmt"
 
+	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/yawning/nyquist.git"
 )
 
+var (
+	// ErrPlaintextTooLarge is returned when a plaintext does not fit in the
+	// requested payload size.
+	ErrPlaintextTooLarge = errors.New("plaintext too large")
+
+	// ErrCiphertextTooSmall is returned when a ciphertext is too small to
+	// contain the fields of its format.
+	ErrCiphertextTooSmall = errors.New("ciphertext too small")
+
+	// ErrInvalidLength is returned when the length prefix of a decrypted
+	// payload is larger than the payload.
+	ErrInvalidLength = errors.New("invalid plaintext length")
+
+	// ErrInvalidKeyType is returned when a key is not an x25519 ECDH key.
+	ErrInvalidKeyType = errors.New("key must be x25519 ECDH")
+)
+
 // panicOnNoiseError is a helper function which will panice for errors on the
 // Noise protocol's Encrypt/Decrypt. This primarily serves as a fix for
 // the coverage hit by un-testable error conditions.
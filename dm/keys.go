@@ -7,6 +7,7 @@
 package dm
 
 import (
+	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/yawning/nyquist.git/dh"
 
@@ -39,3 +40,15 @@ func panicOnFailureToCast(ok bool, keyType string) {
 		jww.FATAL.Panicf("%s must be x25519 ECDH", keyType)
 	}
 }
+
+// deriveSecret derives the DH secret between the keys, returning an error
+// instead of panicking on invalid partner keys.
+func deriveSecret(privKey nike.PrivateKey, pubKey nike.PublicKey) (
+	secret []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("failed to derive secret: %v", r)
+		}
+	}()
+	return privKey.DeriveSecret(pubKey), nil
+}
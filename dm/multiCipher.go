@@ -0,0 +1,222 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                           //
+//                                                                            //
+// Use of this source code is governed by a license that can be found         //
+// in the LICENSE file                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+package dm
+
+// Multi-recipient Direct Messages encrypt the message once under a random
+// content key and then wrap that key for every recipient with NoiseX. Each
+// recipient finds their wrapped key using the SIH tag they share with the
+// sender, hashed with the message nonce so that slots cannot be linked across
+// messages.
+//
+// Every wrapped key carries a benger code over the encrypted body, keyed by
+// the secret between the sender and that recipient. Knowing the content key is
+// therefore not enough for one recipient to forge a body for another.
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+)
+
+const (
+	multiSlotIDSize     = 8
+	multiContentKeySize = chacha20poly1305.KeySize
+	multiCountSize      = 1
+	multiSlotSalt       = "dmMultiSlotSalt"
+
+	// MaxMultiRecipients is the largest number of recipients of a single
+	// multi-recipient message.
+	MaxMultiRecipients = math.MaxUint8
+)
+
+// ErrNoRecipientSlot is returned by DecryptMulti when the message has no
+// wrapped key for the receiver.
+var ErrNoRecipientSlot = errors.New(
+	"no wrapped key for the receiver in message")
+
+var (
+	// multiWrappedKeySize is the size of a content key and benger code
+	// wrapped by NoiseX.
+	multiWrappedKeySize = NoiseX.CiphertextOverhead() +
+		multiContentKeySize + bengerCodeSize
+	multiSlotSize = multiSlotIDSize + multiWrappedKeySize
+)
+
+// MultiCiphertextOverhead returns the ciphertext overhead in bytes of a
+// message sent to the given number of recipients.
+func MultiCiphertextOverhead(numRecipients int) int {
+	return chacha20poly1305.NonceSizeX + multiCountSize +
+		numRecipients*multiSlotSize + prologueSize + chacha20poly1305.Overhead
+}
+
+// EncryptMulti encrypts the plaintext as a single Direct Message readable by
+// all recipients. The ciphertext is always maxPayloadSize bytes and is
+// formatted as such:
+// Nonce | Slot Count | Slots | Encrypted Body
+//
+// Where each slot is formatted as such:
+// Slot ID | NoiseX(Content Key | Benger Code)
+//
+// The number of recipients is not hidden.
+func EncryptMulti(plaintext []byte, senderPrivKey ed25519.PrivateKey,
+	recipients []ed25519.PublicKey, rng io.Reader,
+	maxPayloadSize int) ([]byte, error) {
+	if len(recipients) == 0 || len(recipients) > MaxMultiRecipients {
+		return nil, errors.Errorf("number of recipients must be between "+
+			"1 and %d, got %d", MaxMultiRecipients, len(recipients))
+	}
+	overhead := MultiCiphertextOverhead(len(recipients))
+	if len(plaintext)+overhead > maxPayloadSize {
+		return nil, errors.Wrapf(ErrPlaintextTooLarge, "%d > %d",
+			len(plaintext)+overhead, maxPayloadSize)
+	} else if len(plaintext) > math.MaxUint16 {
+		return nil, errors.Wrapf(ErrPlaintextTooLarge, "%d > %d",
+			len(plaintext), math.MaxUint16)
+	}
+
+	// Format: Nonce | Slot Count | Slots | Encrypted Body
+	ciphertext := make([]byte, 0, maxPayloadSize)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := io.ReadFull(rng, nonce); err != nil {
+		return nil, err
+	}
+	contentKey := make([]byte, multiContentKeySize)
+	if _, err := io.ReadFull(rng, contentKey); err != nil {
+		return nil, err
+	}
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = append(ciphertext, uint8(len(recipients)))
+	headerSize := len(ciphertext) + len(recipients)*multiSlotSize
+
+	// Body format: len(msg) | msg | padding
+	body := make([]byte, maxPayloadSize-headerSize-chacha20poly1305.Overhead)
+	binary.BigEndian.PutUint16(body, uint16(len(plaintext)))
+	copy(body[prologueSize:], plaintext)
+	chaCipher, err := chacha20poly1305.NewX(contentKey)
+	panicOnChaChaFailure(err)
+	encryptedBody := chaCipher.Seal(nil, nonce, body, nil)
+	bodyDigest := makeMultiBodyDigest(nonce, encryptedBody)
+
+	senderNikePrivKey := ecdh.Edwards2EcdhNikePrivateKey(senderPrivKey)
+	for _, recipient := range recipients {
+		recipientNikePubKey := ecdh.Edwards2EcdhNikePublicKey(recipient)
+		k, err := deriveSecret(senderNikePrivKey, recipientNikePubKey)
+		if err != nil {
+			return nil, err
+		}
+
+		slotID := makeMultiSlotID(
+			MakeSenderSihTag(recipient, senderPrivKey), nonce)
+		wrapped, err := NoiseX.(*noiseX).encrypt(
+			append(contentKey, makeBengerCode(k, bodyDigest)...),
+			recipientNikePubKey, rng)
+		if err != nil {
+			return nil, err
+		}
+
+		ciphertext = append(ciphertext, slotID...)
+		ciphertext = append(ciphertext, wrapped...)
+	}
+
+	return append(ciphertext, encryptedBody...), nil
+}
+
+// DecryptMulti decrypts a message created by EncryptMulti. The sender's public
+// key is needed to find the receiver's slot; it is known from the SIH tag the
+// message was received with.
+func DecryptMulti(ciphertext []byte, receiverPrivKey ed25519.PrivateKey,
+	senderPubKey ed25519.PublicKey) ([]byte, error) {
+	minSize := chacha20poly1305.NonceSizeX + multiCountSize
+	if len(ciphertext) < minSize {
+		return nil, errors.Wrapf(ErrCiphertextTooSmall, "%d < %d",
+			len(ciphertext), minSize)
+	}
+	nonce := ciphertext[:chacha20poly1305.NonceSizeX]
+	numSlots := int(ciphertext[chacha20poly1305.NonceSizeX])
+	if len(ciphertext) < MultiCiphertextOverhead(numSlots) {
+		return nil, errors.Wrapf(ErrCiphertextTooSmall, "%d < %d",
+			len(ciphertext), MultiCiphertextOverhead(numSlots))
+	}
+	slots := ciphertext[minSize : minSize+numSlots*multiSlotSize]
+	encryptedBody := ciphertext[minSize+numSlots*multiSlotSize:]
+
+	slotID := makeMultiSlotID(
+		MakeReceiverSihTag(senderPubKey, receiverPrivKey), nonce)
+	var wrapped []byte
+	for i := 0; i < numSlots; i++ {
+		slot := slots[i*multiSlotSize : (i+1)*multiSlotSize]
+		if hmac.Equal(slot[:multiSlotIDSize], slotID) {
+			wrapped = slot[multiSlotIDSize:]
+			break
+		}
+	}
+	if wrapped == nil {
+		return nil, ErrNoRecipientSlot
+	}
+
+	receiverNikePrivKey := ecdh.Edwards2EcdhNikePrivateKey(receiverPrivKey)
+	unwrapped, err := NoiseX.Decrypt(wrapped, receiverNikePrivKey)
+	if err != nil {
+		return nil, err
+	} else if len(unwrapped) != multiContentKeySize+bengerCodeSize {
+		return nil, errors.Errorf("invalid wrapped key size: %d",
+			len(unwrapped))
+	}
+	contentKey := unwrapped[:multiContentKeySize]
+	readBengerCode := unwrapped[multiContentKeySize:]
+
+	k, err := deriveSecret(receiverNikePrivKey,
+		ecdh.Edwards2EcdhNikePublicKey(senderPubKey))
+	if err != nil {
+		return nil, err
+	}
+	if !isValidBengerCode(readBengerCode, k,
+		makeMultiBodyDigest(nonce, encryptedBody)) {
+		return nil, errors.Errorf("[DM] failed benger mac check")
+	}
+
+	chaCipher, err := chacha20poly1305.NewX(contentKey)
+	panicOnChaChaFailure(err)
+	body, err := chaCipher.Open(nil, nonce, encryptedBody, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	msgSize := int(binary.BigEndian.Uint16(body))
+	if msgSize > len(body)-prologueSize {
+		return nil, errors.Wrapf(ErrInvalidLength, "%d > %d",
+			msgSize, len(body)-prologueSize)
+	}
+	return body[prologueSize : prologueSize+msgSize], nil
+}
+
+// makeMultiSlotID derives the ID of a recipient's slot from the SIH tag they
+// share with the sender and the message nonce.
+func makeMultiSlotID(sihTag string, nonce []byte) []byte {
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte(sihTag))
+	h.Write(nonce)
+	h.Write([]byte(multiSlotSalt))
+	return h.Sum(nil)[:multiSlotIDSize]
+}
+
+// makeMultiBodyDigest hashes the encrypted body for the benger codes.
+func makeMultiBodyDigest(nonce, encryptedBody []byte) []byte {
+	h, _ := blake2b.New256(nil)
+	h.Write(nonce)
+	h.Write(encryptedBody)
+	return h.Sum(nil)
+}
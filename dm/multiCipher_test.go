@@ -0,0 +1,143 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                           //
+//                                                                            //
+// Use of this source code is governed by a license that can be found         //
+// in the LICENSE file                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+package dm
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/crypto/csprng"
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+)
+
+func TestEncryptDecryptMulti(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	message := []byte("hello group")
+	maxPayloadSize := 2000
+
+	senderPubKey, senderPrivKey, err := ed25519.GenerateKey(rng)
+	require.NoError(t, err)
+	recipientPrivKeys := make([]ed25519.PrivateKey, 5)
+	recipients := make([]ed25519.PublicKey, len(recipientPrivKeys))
+	for i := range recipientPrivKeys {
+		recipients[i], recipientPrivKeys[i], err = ed25519.GenerateKey(rng)
+		require.NoError(t, err)
+	}
+
+	ciphertext, err := EncryptMulti(message, senderPrivKey, recipients, rng,
+		maxPayloadSize)
+	require.NoError(t, err)
+	require.Len(t, ciphertext, maxPayloadSize)
+
+	for i, recipientPrivKey := range recipientPrivKeys {
+		plaintext, err := DecryptMulti(ciphertext, recipientPrivKey,
+			senderPubKey)
+		require.NoError(t, err, "recipient %d", i)
+		require.Equal(t, message, plaintext)
+	}
+
+	// Someone who was not a recipient has no slot
+	_, outsiderPrivKey, err := ed25519.GenerateKey(rng)
+	require.NoError(t, err)
+	_, err = DecryptMulti(ciphertext, outsiderPrivKey, senderPubKey)
+	require.Equal(t, ErrNoRecipientSlot, err)
+
+	// Slot IDs change with every message
+	ciphertext2, err := EncryptMulti(message, senderPrivKey, recipients, rng,
+		maxPayloadSize)
+	require.NoError(t, err)
+	start := chacha20poly1305.NonceSizeX + multiCountSize
+	require.NotEqual(t, ciphertext[start:start+multiSlotIDSize],
+		ciphertext2[start:start+multiSlotIDSize])
+}
+
+func TestEncryptMulti_PlaintextTooLarge(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	_, senderPrivKey, err := ed25519.GenerateKey(rng)
+	require.NoError(t, err)
+	recipient, _, err := ed25519.GenerateKey(rng)
+	require.NoError(t, err)
+	recipients := []ed25519.PublicKey{recipient, recipient, recipient}
+
+	maxPayloadSize := 1000
+	plaintext := make(
+		[]byte, maxPayloadSize-MultiCiphertextOverhead(len(recipients))+1)
+	_, err = EncryptMulti(plaintext, senderPrivKey, recipients, rng,
+		maxPayloadSize)
+	require.True(t, errors.Is(err, ErrPlaintextTooLarge))
+
+	_, err = EncryptMulti(plaintext[:len(plaintext)-1], senderPrivKey,
+		recipients, rng, maxPayloadSize)
+	require.NoError(t, err)
+
+	_, err = EncryptMulti(nil, senderPrivKey, nil, rng, maxPayloadSize)
+	require.Error(t, err)
+}
+
+// Tests that a recipient, who knows the content key, cannot change the body
+// of a message and pass it on to another recipient.
+func TestDecryptMulti_ForgedBody(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	senderPubKey, senderPrivKey, err := ed25519.GenerateKey(rng)
+	require.NoError(t, err)
+	malloryPubKey, malloryPrivKey, err := ed25519.GenerateKey(rng)
+	require.NoError(t, err)
+	bobPubKey, bobPrivKey, err := ed25519.GenerateKey(rng)
+	require.NoError(t, err)
+
+	ciphertext, err := EncryptMulti([]byte("hello"), senderPrivKey,
+		[]ed25519.PublicKey{malloryPubKey, bobPubKey}, rng, 1000)
+	require.NoError(t, err)
+
+	// Mallory recovers the content key from their slot and re-encrypts a
+	// different body under it
+	slotsStart := chacha20poly1305.NonceSizeX + multiCountSize
+	nonce := ciphertext[:chacha20poly1305.NonceSizeX]
+	unwrapped, err := NoiseX.Decrypt(
+		ciphertext[slotsStart+multiSlotIDSize:slotsStart+multiSlotSize],
+		ecdh.Edwards2EcdhNikePrivateKey(malloryPrivKey))
+	require.NoError(t, err)
+	chaCipher, err := chacha20poly1305.NewX(unwrapped[:multiContentKeySize])
+	require.NoError(t, err)
+	bodyStart := slotsStart + 2*multiSlotSize
+	body, err := chaCipher.Open(nil, nonce, ciphertext[bodyStart:], nil)
+	require.NoError(t, err)
+	copy(body[prologueSize:], "pwned")
+	forged := append(ciphertext[:bodyStart:bodyStart],
+		chaCipher.Seal(nil, nonce, body, nil)...)
+
+	_, err = DecryptMulti(forged, bobPrivKey, senderPubKey)
+	require.Error(t, err)
+
+	plaintext, err := DecryptMulti(ciphertext, bobPrivKey, senderPubKey)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), plaintext)
+}
+
+func TestDecryptMulti_Truncated(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	senderPubKey, senderPrivKey, err := ed25519.GenerateKey(rng)
+	require.NoError(t, err)
+	bobPubKey, bobPrivKey, err := ed25519.GenerateKey(rng)
+	require.NoError(t, err)
+
+	ciphertext, err := EncryptMulti([]byte("hello"), senderPrivKey,
+		[]ed25519.PublicKey{bobPubKey}, rng, 1000)
+	require.NoError(t, err)
+
+	for _, size := range []int{0, chacha20poly1305.NonceSizeX + 1,
+		MultiCiphertextOverhead(1) - 1} {
+		_, err = DecryptMulti(ciphertext[:size], bobPrivKey, senderPubKey)
+		require.True(t, errors.Is(err, ErrCiphertextTooSmall),
+			"size %d: %+v", size, err)
+	}
+}
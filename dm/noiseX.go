@@ -10,6 +10,7 @@ package dm
 import (
 	"io"
 
+	"github.com/pkg/errors"
 	"gitlab.com/elixxir/crypto/nike"
 	"gitlab.com/elixxir/crypto/nike/ecdh"
 	"gitlab.com/yawning/nyquist.git"
@@ -57,8 +58,23 @@ func (s *noiseX) CiphertextOverhead() int {
 // generated private key (ecdhPrivate) and the static public key of
 // the user (partnerStaticPubKey). A cryptographically secure random
 // number generator is required to creat this key.
+//
+// Encrypt panics on failure; use the DMCipherV2 methods to get an error
+// instead.
 func (s *noiseX) Encrypt(plaintext []byte, partnerStaticPubKey nike.PublicKey,
 	rng io.Reader) []byte {
+	ciphertext, err := s.encrypt(plaintext, partnerStaticPubKey, rng)
+	panicOnError(err)
+	return ciphertext
+}
+
+// encrypt is the error returning implementation of Encrypt.
+func (s *noiseX) encrypt(plaintext []byte, partnerStaticPubKey nike.PublicKey,
+	rng io.Reader) ([]byte, error) {
+	if _, ok := partnerStaticPubKey.(*ecdh.PublicKey); !ok {
+		return nil, errors.Wrap(ErrInvalidKeyType, "public key")
+	}
+
 	// Per spec, the X pattern in Noise relies on an ephemeral key. We
 	// generate that here and prepend the public form to the message.
 	ecdhPrivate, ecdhPublic := ecdh.ECDHNIKE.NewKeypair(rng)
@@ -74,17 +90,25 @@ func (s *noiseX) Encrypt(plaintext []byte, partnerStaticPubKey nike.PublicKey,
 		IsInitiator:  true,
 	}
 	hs, err := nyquist.NewHandshake(cfg)
-	panicOnError(err)
+	if err != nil {
+		return nil, err
+	}
 	defer hs.Reset()
 	ciphertext, err := hs.WriteMessage(nil, plaintext)
-	panicOnNoiseError(hs, err)
-	return createNoisePayload(ciphertext, ecdhPublic)
+	if err = recoverErrorOnNoise(hs, err); err != nil {
+		return nil, err
+	}
+	return createNoisePayload(ciphertext, ecdhPublic), nil
 }
 
 // Decrypt decrypts the given ciphertext as a Noise X message.
 func (s *noiseX) Decrypt(ciphertext []byte, myStatic nike.PrivateKey) (
 	[]byte, error) {
 
+	if _, ok := myStatic.(*ecdh.PrivateKey); !ok {
+		return nil, errors.Wrap(ErrInvalidKeyType, "private key")
+	}
+
 	encrypted, partnerEphemeralPubKey, err := parseNoisePayload(ciphertext)
 	if err != nil {
 		return nil, err
@@ -119,6 +143,10 @@ func (s *noiseX) Decrypt(ciphertext []byte, myStatic nike.PrivateKey) (
 func parseNoisePayload(payload []byte) ([]byte, nike.PublicKey, error) {
 	// Extract the public key from the payload
 	publicKeySize := ecdh.ECDHNIKE.PublicKeySize()
+	if len(payload) < publicKeySize {
+		return nil, nil, errors.Wrapf(ErrCiphertextTooSmall,
+			"%d < %d", len(payload), publicKeySize)
+	}
 	publicKeyBytes := payload[:publicKeySize]
 	publicKey, err := ecdh.ECDHNIKE.
 		UnmarshalBinaryPublicKey(publicKeyBytes)
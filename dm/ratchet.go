@@ -0,0 +1,510 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                           //
+//                                                                            //
+// Use of this source code is governed by a license that can be found         //
+// in the LICENSE file                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+package dm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
+	"gitlab.com/elixxir/crypto/hash"
+	"gitlab.com/elixxir/crypto/nike"
+)
+
+const (
+	ratchetSeedSalt  = "dmRatchetSeedSalt"
+	ratchetRootInfo  = "dmRatchetRootInfo"
+	ratchetKeySize   = 32
+	ratchetCountSize = 4
+
+	// maxRatchetSkip is the largest number of message keys that may be
+	// skipped in a single receiving chain. A message further ahead than
+	// this is rejected.
+	maxRatchetSkip = 1000
+
+	// maxRatchetSkippedKeys is the largest number of skipped message keys
+	// stored across all chains. Once reached, the oldest keys are dropped
+	// and those messages can no longer be decrypted.
+	maxRatchetSkippedKeys = 2000
+)
+
+var (
+	// ErrRatchetTooManySkipped is returned when a message is further ahead
+	// of the receiving chain than maxRatchetSkip.
+	ErrRatchetTooManySkipped = errors.New(
+		"too many skipped messages in ratchet chain")
+
+	// ErrRatchetNoSendingChain is returned when the ratchet has no partner
+	// key to encrypt to because it was created by NewReceivingRatchet and
+	// has not received a message yet.
+	ErrRatchetNoSendingChain = errors.New(
+		"ratchet cannot send before receiving the first message")
+)
+
+// Ratchet is a Signal-style double ratchet between two DM partners. Every
+// message is encrypted with a fresh key from a symmetric chain, and the chains
+// are restarted from a new Diffie–Hellman exchange every time the direction of
+// the conversation changes. Ratchet private keys are reset once they are
+// replaced, so a compromise of the current ratchet state does not reveal
+// messages from chains before the last DH ratchet step, except those whose
+// skipped message keys are still held.
+//
+// Forward secrecy does not hold for the first messages of the conversation.
+// The receiver's static key acts as its first ratchet key, and the root key
+// comes from the secret between both static keys, so anyone who later learns
+// the receiver's static private key can decrypt every message sent before the
+// receiver's first reply.
+//
+// The ratchet is seeded the way a NoiseX message is authenticated: the root
+// key comes from the secret between both static keys (the ss token of the
+// Noise X pattern), and the first DH ratchet step, between the sender's fresh
+// ratchet key and the partner's static key, provides the es token.
+//
+// Messages are formatted as such:
+// Ratchet Public Key | Previous Chain Length | Message Number | Ciphertext
+//
+// A Ratchet is not safe for concurrent use.
+type Ratchet struct {
+	scheme nike.Nike
+
+	rootKey      []byte
+	sendChainKey []byte
+	recvChainKey []byte
+
+	myPrivKey     nike.PrivateKey
+	myPubKey      nike.PublicKey
+	partnerPubKey nike.PublicKey
+
+	// isStaticPrivKey is set while myPrivKey is the static key passed to
+	// NewReceivingRatchet, which belongs to the caller and so is not reset
+	// when it is replaced.
+	isStaticPrivKey bool
+
+	sendN, recvN, prevN uint32
+
+	// needSendRatchet is set when a new partner ratchet key is received.
+	// The sending chain is then restarted with a new ratchet key on the
+	// next call to Encrypt.
+	needSendRatchet bool
+
+	// associatedData binds every message to the static keys of both
+	// partners.
+	associatedData []byte
+
+	skipped      map[skippedKeyID][]byte
+	skippedOrder []skippedKeyID
+}
+
+// skippedKeyID identifies a skipped message key by the partner ratchet key of
+// its chain and its message number.
+type skippedKeyID struct {
+	pubKey string
+	n      uint32
+}
+
+// NewSendingRatchet creates the ratchet of the party sending the first
+// message of the conversation.
+func NewSendingRatchet(scheme nike.Nike, myStatic nike.PrivateKey,
+	partnerStaticPubKey nike.PublicKey, rng io.Reader) (*Ratchet, error) {
+	myStaticPubKey := scheme.DerivePublicKey(myStatic)
+	r, err := newRatchet(scheme, myStatic, partnerStaticPubKey,
+		myStaticPubKey, partnerStaticPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r.partnerPubKey = partnerStaticPubKey
+	r.needSendRatchet = true
+	if err = r.sendRatchet(rng); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewReceivingRatchet creates the ratchet of the party receiving the first
+// message of the conversation. It cannot encrypt until it has decrypted a
+// message from the partner.
+func NewReceivingRatchet(scheme nike.Nike, myStatic nike.PrivateKey,
+	partnerStaticPubKey nike.PublicKey) (*Ratchet, error) {
+	myStaticPubKey := scheme.DerivePublicKey(myStatic)
+	r, err := newRatchet(scheme, myStatic, partnerStaticPubKey,
+		partnerStaticPubKey, myStaticPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// The static key acts as the first ratchet key, so the sender's first
+	// DH ratchet step is against it
+	r.myPrivKey = myStatic
+	r.myPubKey = myStaticPubKey
+	r.isStaticPrivKey = true
+	return r, nil
+}
+
+func newRatchet(scheme nike.Nike, myStatic nike.PrivateKey,
+	partnerStaticPubKey, senderPubKey, receiverPubKey nike.PublicKey) (
+	*Ratchet, error) {
+	secret, err := deriveSecret(myStatic, partnerStaticPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hash.DefaultHash()
+	h.Write([]byte(ratchetSeedSalt))
+	h.Write(secret)
+	h.Write(senderPubKey.Bytes())
+	h.Write(receiverPubKey.Bytes())
+
+	ad := append(senderPubKey.Bytes(), receiverPubKey.Bytes()...)
+
+	return &Ratchet{
+		scheme:         scheme,
+		rootKey:        h.Sum(nil),
+		associatedData: ad,
+		skipped:        make(map[skippedKeyID][]byte),
+	}, nil
+}
+
+// Overhead returns the number of bytes added to every message.
+func (r *Ratchet) Overhead() int {
+	return r.headerSize() + chacha20poly1305.Overhead
+}
+
+// Encrypt encrypts the plaintext with the next key of the sending chain. The
+// rng is only used when the sending chain needs a new ratchet key.
+func (r *Ratchet) Encrypt(plaintext []byte, rng io.Reader) ([]byte, error) {
+	if r.partnerPubKey == nil {
+		return nil, ErrRatchetNoSendingChain
+	}
+	if err := r.sendRatchet(rng); err != nil {
+		return nil, err
+	}
+
+	var messageKey []byte
+	r.sendChainKey, messageKey = stepRatchetChain(r.sendChainKey)
+
+	header := make([]byte, r.headerSize())
+	copy(header, r.myPubKey.Bytes())
+	counts := header[r.scheme.PublicKeySize():]
+	binary.BigEndian.PutUint32(counts, r.prevN)
+	binary.BigEndian.PutUint32(counts[ratchetCountSize:], r.sendN)
+	r.sendN++
+
+	return r.seal(messageKey, header, plaintext), nil
+}
+
+// Decrypt decrypts a message from the partner. Messages may arrive out of
+// order; keys for skipped messages are kept until those messages arrive. The
+// ratchet is left unchanged if decryption fails.
+func (r *Ratchet) Decrypt(msg []byte) ([]byte, error) {
+	headerSize := r.headerSize()
+	if len(msg) < headerSize+chacha20poly1305.Overhead {
+		return nil, errors.Errorf("ratchet message too small: %d < %d",
+			len(msg), headerSize+chacha20poly1305.Overhead)
+	}
+
+	header := msg[:headerSize]
+	pubKeySize := r.scheme.PublicKeySize()
+	partnerPubKeyBytes := header[:pubKeySize]
+	prevN := binary.BigEndian.Uint32(header[pubKeySize:])
+	n := binary.BigEndian.Uint32(header[pubKeySize+ratchetCountSize:])
+
+	// Check if this is a message that was previously skipped
+	id := skippedKeyID{pubKey: string(partnerPubKeyBytes), n: n}
+	if messageKey, exists := r.skipped[id]; exists {
+		plaintext, err := r.open(messageKey, header, msg[headerSize:])
+		if err != nil {
+			return nil, err
+		}
+		r.deleteSkipped(id)
+		return plaintext, nil
+	}
+
+	// All changes are made to a copy so that a forged message cannot
+	// corrupt the ratchet
+	next := r.clone()
+	if next.partnerPubKey == nil ||
+		!bytes.Equal(partnerPubKeyBytes, next.partnerPubKey.Bytes()) {
+		if err := next.skipMessageKeys(prevN); err != nil {
+			return nil, err
+		}
+		partnerPubKey, err := r.scheme.UnmarshalBinaryPublicKey(
+			partnerPubKeyBytes)
+		if err != nil {
+			return nil, err
+		}
+		if err = next.receiveRatchet(partnerPubKey); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := next.skipMessageKeys(n); err != nil {
+		return nil, err
+	}
+	var messageKey []byte
+	next.recvChainKey, messageKey = stepRatchetChain(next.recvChainKey)
+	next.recvN++
+
+	plaintext, err := next.open(messageKey, header, msg[headerSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	*r = *next
+	return plaintext, nil
+}
+
+// sendRatchet restarts the sending chain with a new ratchet key if one was
+// requested by receiving a new partner ratchet key. The replaced ratchet key is
+// reset.
+func (r *Ratchet) sendRatchet(rng io.Reader) error {
+	if !r.needSendRatchet {
+		return nil
+	}
+
+	myPrivKey, myPubKey := r.scheme.NewKeypair(rng)
+	secret, err := deriveSecret(myPrivKey, r.partnerPubKey)
+	if err != nil {
+		return err
+	}
+
+	r.rootKey, r.sendChainKey = stepRatchetRoot(r.rootKey, secret)
+	if r.myPrivKey != nil && !r.isStaticPrivKey {
+		r.myPrivKey.Reset()
+	}
+	r.myPrivKey, r.myPubKey = myPrivKey, myPubKey
+	r.isStaticPrivKey = false
+	r.prevN, r.sendN = r.sendN, 0
+	r.needSendRatchet = false
+	return nil
+}
+
+// receiveRatchet restarts the receiving chain for a new partner ratchet key.
+func (r *Ratchet) receiveRatchet(partnerPubKey nike.PublicKey) error {
+	secret, err := deriveSecret(r.myPrivKey, partnerPubKey)
+	if err != nil {
+		return err
+	}
+
+	r.rootKey, r.recvChainKey = stepRatchetRoot(r.rootKey, secret)
+	r.partnerPubKey = partnerPubKey
+	r.recvN = 0
+	r.needSendRatchet = true
+	return nil
+}
+
+// skipMessageKeys stores the keys of the current receiving chain up to, but
+// not including, message number until.
+func (r *Ratchet) skipMessageKeys(until uint32) error {
+	if r.recvChainKey == nil || until <= r.recvN {
+		return nil
+	}
+	if until-r.recvN > maxRatchetSkip {
+		return errors.Wrapf(ErrRatchetTooManySkipped, "%d > %d",
+			until-r.recvN, maxRatchetSkip)
+	}
+
+	pubKey := string(r.partnerPubKey.Bytes())
+	for ; r.recvN < until; r.recvN++ {
+		var messageKey []byte
+		r.recvChainKey, messageKey = stepRatchetChain(r.recvChainKey)
+		id := skippedKeyID{pubKey: pubKey, n: r.recvN}
+		r.skipped[id] = messageKey
+		r.skippedOrder = append(r.skippedOrder, id)
+	}
+
+	// Drop the oldest keys once the window is full
+	for len(r.skippedOrder) > maxRatchetSkippedKeys {
+		delete(r.skipped, r.skippedOrder[0])
+		r.skippedOrder = r.skippedOrder[1:]
+	}
+	return nil
+}
+
+// deleteSkipped removes a used skipped message key.
+func (r *Ratchet) deleteSkipped(id skippedKeyID) {
+	delete(r.skipped, id)
+	for i := range r.skippedOrder {
+		if r.skippedOrder[i] == id {
+			r.skippedOrder = append(r.skippedOrder[:i:i],
+				r.skippedOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// clone returns a copy of the ratchet which can be changed without affecting
+// the original.
+func (r *Ratchet) clone() *Ratchet {
+	next := *r
+	next.skipped = make(map[skippedKeyID][]byte, len(r.skipped))
+	for id, key := range r.skipped {
+		next.skipped[id] = key
+	}
+	next.skippedOrder = append([]skippedKeyID(nil), r.skippedOrder...)
+	return &next
+}
+
+func (r *Ratchet) headerSize() int {
+	return r.scheme.PublicKeySize() + 2*ratchetCountSize
+}
+
+// seal encrypts the plaintext with the single-use message key. Because every
+// key encrypts one message, a zero nonce is used.
+func (r *Ratchet) seal(messageKey, header, plaintext []byte) []byte {
+	chaCipher, err := chacha20poly1305.New(messageKey)
+	panicOnChaChaFailure(err)
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return chaCipher.Seal(header, nonce, plaintext, r.messageAD(header))
+}
+
+func (r *Ratchet) open(messageKey, header, ciphertext []byte) ([]byte,
+	error) {
+	chaCipher, err := chacha20poly1305.New(messageKey)
+	panicOnChaChaFailure(err)
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return chaCipher.Open(nil, nonce, ciphertext, r.messageAD(header))
+}
+
+// messageAD returns the associated data authenticated with a message.
+func (r *Ratchet) messageAD(header []byte) []byte {
+	ad := make([]byte, 0, len(r.associatedData)+len(header))
+	ad = append(ad, r.associatedData...)
+	return append(ad, header...)
+}
+
+// stepRatchetRoot mixes a new DH secret into the root key, returning the new
+// root key and the key of the new chain.
+func stepRatchetRoot(rootKey, secret []byte) (newRootKey, chainKey []byte) {
+	hkdfReader := hkdf.New(hash.DefaultHash, secret, rootKey,
+		[]byte(ratchetRootInfo))
+	keys := make([]byte, 2*ratchetKeySize)
+	if _, err := io.ReadFull(hkdfReader, keys); err != nil {
+		jww.FATAL.Panicf("Failed to read key bytes: %+v", err)
+	}
+	return keys[:ratchetKeySize], keys[ratchetKeySize:]
+}
+
+// stepRatchetChain advances a symmetric chain, returning the next chain key
+// and the message key for the current step.
+func stepRatchetChain(chainKey []byte) (nextChainKey, messageKey []byte) {
+	mac := hmac.New(hash.DefaultHash, chainKey)
+	mac.Write([]byte{1})
+	messageKey = mac.Sum(nil)
+
+	mac.Reset()
+	mac.Write([]byte{2})
+	nextChainKey = mac.Sum(nil)
+	return nextChainKey, messageKey
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Serialization                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// ratchetDisk is the serializable form of a Ratchet.
+type ratchetDisk struct {
+	RootKey         []byte             `json:"rootKey"`
+	SendChainKey    []byte             `json:"sendChainKey,omitempty"`
+	RecvChainKey    []byte             `json:"recvChainKey,omitempty"`
+	MyPrivKey       []byte             `json:"myPrivKey"`
+	PartnerPubKey   []byte             `json:"partnerPubKey,omitempty"`
+	SendN           uint32             `json:"sendN"`
+	RecvN           uint32             `json:"recvN"`
+	PrevN           uint32             `json:"prevN"`
+	NeedSendRatchet bool               `json:"needSendRatchet"`
+	AssociatedData  []byte             `json:"associatedData"`
+	Skipped         []skippedKeyOnDisk `json:"skipped,omitempty"`
+}
+
+type skippedKeyOnDisk struct {
+	PubKey []byte `json:"pubKey"`
+	N      uint32 `json:"n"`
+	Key    []byte `json:"key"`
+}
+
+// Marshal serializes the ratchet state so that it can be stored. The result
+// contains secret key material and must be stored encrypted.
+func (r *Ratchet) Marshal() ([]byte, error) {
+	rd := ratchetDisk{
+		RootKey:         r.rootKey,
+		SendChainKey:    r.sendChainKey,
+		RecvChainKey:    r.recvChainKey,
+		MyPrivKey:       r.myPrivKey.Bytes(),
+		SendN:           r.sendN,
+		RecvN:           r.recvN,
+		PrevN:           r.prevN,
+		NeedSendRatchet: r.needSendRatchet,
+		AssociatedData:  r.associatedData,
+		Skipped:         make([]skippedKeyOnDisk, len(r.skippedOrder)),
+	}
+	if r.partnerPubKey != nil {
+		rd.PartnerPubKey = r.partnerPubKey.Bytes()
+	}
+	for i, id := range r.skippedOrder {
+		rd.Skipped[i] = skippedKeyOnDisk{
+			PubKey: []byte(id.pubKey),
+			N:      id.n,
+			Key:    r.skipped[id],
+		}
+	}
+
+	return json.Marshal(rd)
+}
+
+// UnmarshalRatchet deserializes a ratchet created by Ratchet.Marshal. The
+// scheme must be the one the ratchet was created with.
+func UnmarshalRatchet(scheme nike.Nike, data []byte) (*Ratchet, error) {
+	var rd ratchetDisk
+	if err := json.Unmarshal(data, &rd); err != nil {
+		return nil, err
+	}
+
+	myPrivKey, err := scheme.UnmarshalBinaryPrivateKey(rd.MyPrivKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal ratchet key")
+	}
+
+	r := &Ratchet{
+		scheme:          scheme,
+		rootKey:         rd.RootKey,
+		sendChainKey:    rd.SendChainKey,
+		recvChainKey:    rd.RecvChainKey,
+		myPrivKey:       myPrivKey,
+		myPubKey:        scheme.DerivePublicKey(myPrivKey),
+		sendN:           rd.SendN,
+		recvN:           rd.RecvN,
+		prevN:           rd.PrevN,
+		needSendRatchet: rd.NeedSendRatchet,
+		associatedData:  rd.AssociatedData,
+		skipped:         make(map[skippedKeyID][]byte, len(rd.Skipped)),
+		skippedOrder:    make([]skippedKeyID, len(rd.Skipped)),
+	}
+	if rd.PartnerPubKey != nil {
+		r.partnerPubKey, err = scheme.UnmarshalBinaryPublicKey(
+			rd.PartnerPubKey)
+		if err != nil {
+			return nil, errors.Wrap(err,
+				"failed to unmarshal partner ratchet key")
+		}
+	}
+	for i, sk := range rd.Skipped {
+		id := skippedKeyID{pubKey: string(sk.PubKey), n: sk.N}
+		r.skipped[id] = sk.Key
+		r.skippedOrder[i] = id
+	}
+
+	return r, nil
+}
@@ -0,0 +1,246 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                           //
+//                                                                            //
+// Use of this source code is governed by a license that can be found         //
+// in the LICENSE file                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+package dm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/crypto/csprng"
+
+	"gitlab.com/elixxir/crypto/nike/dh"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+)
+
+func newTestRatchets(t *testing.T) (alice, bob *Ratchet) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, alicePubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	bobPrivKey, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	alice, err := NewSendingRatchet(ecdh.ECDHNIKE, alicePrivKey, bobPubKey,
+		rng)
+	require.NoError(t, err)
+	bob, err = NewReceivingRatchet(ecdh.ECDHNIKE, bobPrivKey, alicePubKey)
+	require.NoError(t, err)
+	return alice, bob
+}
+
+// Tests a conversation where the direction changes several times.
+func TestRatchet(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alice, bob := newTestRatchets(t)
+
+	_, err := bob.Encrypt([]byte("too early"), rng)
+	require.Equal(t, ErrRatchetNoSendingChain, err)
+
+	sender, receiver := alice, bob
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 3; i++ {
+			plaintext := []byte(fmt.Sprintf("round %d message %d", round, i))
+			ciphertext, err := sender.Encrypt(plaintext, rng)
+			require.NoError(t, err)
+			require.Len(t, ciphertext, len(plaintext)+sender.Overhead())
+
+			received, err := receiver.Decrypt(ciphertext)
+			require.NoError(t, err)
+			require.Equal(t, plaintext, received)
+		}
+		sender, receiver = receiver, sender
+	}
+}
+
+// Tests that a ratchet private key is reset once it is replaced by a DH ratchet
+// step, and that the static key of the receiving ratchet is not.
+func TestRatchet_ResetsReplacedKey(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	bobPrivKey, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	alicePrivKey, alicePubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	alice, err := NewSendingRatchet(ecdh.ECDHNIKE, alicePrivKey, bobPubKey,
+		rng)
+	require.NoError(t, err)
+	bob, err := NewReceivingRatchet(ecdh.ECDHNIKE, bobPrivKey, alicePubKey)
+	require.NoError(t, err)
+	bobStatic := bobPrivKey.Bytes()
+
+	aliceFirstKey := alice.myPrivKey
+	aliceFirstKeyBytes := aliceFirstKey.Bytes()
+
+	ciphertext, err := alice.Encrypt([]byte("hello"), rng)
+	require.NoError(t, err)
+	_, err = bob.Decrypt(ciphertext)
+	require.NoError(t, err)
+	ciphertext, err = bob.Encrypt([]byte("hi"), rng)
+	require.NoError(t, err)
+	require.Equal(t, bobStatic, bobPrivKey.Bytes())
+
+	_, err = alice.Decrypt(ciphertext)
+	require.NoError(t, err)
+	_, err = alice.Encrypt([]byte("bye"), rng)
+	require.NoError(t, err)
+	require.NotEqual(t, aliceFirstKeyBytes, aliceFirstKey.Bytes())
+	require.Equal(t, make([]byte, len(aliceFirstKeyBytes)),
+		aliceFirstKey.Bytes())
+}
+
+// Tests that the DH ratchet works with a scheme other than ECDH.
+func TestRatchet_DHNIKE(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, alicePubKey := dh.DHNIKE.NewKeypair(rng)
+	bobPrivKey, bobPubKey := dh.DHNIKE.NewKeypair(rng)
+
+	alice, err := NewSendingRatchet(dh.DHNIKE, alicePrivKey, bobPubKey, rng)
+	require.NoError(t, err)
+	bob, err := NewReceivingRatchet(dh.DHNIKE, bobPrivKey, alicePubKey)
+	require.NoError(t, err)
+
+	ciphertext, err := alice.Encrypt([]byte("hello bob"), rng)
+	require.NoError(t, err)
+	received, err := bob.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello bob"), received)
+
+	ciphertext, err = bob.Encrypt([]byte("hello alice"), rng)
+	require.NoError(t, err)
+	received, err = alice.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello alice"), received)
+}
+
+// Tests that messages delivered out of order, including across DH ratchet
+// steps, are decrypted using the skipped message keys.
+func TestRatchet_Decrypt_OutOfOrder(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alice, bob := newTestRatchets(t)
+
+	var first [][]byte
+	for i := 0; i < 4; i++ {
+		ciphertext, err := alice.Encrypt([]byte(fmt.Sprintf("a%d", i)), rng)
+		require.NoError(t, err)
+		first = append(first, ciphertext)
+	}
+
+	// Bob receives only the last message, then replies
+	received, err := bob.Decrypt(first[3])
+	require.NoError(t, err)
+	require.Equal(t, []byte("a3"), received)
+	reply, err := bob.Encrypt([]byte("b0"), rng)
+	require.NoError(t, err)
+	_, err = alice.Decrypt(reply)
+	require.NoError(t, err)
+
+	// Alice starts a new chain, and its first message overtakes the rest
+	// of the old chain
+	second, err := alice.Encrypt([]byte("a4"), rng)
+	require.NoError(t, err)
+	received, err = bob.Decrypt(second)
+	require.NoError(t, err)
+	require.Equal(t, []byte("a4"), received)
+
+	for _, i := range []int{1, 0, 2} {
+		received, err = bob.Decrypt(first[i])
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("a%d", i)), received)
+	}
+
+	// Skipped keys are single use
+	_, err = bob.Decrypt(first[0])
+	require.Error(t, err)
+	require.Empty(t, bob.skipped)
+}
+
+func TestRatchet_Decrypt_TooManySkipped(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alice, bob := newTestRatchets(t)
+
+	for i := 0; i < maxRatchetSkip+1; i++ {
+		_, err := alice.Encrypt([]byte("dropped"), rng)
+		require.NoError(t, err)
+	}
+	ciphertext, err := alice.Encrypt([]byte("too far"), rng)
+	require.NoError(t, err)
+
+	_, err = bob.Decrypt(ciphertext)
+	require.True(t, errors.Is(err, ErrRatchetTooManySkipped))
+}
+
+// Tests that a failed decryption leaves the ratchet unchanged.
+func TestRatchet_Decrypt_Tampered(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alice, bob := newTestRatchets(t)
+
+	ciphertext, err := alice.Encrypt([]byte("hello"), rng)
+	require.NoError(t, err)
+
+	tampered := make([]byte, len(ciphertext))
+	copy(tampered, ciphertext)
+	tampered[len(tampered)-1] ^= 1
+	_, err = bob.Decrypt(tampered)
+	require.Error(t, err)
+	require.Nil(t, bob.partnerPubKey)
+
+	_, err = bob.Decrypt(ciphertext[:bob.Overhead()-1])
+	require.Error(t, err)
+
+	received, err := bob.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), received)
+}
+
+// Tests that a message cannot be decrypted by a ratchet seeded with the wrong
+// static keys.
+func TestRatchet_Decrypt_WrongPartner(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alice, _ := newTestRatchets(t)
+	malloryPrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	_, alicePubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	mallory, err := NewReceivingRatchet(ecdh.ECDHNIKE, malloryPrivKey,
+		alicePubKey)
+	require.NoError(t, err)
+
+	ciphertext, err := alice.Encrypt([]byte("hello"), rng)
+	require.NoError(t, err)
+	_, err = mallory.Decrypt(ciphertext)
+	require.Error(t, err)
+}
+
+// Tests that a ratchet restored with UnmarshalRatchet continues the
+// conversation, including skipped message keys.
+func TestRatchet_Marshal(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alice, bob := newTestRatchets(t)
+
+	skippedMsg, err := alice.Encrypt([]byte("skipped"), rng)
+	require.NoError(t, err)
+	ciphertext, err := alice.Encrypt([]byte("hello"), rng)
+	require.NoError(t, err)
+	_, err = bob.Decrypt(ciphertext)
+	require.NoError(t, err)
+
+	for _, r := range []**Ratchet{&alice, &bob} {
+		data, err := (*r).Marshal()
+		require.NoError(t, err)
+		*r, err = UnmarshalRatchet(ecdh.ECDHNIKE, data)
+		require.NoError(t, err)
+	}
+
+	received, err := bob.Decrypt(skippedMsg)
+	require.NoError(t, err)
+	require.Equal(t, []byte("skipped"), received)
+
+	ciphertext, err = bob.Encrypt([]byte("reply"), rng)
+	require.NoError(t, err)
+	received, err = alice.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, []byte("reply"), received)
+
+	_, err = UnmarshalRatchet(ecdh.ECDHNIKE, []byte("invalid"))
+	require.Error(t, err)
+}
@@ -10,6 +10,7 @@ package dm
 import (
 	"crypto/hmac"
 	"encoding/binary"
+	"math"
 
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -54,8 +55,11 @@ func (s *dmCipher) EncryptSelf(message []byte, myPrivateKey nike.PrivateKey,
 	maxPayloadSize int) ([]byte, error) {
 
 	if len(message)+selfOverhead > maxPayloadSize {
-		return nil, errors.Errorf("message too big: %d > %d",
+		return nil, errors.Wrapf(ErrPlaintextTooLarge, "%d > %d",
 			len(message)+selfOverhead, maxPayloadSize)
+	} else if len(message) > math.MaxUint16 {
+		return nil, errors.Wrapf(ErrPlaintextTooLarge, "%d > %d",
+			len(message), math.MaxUint16)
 	}
 
 	// sdm is the plaintext part of the packet, so it is the size
@@ -0,0 +1,408 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                           //
+//                                                                            //
+// Use of this source code is governed by a license that can be found         //
+// in the LICENSE file                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+package dm
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"gitlab.com/yawning/nyquist.git"
+
+	"gitlab.com/elixxir/crypto/nike"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+)
+
+const (
+	// sessionRekeyInterval is the number of messages sent in a single
+	// direction after which the transport key of that direction is
+	// rekeyed.
+	sessionRekeyInterval = 1024
+
+	// sessionNonceSize is the size of the message number prepended to
+	// every transport message.
+	sessionNonceSize = 8
+
+	// sessionTagSize is the size of the authentication tag added to every
+	// transport message.
+	sessionTagSize = 16
+)
+
+var (
+	// ErrSessionHandshakeIncomplete is returned when a transport message
+	// is encrypted or decrypted before the handshake has completed.
+	ErrSessionHandshakeIncomplete = errors.New(
+		"session handshake is not complete")
+
+	// ErrSessionHandshakeComplete is returned when a handshake message is
+	// written or read after the handshake has completed.
+	ErrSessionHandshakeComplete = errors.New(
+		"session handshake is already complete")
+
+	// ErrSessionHandshakeFailed is returned when a handshake message is
+	// written or read after an earlier handshake message failed.
+	ErrSessionHandshakeFailed = errors.New("session handshake failed")
+
+	// ErrSessionOutOfOrder is returned when a transport message is not the
+	// next message expected from the partner.
+	ErrSessionOutOfOrder = errors.New(
+		"session message received out of order")
+
+	// ErrSessionStaticKeyMismatch is returned when the static public key
+	// sent by the partner does not match the key used in the handshake.
+	ErrSessionStaticKeyMismatch = errors.New(
+		"partner static key does not match the handshake")
+)
+
+// SessionPattern is the Noise handshake pattern run by a Session.
+type SessionPattern uint8
+
+const (
+	// SessionIK is used when the initiator already knows the static public
+	// key of the responder. The handshake takes a single round trip and
+	// the payload of every handshake message is encrypted.
+	SessionIK SessionPattern = iota
+
+	// SessionXX is used when neither side knows the static public key of
+	// the other. The handshake takes three messages and the payload of the
+	// first message is sent in the clear.
+	SessionXX
+)
+
+// String returns the Noise name of the pattern. This function satisfies the
+// fmt.Stringer interface.
+func (p SessionPattern) String() string {
+	switch p {
+	case SessionIK:
+		return "IK"
+	case SessionXX:
+		return "XX"
+	default:
+		return "INVALID"
+	}
+}
+
+var (
+	sessionProtocols = map[SessionPattern]*nyquist.Protocol{}
+
+	// staticKeyMessages lists the index of the handshake message in which
+	// the initiator and the responder, respectively, send their static
+	// public key. A negative index means it is never sent.
+	staticKeyMessages = map[SessionPattern][2]int{
+		SessionIK: {0, -1},
+		SessionXX: {2, 1},
+	}
+)
+
+// A Session is an interactive alternative to the one-shot NoiseX cipher. Both
+// parties first exchange handshake messages (carried as DM payloads) using the
+// Noise IK or XX pattern. Once the handshake completes, each direction gets
+// its own transport cipher, so later messages are cheap to encrypt and are
+// protected by ephemeral keys which are rekeyed every sessionRekeyInterval
+// messages, giving forward secrecy for the rest of the conversation.
+//
+// Transport messages must be decrypted in the order in which they were
+// encrypted. Each one is prefixed with its message number so that a receiver
+// can detect reordered or lost messages without disturbing the session state.
+type Session struct {
+	pattern     SessionPattern
+	isInitiator bool
+
+	myStaticPubKey      nike.PublicKey
+	partnerStaticPubKey nike.PublicKey
+
+	// hs is the handshake state. It is nil once the handshake is
+	// complete or has failed.
+	hs       *nyquist.HandshakeState
+	msgIndex int
+	failed   bool
+
+	tx, rx           *nyquist.CipherState
+	txNonce, rxNonce uint64
+}
+
+// NewInitiatorSession starts a session as the party sending the first
+// handshake message. The partnerStaticPubKey is required for SessionIK and
+// must be nil for SessionXX.
+func NewInitiatorSession(pattern SessionPattern, myStatic nike.PrivateKey,
+	partnerStaticPubKey nike.PublicKey, rng io.Reader) (*Session, error) {
+	if pattern == SessionIK && partnerStaticPubKey == nil {
+		return nil, errors.New(
+			"IK sessions require the partner static public key")
+	} else if pattern == SessionXX && partnerStaticPubKey != nil {
+		return nil, errors.New(
+			"XX sessions cannot use the partner static public key")
+	}
+	return newSession(pattern, true, myStatic, partnerStaticPubKey, rng)
+}
+
+// NewResponderSession starts a session as the party receiving the first
+// handshake message.
+func NewResponderSession(pattern SessionPattern, myStatic nike.PrivateKey,
+	rng io.Reader) (*Session, error) {
+	return newSession(pattern, false, myStatic, nil, rng)
+}
+
+func newSession(pattern SessionPattern, isInitiator bool,
+	myStatic nike.PrivateKey, partnerStaticPubKey nike.PublicKey,
+	rng io.Reader) (*Session, error) {
+	protocol, exists := sessionProtocols[pattern]
+	if !exists {
+		return nil, errors.Errorf("unsupported session pattern %d", pattern)
+	}
+	if _, ok := myStatic.(*ecdh.PrivateKey); !ok {
+		return nil, errors.New("private key must be x25519 ECDH")
+	}
+
+	cfg := &nyquist.HandshakeConfig{
+		Protocol:    protocol,
+		Prologue:    version,
+		LocalStatic: privateToNyquist(myStatic),
+		Rng:         rng,
+		IsInitiator: isInitiator,
+	}
+	if partnerStaticPubKey != nil {
+		if _, ok := partnerStaticPubKey.(*ecdh.PublicKey); !ok {
+			return nil, errors.New("public key must be x25519 ECDH")
+		}
+		cfg.RemoteStatic = publicToNyquist(partnerStaticPubKey)
+	}
+
+	hs, err := nyquist.NewHandshake(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		pattern:             pattern,
+		isInitiator:         isInitiator,
+		myStaticPubKey:      ecdh.ECDHNIKE.DerivePublicKey(myStatic),
+		partnerStaticPubKey: partnerStaticPubKey,
+		hs:                  hs,
+	}, nil
+}
+
+// IsHandshakeComplete returns true once the session is ready to encrypt and
+// decrypt transport messages.
+func (s *Session) IsHandshakeComplete() bool {
+	return s.hs == nil && !s.failed
+}
+
+// PartnerStaticPubKey returns the static public key of the partner, or nil if
+// it has not yet been received.
+func (s *Session) PartnerStaticPubKey() nike.PublicKey {
+	return s.partnerStaticPubKey
+}
+
+// WriteHandshake returns the next handshake message carrying the given
+// payload. No message is returned if the handshake fails, including when it
+// completes with a static key that does not match the one sent by the partner.
+// A failed handshake cannot be continued and later handshake messages return
+// ErrSessionHandshakeFailed.
+func (s *Session) WriteHandshake(payload []byte) ([]byte, error) {
+	if err := s.checkHandshakeActive(); err != nil {
+		return nil, err
+	}
+
+	if s.msgIndex == s.staticKeyMessage(s.isInitiator) {
+		payload = append(s.myStaticPubKey.Bytes(), payload...)
+	}
+
+	msg, err := s.hs.WriteMessage(nil, payload)
+	err = recoverErrorOnNoise(s.hs, err)
+	if err != nil {
+		s.failHandshake()
+		return nil, err
+	}
+	s.msgIndex++
+
+	if err = s.checkHandshakeDone(); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ReadHandshake reads the next handshake message from the partner and
+// returns its payload. The Noise handshake state has moved on once the message
+// is read, so a failed handshake cannot be continued and later handshake
+// messages return ErrSessionHandshakeFailed.
+func (s *Session) ReadHandshake(msg []byte) ([]byte, error) {
+	if err := s.checkHandshakeActive(); err != nil {
+		return nil, err
+	}
+
+	payload, err := s.hs.ReadMessage(nil, msg)
+	err = recoverErrorOnNoise(s.hs, err)
+	if err != nil {
+		s.failHandshake()
+		return nil, err
+	}
+
+	if s.msgIndex == s.staticKeyMessage(!s.isInitiator) {
+		pubSize := ecdh.ECDHNIKE.PublicKeySize()
+		if len(payload) < pubSize {
+			s.failHandshake()
+			return nil, errors.Errorf(
+				"handshake payload too small for static key: %d < %d",
+				len(payload), pubSize)
+		}
+		s.partnerStaticPubKey, err = ecdh.ECDHNIKE.
+			UnmarshalBinaryPublicKey(payload[:pubSize])
+		if err != nil {
+			s.failHandshake()
+			return nil, err
+		}
+		payload = payload[pubSize:]
+	}
+	s.msgIndex++
+
+	if err = s.checkHandshakeDone(); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Encrypt encrypts the plaintext as the next transport message. The message
+// is formatted as such:
+// Message Number | Ciphertext
+func (s *Session) Encrypt(plaintext []byte) ([]byte, error) {
+	if s.tx == nil {
+		return nil, ErrSessionHandshakeIncomplete
+	}
+
+	msg := make([]byte, sessionNonceSize,
+		sessionNonceSize+len(plaintext)+sessionTagSize)
+	binary.BigEndian.PutUint64(msg, s.txNonce)
+	msg, err := s.tx.EncryptWithAd(msg, nil, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	s.txNonce++
+	if s.txNonce%sessionRekeyInterval == 0 {
+		if err = s.tx.Rekey(); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// Decrypt decrypts the next transport message from the partner. Returns
+// ErrSessionOutOfOrder, without changing the session, if the message is not
+// the next one expected.
+func (s *Session) Decrypt(msg []byte) ([]byte, error) {
+	if s.rx == nil {
+		return nil, ErrSessionHandshakeIncomplete
+	}
+	if len(msg) < sessionNonceSize+sessionTagSize {
+		return nil, errors.Errorf("session message too small: %d < %d",
+			len(msg), sessionNonceSize+sessionTagSize)
+	}
+
+	nonce := binary.BigEndian.Uint64(msg[:sessionNonceSize])
+	if nonce != s.rxNonce {
+		return nil, errors.Wrapf(ErrSessionOutOfOrder,
+			"received message %d, expected %d", nonce, s.rxNonce)
+	}
+
+	plaintext, err := s.rx.DecryptWithAd(nil, nil, msg[sessionNonceSize:])
+	if err != nil {
+		// A failed decryption does not consume the nonce
+		s.rx.SetNonce(s.rxNonce)
+		return nil, err
+	}
+
+	s.rxNonce++
+	if s.rxNonce%sessionRekeyInterval == 0 {
+		if err = s.rx.Rekey(); err != nil {
+			return nil, err
+		}
+	}
+	return plaintext, nil
+}
+
+// Reset clears all key material held by the session.
+func (s *Session) Reset() {
+	if s.hs != nil {
+		s.hs.Reset()
+		s.hs = nil
+	}
+	if s.tx != nil {
+		s.tx.Reset()
+		s.tx = nil
+	}
+	if s.rx != nil {
+		s.rx.Reset()
+		s.rx = nil
+	}
+}
+
+// checkHandshakeActive returns an error if the handshake has completed or
+// failed.
+func (s *Session) checkHandshakeActive() error {
+	if s.failed {
+		return ErrSessionHandshakeFailed
+	} else if s.hs == nil {
+		return ErrSessionHandshakeComplete
+	}
+	return nil
+}
+
+// failHandshake ends the handshake after an error, clearing its key material,
+// so that the session refuses further handshake messages.
+func (s *Session) failHandshake() {
+	s.Reset()
+	s.failed = true
+}
+
+// staticKeyMessage returns the index of the handshake message in which the
+// initiator or responder sends its static public key.
+func (s *Session) staticKeyMessage(initiator bool) int {
+	if initiator {
+		return staticKeyMessages[s.pattern][0]
+	}
+	return staticKeyMessages[s.pattern][1]
+}
+
+// checkHandshakeDone sets up the transport ciphers if the last handshake
+// message has been processed, checking that the static key sent in the
+// payload is the one the partner authenticated with.
+func (s *Session) checkHandshakeDone() error {
+	status := s.hs.GetStatus()
+	if status.Err != nyquist.ErrDone {
+		return nil
+	}
+
+	partnerKey := s.partnerStaticPubKey.(*ecdh.PublicKey).MontgomeryBytes()
+	if status.RemoteStatic == nil ||
+		!hmac.Equal(partnerKey, status.RemoteStatic.Bytes()) {
+		s.failHandshake()
+		return ErrSessionStaticKeyMismatch
+	}
+
+	if s.isInitiator {
+		s.tx, s.rx = status.CipherStates[0], status.CipherStates[1]
+	} else {
+		s.tx, s.rx = status.CipherStates[1], status.CipherStates[0]
+	}
+	s.hs.Reset()
+	s.hs = nil
+	return nil
+}
+
+func init() {
+	for pattern, name := range map[SessionPattern]string{
+		SessionIK: "Noise_IK_25519_ChaChaPoly_BLAKE2s",
+		SessionXX: "Noise_XX_25519_ChaChaPoly_BLAKE2s",
+	} {
+		p, err := nyquist.NewProtocol(name)
+		panicOnError(err)
+		sessionProtocols[pattern] = p
+	}
+}
@@ -0,0 +1,253 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                           //
+//                                                                            //
+// Use of this source code is governed by a license that can be found         //
+// in the LICENSE file                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+package dm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/crypto/csprng"
+
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+)
+
+// newTestSessions runs the full handshake for the pattern and returns the
+// initiator and responder sessions.
+func newTestSessions(t *testing.T, pattern SessionPattern) (
+	alice, bob *Session) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, alicePubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	bobPrivKey, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	var err error
+	if pattern == SessionIK {
+		alice, err = NewInitiatorSession(pattern, alicePrivKey, bobPubKey, rng)
+	} else {
+		alice, err = NewInitiatorSession(pattern, alicePrivKey, nil, rng)
+	}
+	require.NoError(t, err)
+	bob, err = NewResponderSession(pattern, bobPrivKey, rng)
+	require.NoError(t, err)
+
+	// Alternate writing and reading handshake messages until both sides are
+	// done
+	writer, reader := alice, bob
+	for i := 0; !alice.IsHandshakeComplete() || !bob.IsHandshakeComplete(); i++ {
+		payload := []byte(fmt.Sprintf("handshake payload %d", i))
+		msg, err := writer.WriteHandshake(payload)
+		require.NoError(t, err)
+		received, err := reader.ReadHandshake(msg)
+		require.NoError(t, err)
+		require.Equal(t, payload, received)
+		writer, reader = reader, writer
+	}
+
+	require.Equal(t, alicePubKey.Bytes(), bob.PartnerStaticPubKey().Bytes())
+	require.Equal(t, bobPubKey.Bytes(), alice.PartnerStaticPubKey().Bytes())
+	return alice, bob
+}
+
+func TestSession(t *testing.T) {
+	for _, pattern := range []SessionPattern{SessionIK, SessionXX} {
+		alice, bob := newTestSessions(t, pattern)
+
+		for i := 0; i < 10; i++ {
+			plaintext := []byte(fmt.Sprintf("%s message %d", pattern, i))
+			ciphertext, err := alice.Encrypt(plaintext)
+			require.NoError(t, err)
+			received, err := bob.Decrypt(ciphertext)
+			require.NoError(t, err)
+			require.Equal(t, plaintext, received)
+
+			ciphertext, err = bob.Encrypt(plaintext)
+			require.NoError(t, err)
+			received, err = alice.Decrypt(ciphertext)
+			require.NoError(t, err)
+			require.Equal(t, plaintext, received)
+		}
+
+		_, err := alice.WriteHandshake(nil)
+		require.Equal(t, ErrSessionHandshakeComplete, err)
+		_, err = bob.ReadHandshake(nil)
+		require.Equal(t, ErrSessionHandshakeComplete, err)
+	}
+}
+
+// Tests that messages keep decrypting across rekeys.
+func TestSession_Rekey(t *testing.T) {
+	alice, bob := newTestSessions(t, SessionIK)
+
+	var ciphertexts [][]byte
+	for i := 0; i < 2*sessionRekeyInterval+1; i++ {
+		ciphertext, err := alice.Encrypt([]byte("message"))
+		require.NoError(t, err)
+		ciphertexts = append(ciphertexts, ciphertext)
+	}
+
+	for i, ciphertext := range ciphertexts {
+		_, err := bob.Decrypt(ciphertext)
+		require.NoError(t, err, "message %d", i)
+	}
+}
+
+func TestSession_Decrypt_OutOfOrder(t *testing.T) {
+	alice, bob := newTestSessions(t, SessionXX)
+
+	first, err := alice.Encrypt([]byte("first"))
+	require.NoError(t, err)
+	second, err := alice.Encrypt([]byte("second"))
+	require.NoError(t, err)
+
+	_, err = bob.Decrypt(second)
+	require.True(t, errors.Is(err, ErrSessionOutOfOrder))
+
+	// The rejected message must not have changed the session
+	received, err := bob.Decrypt(first)
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), received)
+
+	_, err = bob.Decrypt(first)
+	require.True(t, errors.Is(err, ErrSessionOutOfOrder))
+
+	received, err = bob.Decrypt(second)
+	require.NoError(t, err)
+	require.Equal(t, []byte("second"), received)
+}
+
+func TestSession_Decrypt_Tampered(t *testing.T) {
+	alice, bob := newTestSessions(t, SessionIK)
+
+	ciphertext, err := alice.Encrypt([]byte("hello"))
+	require.NoError(t, err)
+
+	tampered := make([]byte, len(ciphertext))
+	copy(tampered, ciphertext)
+	tampered[len(tampered)-1] ^= 1
+	_, err = bob.Decrypt(tampered)
+	require.Error(t, err)
+
+	_, err = bob.Decrypt(ciphertext[:sessionNonceSize])
+	require.Error(t, err)
+
+	// The genuine message still decrypts after the failures
+	received, err := bob.Decrypt(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), received)
+}
+
+func TestSession_HandshakeIncomplete(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	alice, err := NewInitiatorSession(SessionXX, alicePrivKey, nil, rng)
+	require.NoError(t, err)
+
+	_, err = alice.Encrypt([]byte("too early"))
+	require.Equal(t, ErrSessionHandshakeIncomplete, err)
+	_, err = alice.Decrypt(make([]byte, 64))
+	require.Equal(t, ErrSessionHandshakeIncomplete, err)
+}
+
+// Tests that an IK handshake fails when the initiator expects a different
+// responder.
+func TestSession_WrongResponder(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	bobPrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	_, malloryPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	alice, err := NewInitiatorSession(SessionIK, alicePrivKey, malloryPubKey,
+		rng)
+	require.NoError(t, err)
+	bob, err := NewResponderSession(SessionIK, bobPrivKey, rng)
+	require.NoError(t, err)
+
+	msg, err := alice.WriteHandshake([]byte("hello"))
+	require.NoError(t, err)
+	_, err = bob.ReadHandshake(msg)
+	require.Error(t, err)
+}
+
+// Error path: tests that WriteHandshake returns no message when the handshake
+// completes with a partner static key that does not match the one in the
+// payload.
+func TestSession_WriteHandshake_StaticKeyMismatch(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	bobPrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	_, malloryPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	alice, err := NewInitiatorSession(SessionXX, alicePrivKey, nil, rng)
+	require.NoError(t, err)
+	bob, err := NewResponderSession(SessionXX, bobPrivKey, rng)
+	require.NoError(t, err)
+
+	// Bob claims another static key in the payload of his handshake message
+	bob.myStaticPubKey = malloryPubKey
+
+	msg, err := alice.WriteHandshake(nil)
+	require.NoError(t, err)
+	_, err = bob.ReadHandshake(msg)
+	require.NoError(t, err)
+	msg, err = bob.WriteHandshake(nil)
+	require.NoError(t, err)
+	_, err = alice.ReadHandshake(msg)
+	require.NoError(t, err)
+
+	msg, err = alice.WriteHandshake([]byte("hello"))
+	require.Equal(t, ErrSessionStaticKeyMismatch, err)
+	require.Nil(t, msg)
+	require.False(t, alice.IsHandshakeComplete())
+	_, err = alice.WriteHandshake([]byte("hello"))
+	require.Equal(t, ErrSessionHandshakeFailed, err)
+}
+
+// Error path: tests that ReadHandshake ends the handshake when the payload is
+// too short to hold the partner static key, after the Noise handshake state
+// has already read the message, so that further handshake messages are
+// refused.
+func TestSession_ReadHandshake_ShortStaticKey(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivKey, _ := ecdh.ECDHNIKE.NewKeypair(rng)
+	bobPrivKey, bobPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	alice, err := NewInitiatorSession(SessionIK, alicePrivKey, bobPubKey, rng)
+	require.NoError(t, err)
+	bob, err := NewResponderSession(SessionIK, bobPrivKey, rng)
+	require.NoError(t, err)
+
+	// Alice sends her first message without her static key in the payload
+	alice.msgIndex = 1
+	msg, err := alice.WriteHandshake([]byte("short"))
+	require.NoError(t, err)
+
+	_, err = bob.ReadHandshake(msg)
+	require.Error(t, err)
+	require.False(t, bob.IsHandshakeComplete())
+
+	_, err = bob.ReadHandshake(msg)
+	require.Equal(t, ErrSessionHandshakeFailed, err)
+	_, err = bob.WriteHandshake(nil)
+	require.Equal(t, ErrSessionHandshakeFailed, err)
+	_, err = bob.Encrypt([]byte("hello"))
+	require.Equal(t, ErrSessionHandshakeIncomplete, err)
+}
+
+func TestNewInitiatorSession_Errors(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	privKey, pubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+
+	_, err := NewInitiatorSession(SessionIK, privKey, nil, rng)
+	require.Error(t, err)
+	_, err = NewInitiatorSession(SessionXX, privKey, pubKey, rng)
+	require.Error(t, err)
+	_, err = NewInitiatorSession(SessionPattern(99), privKey, nil, rng)
+	require.Error(t, err)
+}
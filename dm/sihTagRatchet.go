@@ -0,0 +1,229 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                           //
+//                                                                            //
+// Use of this source code is governed by a license that can be found         //
+// in the LICENSE file                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+package dm
+
+// The tags made by MakeSenderSihTag and MakeReceiverSihTag are the same for
+// every message between two partners, so anyone who can see the tag lists of
+// many messages can link them together. A tag ratchet instead derives a new
+// tag for every message from the message counter. Only the two partners can
+// compute the tags, and tags for different counters look unrelated.
+//
+// Because the receiver does not know which counter the next message will use,
+// a SihTagEvaluator keeps the tags of a window of upcoming counters, which can
+// be passed to sih.EvaluateCompressedSIH, and slides the window forward as
+// messages arrive. Messages may arrive out of order within the window, and a
+// message that is lost for good does not stall the window: counters too far
+// behind the highest received counter are dropped as lost. Because
+// the SIH is a bloom filter, a message can match more than one tag of the
+// window, in which case the receiver must resolve which counter it is for.
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"sort"
+
+	"gitlab.com/xx_network/primitives/id"
+	"golang.org/x/crypto/blake2b"
+
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+	"gitlab.com/elixxir/crypto/sih"
+)
+
+const sihTagRatchetSalt = "sihTagRatchetSalt"
+
+// SihTagRatchet derives the per-message SIH tags for messages sent in one
+// direction between two partners.
+type SihTagRatchet struct {
+	key []byte
+}
+
+// NewSenderSihTagRatchet creates the tag ratchet for messages sent to the
+// partner. It matches the ratchet the partner creates with
+// NewReceiverSihTagRatchet.
+func NewSenderSihTagRatchet(themPub ed25519.PublicKey,
+	mePriv ed25519.PrivateKey) *SihTagRatchet {
+	return newSihTagRatchet(themPub, mePriv, themPub)
+}
+
+// NewReceiverSihTagRatchet creates the tag ratchet for messages received from
+// the partner.
+func NewReceiverSihTagRatchet(themPub ed25519.PublicKey,
+	mePriv ed25519.PrivateKey) *SihTagRatchet {
+	return newSihTagRatchet(themPub, mePriv, mePriv.Public().(ed25519.PublicKey))
+}
+
+func newSihTagRatchet(dhPub ed25519.PublicKey, dhPriv ed25519.PrivateKey,
+	receiverPub ed25519.PublicKey) *SihTagRatchet {
+	themECDH := ecdh.Edwards2EcdhNikePublicKey(dhPub)
+	meECDH := ecdh.Edwards2EcdhNikePrivateKey(dhPriv)
+
+	dhKey := meECDH.DeriveSecret(themECDH)
+
+	h, _ := blake2b.New256(nil)
+	h.Write(dhKey)
+	h.Write(receiverPub)
+	h.Write([]byte(sihTagRatchetSalt))
+	return &SihTagRatchet{key: h.Sum(nil)}
+}
+
+// Tag returns the SIH tag of the message with the given counter.
+func (r *SihTagRatchet) Tag(counter uint64) string {
+	h, _ := blake2b.New256(r.key)
+	counterBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(counterBytes, counter)
+	h.Write(counterBytes)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// SihTagEvaluator matches received SIH tags against a window of upcoming
+// counters of a SihTagRatchet.
+//
+// The window holds the lookahead counters after the highest received counter
+// and the counters before it that have not been received. A counter lookahead
+// or more behind the highest received counter is assumed to be lost and is
+// dropped from the window, so the window never holds more than 2*lookahead
+// counters.
+//
+// A SihTagEvaluator is not safe for concurrent use.
+type SihTagEvaluator struct {
+	ratchet   *SihTagRatchet
+	lookahead uint64
+
+	// next is the lowest counter in the window and end is one past the
+	// highest counter in the window.
+	next, end uint64
+
+	// window maps the tags of the counters in the window to their
+	// counter. received holds counters in the window that have already
+	// been received.
+	window   map[string]uint64
+	received map[uint64]struct{}
+}
+
+// NewSihTagEvaluator creates an evaluator for the tags from counter next up to,
+// but not including, next+lookahead.
+func NewSihTagEvaluator(ratchet *SihTagRatchet, next,
+	lookahead uint64) *SihTagEvaluator {
+	e := &SihTagEvaluator{
+		ratchet:   ratchet,
+		lookahead: lookahead,
+		next:      next,
+		end:       next + lookahead,
+		window:    make(map[string]uint64, lookahead),
+		received:  make(map[uint64]struct{}),
+	}
+	for counter := next; counter < next+lookahead; counter++ {
+		e.window[ratchet.Tag(counter)] = counter
+	}
+	return e
+}
+
+// Next returns the lowest counter that has not yet been received and has not
+// been dropped as lost. It can be stored to recreate the evaluator with
+// NewSihTagEvaluator.
+func (e *SihTagEvaluator) Next() uint64 {
+	return e.next
+}
+
+// Tags returns the tags of the counters in the window that have not yet been
+// received, in no particular order. They are meant to be passed as the tags
+// of sih.EvaluateCompressedSIH.
+func (e *SihTagEvaluator) Tags() []string {
+	tags := make([]string, 0, len(e.window))
+	for tag, counter := range e.window {
+		if _, exists := e.received[counter]; !exists {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Match looks for the tags of the window in the matched tags returned by
+// sih.EvaluateCompressedSIH and returns the counters of every tag found, in
+// ascending order.
+//
+// If exactly one tag is found, its counter is marked as received and the
+// window is moved forward if possible. If more than one is found, which happens
+// when the bloom filter of the SIH gives a false positive, none are marked as
+// received, since marking the wrong one would reject the real message. The
+// caller must work out which counter the message is for, such as by decrypting
+// it, and mark it with MarkReceived.
+func (e *SihTagEvaluator) Match(matchedTags map[string]struct{}) []uint64 {
+	var counters []uint64
+	for tag := range matchedTags {
+		counter, exists := e.window[tag]
+		if !exists {
+			continue
+		}
+		if _, exists = e.received[counter]; exists {
+			continue
+		}
+		counters = append(counters, counter)
+	}
+
+	if len(counters) == 1 {
+		e.MarkReceived(counters[0])
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return counters[i] < counters[j]
+	})
+	return counters
+}
+
+// MarkReceived marks the counter as received and moves the window forward if
+// possible. It is used to resolve a Match that returned more than one counter.
+// Returns false if the counter is not in the window or was already received.
+func (e *SihTagEvaluator) MarkReceived(counter uint64) bool {
+	if counter < e.next || counter >= e.end {
+		return false
+	} else if _, exists := e.received[counter]; exists {
+		return false
+	}
+
+	e.received[counter] = struct{}{}
+	e.advance(counter)
+	return true
+}
+
+// Evaluate calls sih.EvaluateCompressedSIH with the tags of the window and
+// matches the result with Match. The counters of the matched tags are returned
+// along with the metadata of the SIH.
+func (e *SihTagEvaluator) Evaluate(pickup *id.ID, msgHash, identifier,
+	compressedSIH []byte) (counters []uint64, metadata []byte, err error) {
+	matchedTags, metadata, identifierFound, err := sih.EvaluateCompressedSIH(
+		pickup, msgHash, identifier, e.Tags(), compressedSIH)
+	if err != nil || !identifierFound {
+		return nil, nil, err
+	}
+
+	counters = e.Match(matchedTags)
+	if len(counters) == 0 {
+		return nil, nil, nil
+	}
+	return counters, metadata, nil
+}
+
+// advance extends the window to lookahead counters past the received counter
+// and slides it past every counter that has either been received in order or
+// is lookahead or more behind the received counter.
+func (e *SihTagEvaluator) advance(received uint64) {
+	for ; e.end <= received+e.lookahead; e.end++ {
+		e.window[e.ratchet.Tag(e.end)] = e.end
+	}
+
+	for {
+		_, exists := e.received[e.next]
+		if !exists && e.next+e.lookahead > received {
+			return
+		}
+		delete(e.received, e.next)
+		delete(e.window, e.ratchet.Tag(e.next))
+		e.next++
+	}
+}
@@ -0,0 +1,183 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                           //
+//                                                                            //
+// Use of this source code is governed by a license that can be found         //
+// in the LICENSE file                                                        //
+////////////////////////////////////////////////////////////////////////////////
+
+package dm
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/primitives/id"
+
+	"gitlab.com/elixxir/crypto/sih"
+)
+
+func TestSihTagRatchet_Consistency(t *testing.T) {
+	expected := []string{
+		"6TopMxi3/EcPEL6DCoTNWBxApbxqQVHLREB0oOnnnGk=",
+		"d81Dsy84OJR4qXBaXuxaui+31/Q7zxvnrQEo/KpznPM=",
+		"d1ORcrugBdDWLAqWNw4Hxt9mNOzZfmI9GgEPMaNhpmc=",
+	}
+
+	rng := rand.New(rand.NewSource(42))
+	_, mePriv, _ := ed25519.GenerateKey(rng)
+	themPub, _, _ := ed25519.GenerateKey(rng)
+	r := NewSenderSihTagRatchet(themPub, mePriv)
+
+	for i, exp := range expected {
+		tag := r.Tag(uint64(i))
+		if tag != exp {
+			t.Errorf("Unexpected tag %d.\nexpected: %q\nreceived: %q",
+				i, exp, tag)
+		}
+	}
+}
+
+// Tests that the sender and receiver ratchets agree, that tags change with
+// the counter and that the direction matters.
+func TestSihTagRatchet_Tag(t *testing.T) {
+	rng := rand.New(rand.NewSource(2367))
+	alicePub, alicePriv, _ := ed25519.GenerateKey(rng)
+	bobPub, bobPriv, _ := ed25519.GenerateKey(rng)
+
+	toBob := NewSenderSihTagRatchet(bobPub, alicePriv)
+	fromAlice := NewReceiverSihTagRatchet(alicePub, bobPriv)
+	toAlice := NewSenderSihTagRatchet(alicePub, bobPriv)
+
+	seen := make(map[string]struct{})
+	for counter := uint64(0); counter < 100; counter++ {
+		tag := toBob.Tag(counter)
+		require.Equal(t, tag, fromAlice.Tag(counter))
+		require.NotEqual(t, tag, toAlice.Tag(counter))
+		require.NotEqual(t, tag, MakeSenderSihTag(bobPub, alicePriv))
+
+		require.NotContains(t, seen, tag)
+		seen[tag] = struct{}{}
+	}
+}
+
+// Tests that the evaluator finds messages sent out of order within the window
+// through sih.EvaluateCompressedSIH and slides the window forward.
+func TestSihTagEvaluator_Evaluate(t *testing.T) {
+	rng := rand.New(rand.NewSource(8765))
+	alicePub, alicePriv, _ := ed25519.GenerateKey(rng)
+	bobPub, bobPriv, _ := ed25519.GenerateKey(rng)
+
+	sender := NewSenderSihTagRatchet(bobPub, alicePriv)
+	evaluator := NewSihTagEvaluator(
+		NewReceiverSihTagRatchet(alicePub, bobPriv), 0, 4)
+	require.Len(t, evaluator.Tags(), 4)
+
+	pickup := &id.DummyUser
+	identifier := []byte("identifier")
+	for _, counter := range []uint64{1, 0, 3, 2, 4, 5} {
+		msgHash := []byte(fmt.Sprintf("%32d", counter))
+		compressedSIH, err := sih.MakeCompressedSIH(pickup, msgHash,
+			identifier, []string{sender.Tag(counter)}, []byte{1, 2})
+		require.NoError(t, err)
+
+		received, metadata, err := evaluator.Evaluate(pickup, msgHash,
+			identifier, compressedSIH)
+		require.NoError(t, err)
+		require.Equal(t, []uint64{counter}, received, "counter %d", counter)
+		require.Equal(t, []byte{1, 2}, metadata)
+
+		// The same message is not matched twice
+		received, _, err = evaluator.Evaluate(pickup, msgHash, identifier,
+			compressedSIH)
+		require.NoError(t, err)
+		require.Empty(t, received)
+	}
+	require.Equal(t, uint64(6), evaluator.Next())
+	require.Len(t, evaluator.Tags(), 4)
+}
+
+// Tests that a counter past the lookahead window is not matched until the
+// window reaches it.
+func TestSihTagEvaluator_Match_Window(t *testing.T) {
+	rng := rand.New(rand.NewSource(1234))
+	alicePub, alicePriv, _ := ed25519.GenerateKey(rng)
+	bobPub, bobPriv, _ := ed25519.GenerateKey(rng)
+
+	sender := NewSenderSihTagRatchet(bobPub, alicePriv)
+	evaluator := NewSihTagEvaluator(
+		NewReceiverSihTagRatchet(alicePub, bobPriv), 10, 2)
+
+	matched := func(counter uint64) map[string]struct{} {
+		return map[string]struct{}{sender.Tag(counter): {}}
+	}
+
+	require.Empty(t, evaluator.Match(matched(12)))
+	require.Empty(t, evaluator.Match(matched(9)))
+
+	require.Equal(t, []uint64{10}, evaluator.Match(matched(10)))
+	require.Equal(t, []uint64{12}, evaluator.Match(matched(12)))
+	require.Equal(t, uint64(11), evaluator.Next())
+}
+
+// Tests that when two tags of the window match, both counters are returned and
+// neither is marked as received until the caller resolves the match with
+// MarkReceived.
+func TestSihTagEvaluator_Match_Ambiguous(t *testing.T) {
+	rng := rand.New(rand.NewSource(5678))
+	alicePub, alicePriv, _ := ed25519.GenerateKey(rng)
+	bobPub, bobPriv, _ := ed25519.GenerateKey(rng)
+
+	sender := NewSenderSihTagRatchet(bobPub, alicePriv)
+	evaluator := NewSihTagEvaluator(
+		NewReceiverSihTagRatchet(alicePub, bobPriv), 0, 4)
+
+	// Both counters 0 and 2 match, as when the bloom filter of the SIH gives a
+	// false positive
+	matched := map[string]struct{}{sender.Tag(0): {}, sender.Tag(2): {}}
+	require.Equal(t, []uint64{0, 2}, evaluator.Match(matched))
+	require.Equal(t, uint64(0), evaluator.Next())
+	require.Len(t, evaluator.Tags(), 4)
+
+	// Resolving the match marks only the real counter and extends the window
+	// to lookahead counters past it
+	require.True(t, evaluator.MarkReceived(2))
+	require.False(t, evaluator.MarkReceived(2))
+	require.False(t, evaluator.MarkReceived(7))
+	require.Len(t, evaluator.Tags(), 6)
+	require.Equal(t, uint64(0), evaluator.Next())
+
+	require.Equal(t, []uint64{0}, evaluator.Match(matched))
+	require.Equal(t, uint64(1), evaluator.Next())
+}
+
+// Tests that a counter that never arrives does not stall the window: counters
+// up to 2*lookahead are still matched and the lost counter is dropped once it
+// is lookahead behind the highest received counter.
+func TestSihTagEvaluator_Match_Lost(t *testing.T) {
+	rng := rand.New(rand.NewSource(9012))
+	alicePub, alicePriv, _ := ed25519.GenerateKey(rng)
+	bobPub, bobPriv, _ := ed25519.GenerateKey(rng)
+
+	const lookahead = 4
+	sender := NewSenderSihTagRatchet(bobPub, alicePriv)
+	evaluator := NewSihTagEvaluator(
+		NewReceiverSihTagRatchet(alicePub, bobPriv), 0, lookahead)
+
+	matched := func(counter uint64) map[string]struct{} {
+		return map[string]struct{}{sender.Tag(counter): {}}
+	}
+
+	// Counter 0 is lost
+	for counter := uint64(1); counter <= 2*lookahead; counter++ {
+		require.Equal(t, []uint64{counter}, evaluator.Match(matched(counter)),
+			"counter %d", counter)
+		require.LessOrEqual(t, len(evaluator.Tags()), 2*lookahead)
+	}
+
+	require.Equal(t, uint64(2*lookahead+1), evaluator.Next())
+	require.Len(t, evaluator.Tags(), lookahead)
+	require.Empty(t, evaluator.Match(matched(0)))
+}
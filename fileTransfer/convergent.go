@@ -0,0 +1,118 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package fileTransfer contains all cryptographic functions pertaining to the
+// transfer of large (MB) files over the xx network. It is designed to use
+// standard end-to-end encryption. However, it is separated from package e2e to
+// ensure encryption keys are not shared between the two systems to avoiding key
+// exhaustion.
+
+// convergent.go contains logic pertaining to convergent encryption, where the
+// transfer key is derived from the file so that identical files are encrypted
+// identically.
+
+package fileTransfer
+
+import (
+	"crypto/hmac"
+	goHash "hash"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/elixxir/crypto/hash"
+)
+
+const convergentKeyVector = "FileTransferConvergentKey"
+
+// MinConvergentSecretLength is the minimum length, in bytes, of the channel
+// secret used to salt convergent keys. It matches the size of a channel
+// secret.
+const MinConvergentSecretLength = 32
+
+// Error messages.
+const (
+	// NewConvergentKeyHasher
+	convergentSecretLenErr = "channel secret must be at least %d bytes; " +
+		"received %d bytes"
+
+	// NewConvergentTransferKeyFromReader
+	convergentReadErr = "failed to read file: %+v"
+)
+
+// ConvergentKeyHasher derives a convergent TransferKey from a file written to
+// it, without holding the whole file in memory.
+//
+// A convergent key is the HMAC of the file keyed with a channel secret. Every
+// member of the channel who sends the same file derives the same key, and
+// since EncryptPart and StreamEncryptor are deterministic for a given key,
+// they produce the same fingerprints and ciphertext parts, which only need to
+// be uploaded once. Because the key is salted with the channel secret, someone
+// outside the channel cannot confirm that a channel shared a file they know by
+// encrypting it themselves. Members of the same channel can, so convergent keys
+// are opt-in and should not be used for files that must remain private from
+// other channel members.
+type ConvergentKeyHasher struct {
+	mac goHash.Hash
+}
+
+// NewConvergentKeyHasher creates a ConvergentKeyHasher salted with the channel
+// secret. Returns an error if the secret is shorter than
+// MinConvergentSecretLength.
+func NewConvergentKeyHasher(
+	channelSecret []byte) (*ConvergentKeyHasher, error) {
+	if len(channelSecret) < MinConvergentSecretLength {
+		return nil, errors.Errorf(convergentSecretLenErr,
+			MinConvergentSecretLength, len(channelSecret))
+	}
+
+	mac := hmac.New(hash.DefaultHash, channelSecret)
+	mac.Write([]byte(convergentKeyVector))
+	return &ConvergentKeyHasher{mac: mac}, nil
+}
+
+// Write adds file data to the key. It never returns an error. It satisfies the
+// io.Writer interface.
+func (c *ConvergentKeyHasher) Write(p []byte) (int, error) {
+	return c.mac.Write(p)
+}
+
+// TransferKey returns the convergent key of the data written so far.
+func (c *ConvergentKeyHasher) TransferKey() TransferKey {
+	return UnmarshalTransferKey(c.mac.Sum(nil))
+}
+
+// NewConvergentTransferKey derives the convergent TransferKey of the file
+// salted with the channel secret. It is an alternative to NewTransferKey for
+// files that may be sent to the same channel more than once. Returns an error
+// if the secret is shorter than MinConvergentSecretLength.
+func NewConvergentTransferKey(
+	fileData, channelSecret []byte) (TransferKey, error) {
+	c, err := NewConvergentKeyHasher(channelSecret)
+	if err != nil {
+		return TransferKey{}, err
+	}
+
+	_, _ = c.Write(fileData)
+	return c.TransferKey(), nil
+}
+
+// NewConvergentTransferKeyFromReader derives the convergent TransferKey of the
+// file read from r salted with the channel secret. Returns an error if the
+// secret is shorter than MinConvergentSecretLength or reading fails.
+func NewConvergentTransferKeyFromReader(
+	r io.Reader, channelSecret []byte) (TransferKey, error) {
+	c, err := NewConvergentKeyHasher(channelSecret)
+	if err != nil {
+		return TransferKey{}, err
+	}
+
+	if _, err = io.Copy(c, r); err != nil {
+		return TransferKey{}, errors.Errorf(convergentReadErr, err)
+	}
+	return c.TransferKey(), nil
+}
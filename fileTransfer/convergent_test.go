@@ -0,0 +1,138 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package fileTransfer
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+// Consistency test: tests that NewConvergentTransferKey returns the expected
+// keys.
+func TestNewConvergentTransferKey_Consistency(t *testing.T) {
+	expectedKeys := []string{
+		"yvHe6F0ijSZ4rrA1G0NFwbtXITW6vZvMUYoiNukVOYg=",
+		"xBuR9gDjyH73RpcFiBFQLEUYlxTq5D9MFnagvWaZXbo=",
+		"po9BbiIQT3RtnPenmjcQ8F7Yec+WsfL02Pnz8t0N5Go=",
+	}
+
+	prng := rand.New(rand.NewSource(42))
+	for i, expected := range expectedKeys {
+		secret := make([]byte, MinConvergentSecretLength)
+		prng.Read(secret)
+		fileData := make([]byte, prng.Intn(500))
+		prng.Read(fileData)
+
+		key, err := NewConvergentTransferKey(fileData, secret)
+		if err != nil {
+			t.Fatalf("Failed to derive key #%d: %+v", i, err)
+		}
+
+		if key.String() != expected {
+			t.Errorf("Convergent key #%d does not match expected."+
+				"\nexpected: %s\nreceived: %s", i, expected, key.String())
+		}
+	}
+}
+
+// Tests that the same file sent to the same channel produces the same
+// ciphertext parts, while a different channel or file does not.
+func TestNewConvergentTransferKey_Dedupe(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	secret1 := make([]byte, MinConvergentSecretLength)
+	prng.Read(secret1)
+	secret2 := make([]byte, MinConvergentSecretLength)
+	prng.Read(secret2)
+
+	key1, _ := NewConvergentTransferKey(jellyBeans1, secret1)
+	key2, _ := NewConvergentTransferKey(jellyBeans2, secret1)
+	if key1 != key2 {
+		t.Errorf("Keys for the same file in the same channel differ."+
+			"\nkey 1: %s\nkey 2: %s", key1.String(), key2.String())
+	}
+
+	part := jellyBeans1[:64]
+	ciphertext1, mac1 :=
+		EncryptPart(key1, part, 0, GenerateFingerprint(key1, 0))
+	ciphertext2, mac2 :=
+		EncryptPart(key2, part, 0, GenerateFingerprint(key2, 0))
+	if !bytes.Equal(ciphertext1, ciphertext2) || !bytes.Equal(mac1, mac2) {
+		t.Errorf("Parts of the same file in the same channel differ.")
+	}
+
+	var stream1, stream2 bytes.Buffer
+	for _, s := range []struct {
+		dst      *bytes.Buffer
+		key      TransferKey
+		fileData []byte
+	}{{&stream1, key1, jellyBeans1}, {&stream2, key2, jellyBeans2}} {
+		se, _ := NewStreamEncryptor(s.dst, s.key, 256)
+		_, _ = se.Write(s.fileData)
+		_ = se.Close()
+	}
+	if !bytes.Equal(stream1.Bytes(), stream2.Bytes()) {
+		t.Errorf("Streams of the same file in the same channel differ.")
+	}
+
+	otherChannel, _ := NewConvergentTransferKey(jellyBeans1, secret2)
+	if otherChannel == key1 {
+		t.Errorf("Keys for the same file in different channels match.")
+	}
+
+	otherFile, _ := NewConvergentTransferKey(house, secret1)
+	if otherFile == key1 {
+		t.Errorf("Keys for different files in the same channel match.")
+	}
+}
+
+// Tests that NewConvergentTransferKeyFromReader and ConvergentKeyHasher derive
+// the same key as NewConvergentTransferKey.
+func TestNewConvergentTransferKeyFromReader(t *testing.T) {
+	secret := bytes.Repeat([]byte{7}, MinConvergentSecretLength)
+	expected, _ := NewConvergentTransferKey(house, secret)
+
+	key, err := NewConvergentTransferKeyFromReader(
+		iotest.HalfReader(bytes.NewReader(house)), secret)
+	if err != nil {
+		t.Fatalf("Failed to derive key: %+v", err)
+	}
+	if key != expected {
+		t.Errorf("Key from reader does not match.\nexpected: %s\nreceived: %s",
+			expected.String(), key.String())
+	}
+
+	c, _ := NewConvergentKeyHasher(secret)
+	_, _ = c.Write(house[:100])
+	_, _ = c.Write(house[100:])
+	if key = c.TransferKey(); key != expected {
+		t.Errorf("Key from hasher does not match.\nexpected: %s\nreceived: %s",
+			expected.String(), key.String())
+	}
+}
+
+// Error path: tests that a short channel secret and a failing reader return
+// errors.
+func TestNewConvergentTransferKey_Errors(t *testing.T) {
+	short := make([]byte, MinConvergentSecretLength-1)
+	if _, err := NewConvergentTransferKey(house, short); err == nil {
+		t.Errorf("Failed to get error for short channel secret.")
+	}
+	if _, err := NewConvergentKeyHasher(nil); err == nil {
+		t.Errorf("Failed to get error for nil channel secret.")
+	}
+
+	secret := make([]byte, MinConvergentSecretLength)
+	_, err := NewConvergentTransferKeyFromReader(
+		iotest.ErrReader(errors.New("read error")), secret)
+	if err == nil {
+		t.Errorf("Failed to get error for failing reader.")
+	}
+}
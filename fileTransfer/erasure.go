@@ -0,0 +1,264 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package fileTransfer contains all cryptographic functions pertaining to the
+// transfer of large (MB) files over the xx network. It is designed to use
+// standard end-to-end encryption. However, it is separated from package e2e to
+// ensure encryption keys are not shared between the two systems to avoiding key
+// exhaustion.
+
+// erasure.go contains logic pertaining to the erasure coding of file parts so
+// that a file can be reconstructed when some of its parts are lost.
+
+package fileTransfer
+
+import (
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/primitives/format"
+)
+
+// Error messages.
+const (
+	// ErasureEncode, ErasureDecode
+	erasurePartSizeErr     = "part size must be a positive even number; received %d"
+	erasureNumParityErr    = "number of parity parts cannot be negative; received %d"
+	erasureTooManyPartsErr = "%d data parts and %d parity parts exceed the maximum of %d parts"
+
+	// ErasureDecode
+	erasureFileSizeErr       = "file size cannot be negative; received %d"
+	erasureNumPartsErr       = "%d parts is fewer than the %d data parts of the file"
+	erasurePartLenErr        = "part %d is %d bytes; expected %d"
+	erasureNotEnoughPartsErr = "%d parts are needed to reconstruct the file; received %d"
+	erasureDecodeErr         = "failed to solve for missing parts: %+v"
+
+	// DecryptErasureParts
+	erasureNumMacsErr     = "received %d parts but %d MACs"
+	erasureDecryptPartErr = "failed to decrypt part %d: %+v"
+)
+
+// NumErasureParts returns the total number of parts, data and parity, that
+// ErasureEncode produces for a file of the given size.
+func NumErasureParts(fileSize, partSize, numParity int) int {
+	return numFileParts(fileSize, partSize) + numParity
+}
+
+// ErasureEncode splits the file into N data parts of partSize bytes and
+// expands them into N+numParity parts using a systematic Reed-Solomon code
+// over GF(2^16). The first N parts are the file data, with the last part padded
+// with zeros, and the rest are parity parts. Any N of the parts are enough to
+// reconstruct the file with ErasureDecode.
+//
+// The part size must be even and there can be at most math.MaxUint16 parts in
+// total, so that part i can be encrypted with fingerprint number i.
+func ErasureEncode(fileData []byte, partSize, numParity int) ([][]byte, error) {
+	numData := numFileParts(len(fileData), partSize)
+	if err := checkErasureParams(numData, partSize, numParity); err != nil {
+		return nil, err
+	}
+
+	parts := make([][]byte, numData+numParity)
+	for i := 0; i < numData; i++ {
+		parts[i] = make([]byte, partSize)
+		if i*partSize < len(fileData) {
+			copy(parts[i], fileData[i*partSize:])
+		}
+	}
+
+	for i := 0; i < numParity; i++ {
+		parity := make([]byte, partSize)
+		for j := 0; j < numData; j++ {
+			gfMulAdd(parity, parts[j], erasureCoefficient(numData, i, j))
+		}
+		parts[numData+i] = parity
+	}
+
+	return parts, nil
+}
+
+// ErasureDecode reconstructs the file from the parts made by ErasureEncode.
+// parts must be in the same order as they were produced, with nil in place of
+// every part that was not received. Returns an error if fewer parts were
+// received than there are data parts.
+func ErasureDecode(parts [][]byte, fileSize, partSize int) ([]byte, error) {
+	numData := numFileParts(fileSize, partSize)
+	if fileSize < 0 {
+		return nil, errors.Errorf(erasureFileSizeErr, fileSize)
+	} else if len(parts) < numData {
+		return nil, errors.Errorf(erasureNumPartsErr, len(parts), numData)
+	}
+	numParity := len(parts) - numData
+	if err := checkErasureParams(numData, partSize, numParity); err != nil {
+		return nil, err
+	}
+
+	var missing, parity []int
+	received := 0
+	for i, part := range parts {
+		if part == nil {
+			if i < numData {
+				missing = append(missing, i)
+			}
+			continue
+		} else if len(part) != partSize {
+			return nil, errors.Errorf(
+				erasurePartLenErr, i, len(part), partSize)
+		}
+
+		received++
+		if i >= numData {
+			parity = append(parity, i-numData)
+		}
+	}
+	if received < numData {
+		return nil, errors.Errorf(erasureNotEnoughPartsErr, numData, received)
+	}
+
+	data := make([][]byte, numData)
+	copy(data, parts)
+
+	if len(missing) > 0 {
+		recovered, err := recoverErasureParts(
+			data, parts[numData:], missing, parity[:len(missing)], partSize)
+		if err != nil {
+			return nil, err
+		}
+		for i, j := range missing {
+			data[j] = recovered[i]
+		}
+	}
+
+	fileData := make([]byte, 0, numData*partSize)
+	for _, part := range data {
+		fileData = append(fileData, part...)
+	}
+
+	return fileData[:fileSize], nil
+}
+
+// EncryptErasureParts erasure codes the file with ErasureEncode and encrypts
+// each part with EncryptPart. Part i is encrypted with fingerprint number i and
+// its fingerprint is returned at index i.
+func EncryptErasureParts(transferKey TransferKey, fileData []byte, partSize,
+	numParity int) (ciphertexts, macs [][]byte, fps []format.Fingerprint,
+	err error) {
+	parts, err := ErasureEncode(fileData, partSize, numParity)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ciphertexts = make([][]byte, len(parts))
+	macs = make([][]byte, len(parts))
+	fps = GenerateFingerprints(transferKey, uint16(len(parts)))
+	for i, part := range parts {
+		ciphertexts[i], macs[i] = EncryptPart(
+			transferKey, part, uint16(i), fps[i])
+	}
+
+	return ciphertexts, macs, fps, nil
+}
+
+// DecryptErasureParts decrypts the parts made by EncryptErasureParts and
+// reconstructs the file. ciphertexts and macs must be indexed by fingerprint
+// number, with nil in place of every part that was not received. Returns an
+// error if any received part fails to decrypt or if too few parts were
+// received.
+func DecryptErasureParts(transferKey TransferKey, ciphertexts, macs [][]byte,
+	fileSize, partSize int) ([]byte, error) {
+	numData := numFileParts(fileSize, partSize)
+	if len(ciphertexts) != len(macs) {
+		return nil, errors.Errorf(
+			erasureNumMacsErr, len(ciphertexts), len(macs))
+	} else if len(ciphertexts) > maxParts {
+		return nil, errors.Errorf(erasureTooManyPartsErr,
+			numData, len(ciphertexts)-numData, maxParts)
+	}
+
+	parts := make([][]byte, len(ciphertexts))
+	for i, ciphertext := range ciphertexts {
+		if ciphertext == nil {
+			continue
+		}
+
+		fpNum := uint16(i)
+		fp := GenerateFingerprint(transferKey, fpNum)
+		part, err := DecryptPart(transferKey, ciphertext, macs[i], fpNum, fp)
+		if err != nil {
+			return nil, errors.Errorf(erasureDecryptPartErr, i, err)
+		}
+		parts[i] = part
+	}
+
+	return ErasureDecode(parts, fileSize, partSize)
+}
+
+// recoverErasureParts solves for the missing data parts using the given parity
+// parts. It subtracts the received data parts from each parity part, leaving a
+// system of equations in the missing parts whose matrix is a square
+// sub-matrix of the Cauchy matrix, which is always invertible.
+func recoverErasureParts(data, parityParts [][]byte, missing, parity []int,
+	partSize int) ([][]byte, error) {
+	numData := len(data)
+	isMissing := make(map[int]bool, len(missing))
+	for _, j := range missing {
+		isMissing[j] = true
+	}
+
+	// Remove the contribution of the received data parts from the parity
+	remainders := make([][]byte, len(parity))
+	for r, i := range parity {
+		remainders[r] = make([]byte, partSize)
+		copy(remainders[r], parityParts[i])
+		for j := 0; j < numData; j++ {
+			if !isMissing[j] {
+				gfMulAdd(remainders[r], data[j],
+					erasureCoefficient(numData, i, j))
+			}
+		}
+	}
+
+	m := make([][]uint16, len(parity))
+	for r, i := range parity {
+		m[r] = make([]uint16, len(missing))
+		for c, j := range missing {
+			m[r][c] = erasureCoefficient(numData, i, j)
+		}
+	}
+	if err := gfInvertMatrix(m); err != nil {
+		return nil, errors.Errorf(erasureDecodeErr, err)
+	}
+
+	recovered := make([][]byte, len(missing))
+	for c := range missing {
+		recovered[c] = make([]byte, partSize)
+		for r := range parity {
+			gfMulAdd(recovered[c], remainders[r], m[c][r])
+		}
+	}
+
+	return recovered, nil
+}
+
+// erasureCoefficient returns the coefficient of data part j in parity part i.
+// The coefficients form a Cauchy matrix 1/(x_i + y_j) with x_i = numData+i and
+// y_j = j, which are all distinct field elements.
+func erasureCoefficient(numData, i, j int) uint16 {
+	return gfInv(uint16(numData+i) ^ uint16(j))
+}
+
+// checkErasureParams returns an error if the parameters of the erasure code
+// are invalid.
+func checkErasureParams(numData, partSize, numParity int) error {
+	if partSize <= 0 || partSize%2 != 0 {
+		return errors.Errorf(erasurePartSizeErr, partSize)
+	} else if numParity < 0 {
+		return errors.Errorf(erasureNumParityErr, numParity)
+	} else if numData+numParity > maxParts {
+		return errors.Errorf(
+			erasureTooManyPartsErr, numData, numParity, maxParts)
+	}
+	return nil
+}
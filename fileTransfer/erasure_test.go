@@ -0,0 +1,242 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package fileTransfer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math/rand"
+	"testing"
+)
+
+// Consistency test: tests that ErasureEncode returns the expected parity parts.
+// If the expected values no longer match, then the code has changed in a way
+// that breaks compatibility with other clients.
+func TestErasureEncode_Consistency(t *testing.T) {
+	expectedParity := []string{
+		"38CvTIoVtZSLsf4d3ajr/g==",
+		"5nOeyUzpbTDozpTGg7ofmA==",
+		"UDqFbfLeNItVGYr3pK5Gcg==",
+	}
+
+	prng := rand.New(rand.NewSource(42))
+	fileData := make([]byte, 50)
+	prng.Read(fileData)
+
+	parts, err := ErasureEncode(fileData, 16, len(expectedParity))
+	if err != nil {
+		t.Fatalf("Failed to encode file: %+v", err)
+	}
+
+	numData := len(parts) - len(expectedParity)
+	for i, expected := range expectedParity {
+		parity := base64.StdEncoding.EncodeToString(parts[numData+i])
+		if parity != expected {
+			t.Errorf("Parity part #%d does not match expected."+
+				"\nexpected: %s\nreceived: %s", i, expected, parity)
+		}
+	}
+}
+
+// Tests that ErasureDecode reconstructs the file from every combination of
+// lost parts that leaves at least the number of data parts.
+func TestErasureEncode_ErasureDecode(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	const partSize = 8
+	const numParity = 3
+	fileData := make([]byte, 4*partSize-3)
+	prng.Read(fileData)
+
+	parts, err := ErasureEncode(fileData, partSize, numParity)
+	if err != nil {
+		t.Fatalf("Failed to encode file: %+v", err)
+	}
+	numParts := NumErasureParts(len(fileData), partSize, numParity)
+	if len(parts) != numParts {
+		t.Fatalf("Incorrect number of parts.\nexpected: %d\nreceived: %d",
+			numParts, len(parts))
+	}
+	for i := range fileData {
+		if parts[i/partSize][i%partSize] != fileData[i] {
+			t.Fatalf("Data parts do not contain the file data at byte %d.", i)
+		}
+	}
+
+	// Try every subset of lost parts
+	for lost := 0; lost < 1<<numParts; lost++ {
+		received := make([][]byte, numParts)
+		numLost := 0
+		for i := range parts {
+			if lost&(1<<i) != 0 {
+				numLost++
+			} else {
+				received[i] = parts[i]
+			}
+		}
+
+		decoded, err := ErasureDecode(received, len(fileData), partSize)
+		if numLost > numParity {
+			if err == nil {
+				t.Errorf("Failed to get error with %d parts lost (%b).",
+					numLost, lost)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("Failed to decode with parts %b lost: %+v", lost, err)
+		} else if !bytes.Equal(decoded, fileData) {
+			t.Errorf("Decoded file does not match with parts %b lost."+
+				"\nexpected: %v\nreceived: %v", lost, fileData, decoded)
+		}
+	}
+}
+
+// Tests that a large file can be reconstructed after losing random parts.
+func TestErasureDecode_Large(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	const partSize = 64
+	const numParity = 40
+	fileData := make([]byte, 300*partSize+17)
+	prng.Read(fileData)
+
+	parts, err := ErasureEncode(fileData, partSize, numParity)
+	if err != nil {
+		t.Fatalf("Failed to encode file: %+v", err)
+	}
+
+	for _, i := range prng.Perm(len(parts))[:numParity] {
+		parts[i] = nil
+	}
+
+	decoded, err := ErasureDecode(parts, len(fileData), partSize)
+	if err != nil {
+		t.Fatalf("Failed to decode file: %+v", err)
+	}
+	if !bytes.Equal(decoded, fileData) {
+		t.Errorf("Decoded file does not match original.")
+	}
+}
+
+// Tests that a file encrypted with EncryptErasureParts is decrypted by
+// DecryptErasureParts after losing parts and that the parts use the same
+// fingerprints as GenerateFingerprints.
+func TestEncryptErasureParts_DecryptErasureParts(t *testing.T) {
+	prng := NewPrng(42)
+	key, err := NewTransferKey(prng)
+	if err != nil {
+		t.Fatalf("Failed to generate transfer key: %+v", err)
+	}
+	const partSize = 32
+	fileData := make([]byte, 10*partSize-1)
+	_, _ = prng.Read(fileData)
+
+	ciphertexts, macs, fps, err :=
+		EncryptErasureParts(key, fileData, partSize, 4)
+	if err != nil {
+		t.Fatalf("Failed to encrypt file: %+v", err)
+	}
+
+	expectedFps := GenerateFingerprints(key, uint16(len(ciphertexts)))
+	for i := range expectedFps {
+		if fps[i] != expectedFps[i] {
+			t.Errorf("Fingerprint #%d does not match GenerateFingerprints."+
+				"\nexpected: %s\nreceived: %s", i, expectedFps[i], fps[i])
+		}
+	}
+
+	// Lose four parts, including data and parity parts
+	for _, i := range []int{0, 5, 9, 12} {
+		ciphertexts[i], macs[i] = nil, nil
+	}
+
+	decrypted, err :=
+		DecryptErasureParts(key, ciphertexts, macs, len(fileData), partSize)
+	if err != nil {
+		t.Fatalf("Failed to decrypt file: %+v", err)
+	}
+	if !bytes.Equal(decrypted, fileData) {
+		t.Errorf("Decrypted file does not match original."+
+			"\nexpected: %v\nreceived: %v", fileData, decrypted)
+	}
+
+	// A fifth lost part is one too many
+	ciphertexts[1], macs[1] = nil, nil
+	_, err =
+		DecryptErasureParts(key, ciphertexts, macs, len(fileData), partSize)
+	if err == nil {
+		t.Errorf("Failed to get error with too many parts lost.")
+	}
+}
+
+// Error path: tests that DecryptErasureParts returns an error when a received
+// part has been modified.
+func TestDecryptErasureParts_BadMAC(t *testing.T) {
+	prng := NewPrng(42)
+	key, _ := NewTransferKey(prng)
+	fileData := make([]byte, 100)
+	_, _ = prng.Read(fileData)
+
+	ciphertexts, macs, _, err := EncryptErasureParts(key, fileData, 32, 2)
+	if err != nil {
+		t.Fatalf("Failed to encrypt file: %+v", err)
+	}
+	ciphertexts[4][0] ^= 1
+
+	_, err = DecryptErasureParts(key, ciphertexts, macs, len(fileData), 32)
+	if err == nil {
+		t.Errorf("Failed to get error for modified part.")
+	}
+}
+
+// Error path: tests that ErasureEncode and ErasureDecode reject invalid
+// parameters.
+func TestErasureEncode_InvalidParams(t *testing.T) {
+	fileData := make([]byte, 100)
+	for _, params := range []struct{ partSize, numParity int }{
+		{0, 1}, {-2, 1}, {7, 1}, {16, -1}, {2, maxParts},
+	} {
+		_, err := ErasureEncode(fileData, params.partSize, params.numParity)
+		if err == nil {
+			t.Errorf("Failed to get error for part size %d and %d parity "+
+				"parts.", params.partSize, params.numParity)
+		}
+	}
+
+	parts, _ := ErasureEncode(fileData, 16, 2)
+	if _, err := ErasureDecode(parts[:5], len(fileData), 16); err == nil {
+		t.Errorf("Failed to get error for too few parts.")
+	}
+	parts[0] = parts[0][:15]
+	if _, err := ErasureDecode(parts, len(fileData), 16); err == nil {
+		t.Errorf("Failed to get error for part of wrong size.")
+	}
+	if _, err := ErasureDecode(parts, -1, 16); err == nil {
+		t.Errorf("Failed to get error for negative file size.")
+	}
+}
+
+// Tests that the GF(2^16) tables contain every non-zero element and that
+// every element multiplied by its inverse is one.
+func Test_gfTables(t *testing.T) {
+	seen := make([]bool, 1<<16)
+	for i := 0; i < gfOrder; i++ {
+		if seen[gfExp[i]] {
+			t.Fatalf("Element %d appears twice in the exponent table.",
+				gfExp[i])
+		}
+		seen[gfExp[i]] = true
+	}
+	if seen[0] {
+		t.Errorf("Zero is in the exponent table.")
+	}
+
+	for a := 1; a < 1<<16; a++ {
+		if gfMul(uint16(a), gfInv(uint16(a))) != 1 {
+			t.Fatalf("%d times its inverse is not 1.", a)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package fileTransfer contains all cryptographic functions pertaining to the
+// transfer of large (MB) files over the xx network. It is designed to use
+// standard end-to-end encryption. However, it is separated from package e2e to
+// ensure encryption keys are not shared between the two systems to avoiding key
+// exhaustion.
+
+// gf65536.go contains logic pertaining to arithmetic in the finite field
+// GF(2^16) used by the erasure code.
+
+package fileTransfer
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// gfPolynomial is the primitive polynomial x^16 + x^12 + x^3 + x + 1 used to
+// construct GF(2^16).
+const gfPolynomial = 0x1100B
+
+// gfOrder is the number of non-zero elements in GF(2^16).
+const gfOrder = 1<<16 - 1
+
+// Logarithm and exponent tables for GF(2^16) with generator 2. gfExp is twice
+// as long as needed so that the sum of two logarithms can be used as an index
+// without reduction.
+var gfLog, gfExp = makeGFTables()
+
+// makeGFTables builds the logarithm and exponent tables.
+func makeGFTables() (log *[1 << 16]uint16, exp *[2 * gfOrder]uint16) {
+	log = new([1 << 16]uint16)
+	exp = new([2 * gfOrder]uint16)
+
+	x := uint32(1)
+	for i := 0; i < gfOrder; i++ {
+		exp[i] = uint16(x)
+		exp[i+gfOrder] = uint16(x)
+		log[x] = uint16(i)
+		x <<= 1
+		if x&(1<<16) != 0 {
+			x ^= gfPolynomial
+		}
+	}
+
+	return log, exp
+}
+
+// gfMul returns the product of a and b.
+func gfMul(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// gfInv returns the multiplicative inverse of a. a must not be zero.
+func gfInv(a uint16) uint16 {
+	return gfExp[gfOrder-int(gfLog[a])]
+}
+
+// gfMulAdd multiplies every 16-bit big-endian symbol in src by c and adds it to
+// the corresponding symbol in dst. dst and src must be the same even length.
+func gfMulAdd(dst, src []byte, c uint16) {
+	if c == 0 {
+		return
+	}
+	logC := int(gfLog[c])
+	for i := 0; i < len(src); i += 2 {
+		s := binary.BigEndian.Uint16(src[i:])
+		if s == 0 {
+			continue
+		}
+		d := binary.BigEndian.Uint16(dst[i:]) ^ gfExp[int(gfLog[s])+logC]
+		binary.BigEndian.PutUint16(dst[i:], d)
+	}
+}
+
+// gfInvertMatrix inverts the square matrix m in place using Gauss-Jordan
+// elimination. Returns an error if m is singular.
+func gfInvertMatrix(m [][]uint16) error {
+	n := len(m)
+	inv := make([][]uint16, n)
+	for i := range inv {
+		inv[i] = make([]uint16, n)
+		inv[i][i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		// Find a row with a non-zero pivot and move it into place
+		pivot := col
+		for pivot < n && m[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return errors.New("matrix is singular")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+
+		// Scale the pivot row so the pivot is one
+		scale := gfInv(m[col][col])
+		for j := 0; j < n; j++ {
+			m[col][j] = gfMul(m[col][j], scale)
+			inv[col][j] = gfMul(inv[col][j], scale)
+		}
+
+		// Eliminate the column from every other row
+		for row := 0; row < n; row++ {
+			factor := m[row][col]
+			if row == col || factor == 0 {
+				continue
+			}
+			for j := 0; j < n; j++ {
+				m[row][j] ^= gfMul(factor, m[col][j])
+				inv[row][j] ^= gfMul(factor, inv[col][j])
+			}
+		}
+	}
+
+	copy(m, inv)
+	return nil
+}
@@ -26,9 +26,10 @@ import (
 
 // Key length constants, in bytes.
 const (
-	componentKeyVector = "FileTransferComponentKey"
-	partKeyLen         = 32
-	TransferKeyLength  = 32
+	componentKeyVector  = "FileTransferComponentKey"
+	streamPartKeyVector = "FileTransferStreamPartKey"
+	partKeyLen          = 32
+	TransferKeyLength   = 32
 )
 
 // Error messages.
@@ -61,6 +62,19 @@ func NewTransferKey(rng csprng.Source) (TransferKey, error) {
 // getPartKey generates the message based off of the TransferKey and the
 // fingerprint number.
 func getPartKey(tr TransferKey, fpNum uint16) partKey {
+	return derivePartKey(tr, fpNum, componentKeyVector)
+}
+
+// getStreamPartKey generates the key used to encrypt a part with the streaming
+// cipher. It is separate from the key of getPartKey so that the two ciphers
+// never share a key stream.
+func getStreamPartKey(tr TransferKey, fpNum uint16) partKey {
+	return derivePartKey(tr, fpNum, streamPartKeyVector)
+}
+
+// derivePartKey hashes the TransferKey, the fingerprint number, and the vector
+// into a partKey.
+func derivePartKey(tr TransferKey, fpNum uint16, vector string) partKey {
 	h, _ := hash.NewCMixHash()
 	h.Reset()
 
@@ -68,10 +82,10 @@ func getPartKey(tr TransferKey, fpNum uint16) partKey {
 	partNumBytes := make([]byte, 2)
 	binary.LittleEndian.PutUint16(partNumBytes, fpNum)
 
-	// Write the TransferKey, part number, and componentKeyVector to the hash
+	// Write the TransferKey, part number, and vector to the hash
 	h.Write(tr.Bytes())
 	h.Write(partNumBytes)
-	h.Write([]byte(componentKeyVector))
+	h.Write([]byte(vector))
 
 	// Get hashed data
 	keyData := h.Sum(nil)
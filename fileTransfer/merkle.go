@@ -0,0 +1,290 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package fileTransfer contains all cryptographic functions pertaining to the
+// transfer of large (MB) files over the xx network. It is designed to use
+// standard end-to-end encryption. However, it is separated from package e2e to
+// ensure encryption keys are not shared between the two systems to avoiding key
+// exhaustion.
+
+// merkle.go contains logic pertaining to Merkle tree file IDs and the proofs
+// that a file part belongs to a file.
+
+package fileTransfer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/crypto/hash"
+)
+
+// Prefixes that separate the hashes of leaves from the hashes of inner nodes,
+// as in RFC 6962, so that an inner node cannot be passed off as a part.
+const (
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// merkleProofHeaderLen is the length of the part number at the start of a
+// marshalled MerkleProof.
+const merkleProofHeaderLen = 2
+
+// Error messages.
+const (
+	// NewMerkleTree
+	merklePartSizeErr     = "part size must be positive; received %d"
+	merkleTooManyPartsErr = "file has %d parts; the maximum is %d parts"
+
+	// MerkleTree.Proof
+	merklePartNumErr = "part %d does not exist in file of %d parts"
+
+	// UnmarshalMerkleProof
+	merkleProofLenErr = "proof must be %d bytes plus a multiple of %d bytes; " +
+		"received %d bytes"
+)
+
+// MerkleTree is a Merkle tree over the parts of a file. Its root is a file ID
+// that can be computed before a transfer starts and shared with the
+// recipients. Each part can then be sent with a MerkleProof, allowing the
+// recipient to check every part against the file ID as it arrives rather than
+// waiting for the whole file.
+//
+// The tree is built as in RFC 6962 using the cMix hash. The parts are split
+// along the same boundaries as NumStreamParts, so that the proof for part i
+// accompanies the part sent with fingerprint number i. Identical files split
+// into parts of the same size have the same ID, regardless of the transfer
+// key, so files can be deduplicated across transfers.
+type MerkleTree struct {
+	root     *merkleNode
+	numParts int
+}
+
+// merkleNode is a node of a MerkleTree. Leaves have no children.
+type merkleNode struct {
+	hash        []byte
+	left, right *merkleNode
+}
+
+// MerkleProof is the inclusion proof of a single part in a MerkleTree.
+type MerkleProof struct {
+	// PartNum is the index of the part, which is also its fingerprint
+	// number.
+	PartNum uint16
+
+	// Path is the list of sibling hashes from the leaf up to the root.
+	Path [][]byte
+}
+
+// NewMerkleID returns the ID of the file that is the root of its MerkleTree.
+// Returns an error if the part size is not positive or the file has too many
+// parts.
+func NewMerkleID(fileData []byte, partSize int) (ID, error) {
+	tree, err := NewMerkleTree(fileData, partSize)
+	if err != nil {
+		return ID{}, err
+	}
+	return tree.ID(), nil
+}
+
+// NewMerkleTree builds the MerkleTree of the file split into parts of partSize
+// bytes. Returns an error if the part size is not positive or the file has too
+// many parts.
+func NewMerkleTree(fileData []byte, partSize int) (*MerkleTree, error) {
+	if partSize <= 0 {
+		return nil, errors.Errorf(merklePartSizeErr, partSize)
+	}
+	numParts := numFileParts(len(fileData), partSize)
+	if numParts > maxParts {
+		return nil, errors.Errorf(merkleTooManyPartsErr, numParts, maxParts)
+	}
+
+	leaves := make([]*merkleNode, numParts)
+	for i := range leaves {
+		start, end := i*partSize, (i+1)*partSize
+		if end > len(fileData) {
+			end = len(fileData)
+		}
+		leaves[i] = &merkleNode{hash: merkleLeafHash(fileData[start:end])}
+	}
+
+	return &MerkleTree{root: buildMerkleNode(leaves), numParts: numParts}, nil
+}
+
+// ID returns the root of the tree as a file ID.
+func (mt *MerkleTree) ID() ID {
+	var id ID
+	copy(id[:], mt.root.hash)
+	return id
+}
+
+// NumParts returns the number of parts in the file.
+func (mt *MerkleTree) NumParts() uint16 {
+	return uint16(mt.numParts)
+}
+
+// Proof returns the inclusion proof of the part with the given number.
+// Returns an error if the part does not exist.
+func (mt *MerkleTree) Proof(partNum uint16) (MerkleProof, error) {
+	if int(partNum) >= mt.numParts {
+		return MerkleProof{}, errors.Errorf(
+			merklePartNumErr, partNum, mt.numParts)
+	}
+
+	// Walk down from the root, collecting the sibling of every node on the
+	// way to the leaf
+	var path [][]byte
+	node, index, size := mt.root, int(partNum), mt.numParts
+	for size > 1 {
+		k := merkleSplit(size)
+		if index < k {
+			path = append(path, node.right.hash)
+			node, size = node.left, k
+		} else {
+			path = append(path, node.left.hash)
+			node, index, size = node.right, index-k, size-k
+		}
+	}
+
+	// The proof lists the siblings from the leaf up
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	return MerkleProof{PartNum: partNum, Path: path}, nil
+}
+
+// VerifyMerklePart verifies that the decrypted part belongs to the file with
+// the given ID and number of parts, using the algorithm of RFC 9162 section
+// 2.1.3.2. The number of parts must come from the file information rather than
+// from the sender of the part, since it is not bound by the proof.
+func VerifyMerklePart(id ID, numParts uint16, part []byte,
+	proof MerkleProof) bool {
+	if proof.PartNum >= numParts {
+		return false
+	}
+
+	fn, sn := proof.PartNum, numParts-1
+	r := merkleLeafHash(part)
+	for _, p := range proof.Path {
+		if sn == 0 || len(p) != IdLen {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	return sn == 0 && bytes.Equal(r, id[:])
+}
+
+// Marshal serialises the MerkleProof into a byte slice small enough to send
+// with a file part. The format is the part number as 2 little-endian bytes
+// followed by the path.
+func (mp MerkleProof) Marshal() []byte {
+	b := make([]byte, merkleProofHeaderLen,
+		merkleProofHeaderLen+len(mp.Path)*IdLen)
+	binary.LittleEndian.PutUint16(b, mp.PartNum)
+	for _, p := range mp.Path {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// UnmarshalMerkleProof deserializes the byte slice into a MerkleProof.
+func UnmarshalMerkleProof(b []byte) (MerkleProof, error) {
+	if len(b) < merkleProofHeaderLen ||
+		(len(b)-merkleProofHeaderLen)%IdLen != 0 {
+		return MerkleProof{}, errors.Errorf(
+			merkleProofLenErr, merkleProofHeaderLen, IdLen, len(b))
+	}
+
+	mp := MerkleProof{
+		PartNum: binary.LittleEndian.Uint16(b),
+		Path:    make([][]byte, (len(b)-merkleProofHeaderLen)/IdLen),
+	}
+	for i := range mp.Path {
+		start := merkleProofHeaderLen + i*IdLen
+		mp.Path[i] = append([]byte{}, b[start:start+IdLen]...)
+	}
+
+	return mp, nil
+}
+
+// MarshalJSON adheres to the [json.Marshaler] interface.
+func (mp MerkleProof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mp.Marshal())
+}
+
+// UnmarshalJSON adheres to the [json.Unmarshaler] interface.
+func (mp *MerkleProof) UnmarshalJSON(b []byte) error {
+	var buff []byte
+	if err := json.Unmarshal(b, &buff); err != nil {
+		return err
+	}
+
+	newProof, err := UnmarshalMerkleProof(buff)
+	if err != nil {
+		return err
+	}
+
+	*mp = newProof
+	return nil
+}
+
+// buildMerkleNode builds the subtree over the given leaves. The leaves are
+// split so that the left subtree is the largest complete tree.
+func buildMerkleNode(leaves []*merkleNode) *merkleNode {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+
+	k := merkleSplit(len(leaves))
+	left, right := buildMerkleNode(leaves[:k]), buildMerkleNode(leaves[k:])
+	return &merkleNode{
+		hash:  merkleNodeHash(left.hash, right.hash),
+		left:  left,
+		right: right,
+	}
+}
+
+// merkleSplit returns the largest power of two smaller than n, which is the
+// number of leaves in the left subtree of a tree with n leaves.
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// merkleLeafHash returns the hash of a leaf holding the given part.
+func merkleLeafHash(part []byte) []byte {
+	h, _ := hash.NewCMixHash()
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(part)
+	return h.Sum(nil)
+}
+
+// merkleNodeHash returns the hash of an inner node with the given children.
+func merkleNodeHash(left, right []byte) []byte {
+	h, _ := hash.NewCMixHash()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
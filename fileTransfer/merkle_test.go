@@ -0,0 +1,193 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package fileTransfer
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// Consistency test: tests that NewMerkleID returns the expected IDs for files
+// of different numbers of parts.
+func TestNewMerkleID_Consistency(t *testing.T) {
+	expectedIDs := []string{
+		"1pR9rKnLMXoRUj8/K5mGkh+RhS8KPP7gdHYrU67TSZs=",
+		"f2jLTf9Mq2KDZJszQn9GvZgZYJh+kxcnYOqf+ieF8+o=",
+		"nlTHU9YQHfiiuqXo4FLKDJO14BqHXtLJpw3U7Wdkoi8=",
+		"RjZGMWssc6IlRdttwYsctH2S8B3Nj1MtNLLtJ+8Vu20=",
+	}
+
+	prng := rand.New(rand.NewSource(42))
+	for i, expected := range expectedIDs {
+		fileData := make([]byte, prng.Intn(1000))
+		prng.Read(fileData)
+
+		id, err := NewMerkleID(fileData, 64)
+		if err != nil {
+			t.Fatalf("Failed to make ID #%d: %+v", i, err)
+		}
+
+		if id.String() != expected {
+			t.Errorf("Merkle ID #%d does not match expected."+
+				"\nexpected: %s\nreceived: %s", i, expected, id)
+		}
+	}
+}
+
+// Tests that the proof of every part verifies against the file ID for trees
+// of many sizes, and that each proof only verifies for its own part.
+func TestMerkleTree_Proof_VerifyMerklePart(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	const partSize = 8
+
+	for numParts := 1; numParts <= 33; numParts++ {
+		fileData := make([]byte, numParts*partSize-prng.Intn(partSize))
+		prng.Read(fileData)
+
+		tree, err := NewMerkleTree(fileData, partSize)
+		if err != nil {
+			t.Fatalf("Failed to make tree of %d parts: %+v", numParts, err)
+		}
+		if int(tree.NumParts()) != numParts {
+			t.Fatalf("Incorrect number of parts.\nexpected: %d\nreceived: %d",
+				numParts, tree.NumParts())
+		}
+		id := tree.ID()
+
+		for i := 0; i < numParts; i++ {
+			part := fileData[i*partSize:]
+			if len(part) > partSize {
+				part = part[:partSize]
+			}
+
+			proof, err := tree.Proof(uint16(i))
+			if err != nil {
+				t.Fatalf("Failed to get proof of part %d of %d: %+v",
+					i, numParts, err)
+			}
+			if !VerifyMerklePart(id, tree.NumParts(), part, proof) {
+				t.Errorf("Failed to verify part %d of %d.", i, numParts)
+			}
+
+			// The proof does not verify a modified part
+			modified := append([]byte{}, part...)
+			modified[0] ^= 1
+			if VerifyMerklePart(id, tree.NumParts(), modified, proof) {
+				t.Errorf("Verified modified part %d of %d.", i, numParts)
+			}
+
+			// The proof does not verify the part at another position
+			if numParts > 1 {
+				moved := proof
+				moved.PartNum = uint16((i + 1) % numParts)
+				if VerifyMerklePart(id, tree.NumParts(), part, moved) {
+					t.Errorf("Verified part %d of %d at position %d.",
+						i, numParts, moved.PartNum)
+				}
+			}
+		}
+	}
+}
+
+// Tests that identical files have the same ID while files that differ, or are
+// split differently, do not.
+func TestNewMerkleID_Dedupe(t *testing.T) {
+	id1, _ := NewMerkleID(loremIpsum1, 256)
+	id2, _ := NewMerkleID(loremIpsum2, 256)
+	if id1 != id2 {
+		t.Errorf("IDs for the same file are different.\nfile 1: %s\nfile 2: %s",
+			id1, id2)
+	}
+
+	id3, _ := NewMerkleID(ioremLpsum, 256)
+	if id1 == id3 {
+		t.Errorf("IDs for different files are the same: %s", id1)
+	}
+
+	id4, _ := NewMerkleID(loremIpsum1, 128)
+	if id1 == id4 {
+		t.Errorf("IDs for different part sizes are the same: %s", id1)
+	}
+
+	if id1 == NewID(loremIpsum1) {
+		t.Errorf("Merkle ID matches the hash of the file: %s", id1)
+	}
+}
+
+// Error path: tests that VerifyMerklePart rejects proofs with bad lengths,
+// part numbers, or paths.
+func TestVerifyMerklePart_InvalidProof(t *testing.T) {
+	fileData := make([]byte, 100)
+	rand.New(rand.NewSource(42)).Read(fileData)
+	tree, _ := NewMerkleTree(fileData, 10)
+	id := tree.ID()
+	proof, _ := tree.Proof(3)
+	part := fileData[30:40]
+
+	tests := map[string]MerkleProof{
+		"part number too large": {10, proof.Path},
+		"path too short":        {3, proof.Path[:len(proof.Path)-1]},
+		"path too long":         {3, append(proof.Path, proof.Path[0])},
+		"short hash":            {3, [][]byte{proof.Path[0][:5]}},
+	}
+
+	for name, invalid := range tests {
+		if VerifyMerklePart(id, 10, part, invalid) {
+			t.Errorf("Verified part with invalid proof: %s", name)
+		}
+	}
+
+	// A number of parts that changes the shape of the tree
+	if VerifyMerklePart(id, 17, part, proof) {
+		t.Errorf("Verified part with the wrong number of parts.")
+	}
+
+	if _, err := tree.Proof(10); err == nil {
+		t.Errorf("Failed to get error for proof of nonexistent part.")
+	}
+}
+
+// Tests that a MerkleProof marshalled with MerkleProof.Marshal and
+// unmarshalled with UnmarshalMerkleProof, and through JSON, matches the
+// original.
+func TestMerkleProof_Marshal_UnmarshalMerkleProof(t *testing.T) {
+	fileData := make([]byte, 1000)
+	rand.New(rand.NewSource(42)).Read(fileData)
+	tree, _ := NewMerkleTree(fileData, 64)
+	proof, _ := tree.Proof(7)
+
+	newProof, err := UnmarshalMerkleProof(proof.Marshal())
+	if err != nil {
+		t.Fatalf("Failed to unmarshal proof: %+v", err)
+	}
+	if !reflect.DeepEqual(proof, newProof) {
+		t.Errorf("Unmarshalled proof does not match original."+
+			"\nexpected: %+v\nreceived: %+v", proof, newProof)
+	}
+
+	data, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("Failed to JSON marshal proof: %+v", err)
+	}
+	var jsonProof MerkleProof
+	if err = json.Unmarshal(data, &jsonProof); err != nil {
+		t.Fatalf("Failed to JSON unmarshal proof: %+v", err)
+	}
+	if !reflect.DeepEqual(proof, jsonProof) {
+		t.Errorf("JSON unmarshalled proof does not match original."+
+			"\nexpected: %+v\nreceived: %+v", proof, jsonProof)
+	}
+
+	for _, b := range [][]byte{{1}, append(proof.Marshal(), 0)} {
+		if _, err = UnmarshalMerkleProof(b); err == nil {
+			t.Errorf("Failed to get error for proof of %d bytes.", len(b))
+		}
+	}
+}
@@ -0,0 +1,352 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package fileTransfer contains all cryptographic functions pertaining to the
+// transfer of large (MB) files over the xx network. It is designed to use
+// standard end-to-end encryption. However, it is separated from package e2e to
+// ensure encryption keys are not shared between the two systems to avoiding key
+// exhaustion.
+
+// stream.go contains logic pertaining to the streaming encryption and
+// decryption of files that do not fit in memory.
+
+package fileTransfer
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// StreamPartOverhead is the number of bytes the streaming cipher adds to each
+// part.
+const StreamPartOverhead = chacha20poly1305.Overhead
+
+// maxParts is the maximum number of parts in a transfer. Each part uses its own
+// fingerprint number and GenerateFingerprints can generate at most
+// math.MaxUint16 fingerprints.
+const maxParts = math.MaxUint16
+
+// Additional data marking whether a part is the last part of the stream.
+var (
+	streamPartAD     = []byte{0}
+	streamLastPartAD = []byte{1}
+)
+
+// Error messages.
+const (
+	// NewStreamEncryptor, NewStreamDecryptor
+	streamPartSizeErr = "part size must be positive; received %d"
+
+	// StreamEncryptor.Write, StreamDecryptor.Read
+	streamTooManyPartsErr = "file exceeds the maximum of %d parts"
+
+	// StreamEncryptor.Write
+	streamClosedErr = "cannot write to closed stream encryptor"
+
+	// StreamDecryptor.Read
+	streamPartTooSmallErr = "encrypted part %d is %d bytes; must be at least %d"
+	streamPartAuthErr     = "failed to authenticate part %d: %+v"
+)
+
+// NumStreamParts returns the number of parts a file of the given size is split
+// into by StreamEncryptor. Part i is encrypted using fingerprint number i, so
+// GenerateFingerprints(key, NumStreamParts(fileSize, partSize)) returns the
+// fingerprints of every part in order. A file always has at least one part,
+// even when empty.
+func NumStreamParts(fileSize, partSize int) int {
+	return numFileParts(fileSize, partSize)
+}
+
+// numFileParts returns the number of parts of partSize bytes in a file of the
+// given size. A file always has at least one part, even when empty.
+func numFileParts(fileSize, partSize int) int {
+	if fileSize <= 0 || partSize <= 0 {
+		return 1
+	}
+	return (fileSize + partSize - 1) / partSize
+}
+
+// StreamEncryptor is an io.WriteCloser that encrypts a file as it is written.
+// The file is split into parts of partSize bytes and each part is sealed with
+// XChaCha20-Poly1305, following the STREAM construction: each part has its own
+// key and nonce derived from the TransferKey and its fingerprint number, and
+// the last part is marked so that the stream cannot be truncated or extended
+// without detection. Each encrypted part is StreamPartOverhead bytes larger
+// than the plaintext part and is written to the destination in order.
+//
+// The transfer MAC of the file, identical to the one returned by
+// CreateTransferMAC, is computed as the file is written.
+//
+// A StreamEncryptor is not safe for concurrent use.
+type StreamEncryptor struct {
+	dst      io.Writer
+	key      TransferKey
+	partSize int
+
+	// buf holds the plaintext of the current part. A full part is only
+	// encrypted once more data is written, since until then it may be the
+	// last part.
+	buf []byte
+
+	numParts int
+	mac      hash.Hash
+	closed   bool
+	err      error
+}
+
+// NewStreamEncryptor returns a StreamEncryptor that writes the encrypted parts
+// to dst. Returns an error if the part size is not positive.
+func NewStreamEncryptor(
+	dst io.Writer, key TransferKey, partSize int) (*StreamEncryptor, error) {
+	if partSize <= 0 {
+		return nil, errors.Errorf(streamPartSizeErr, partSize)
+	}
+
+	return &StreamEncryptor{
+		dst:      dst,
+		key:      key,
+		partSize: partSize,
+		buf:      make([]byte, 0, partSize),
+		mac:      newTransferMAC(key),
+	}, nil
+}
+
+// Write encrypts p and writes every completed part to the destination. It
+// satisfies the io.Writer interface.
+func (s *StreamEncryptor) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New(streamClosedErr)
+	} else if s.err != nil {
+		return 0, s.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if len(s.buf) == s.partSize {
+			if s.err = s.writePart(false); s.err != nil {
+				return written, s.err
+			}
+		}
+
+		n := copy(s.buf[len(s.buf):s.partSize], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		s.mac.Write(p[:n])
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close encrypts and writes the last part. It must be called once the whole
+// file has been written. It satisfies the io.Closer interface.
+func (s *StreamEncryptor) Close() error {
+	if s.closed {
+		return nil
+	} else if s.err != nil {
+		return s.err
+	}
+
+	s.err = s.writePart(true)
+	s.closed = true
+	return s.err
+}
+
+// NumParts returns the number of parts written so far. After Close, it is the
+// number of fingerprints needed for the file.
+func (s *StreamEncryptor) NumParts() uint16 {
+	return uint16(s.numParts)
+}
+
+// TransferMAC returns the transfer MAC of the data written so far. After
+// Close, it matches CreateTransferMAC for the whole file.
+func (s *StreamEncryptor) TransferMAC() []byte {
+	return sumTransferMAC(s.mac)
+}
+
+// writePart seals the buffered part and writes it to the destination.
+func (s *StreamEncryptor) writePart(last bool) error {
+	if s.numParts == maxParts {
+		return errors.Errorf(streamTooManyPartsErr, maxParts)
+	}
+
+	aead, nonce := newStreamPartCipher(s.key, uint16(s.numParts))
+	ad := streamPartAD
+	if last {
+		ad = streamLastPartAD
+	}
+
+	ciphertext := aead.Seal(nil, nonce, s.buf, ad)
+	if _, err := s.dst.Write(ciphertext); err != nil {
+		return err
+	}
+
+	s.numParts++
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// StreamDecryptor is an io.Reader that decrypts and authenticates a file
+// encrypted by StreamEncryptor as it is read. Each part is authenticated
+// before any of its plaintext is returned. Read returns an error if any part
+// was modified, reordered, or removed, including the end of the stream.
+//
+// The transfer MAC of the file is computed as the file is read.
+//
+// A StreamDecryptor is not safe for concurrent use.
+type StreamDecryptor struct {
+	src      io.Reader
+	key      TransferKey
+	partSize int
+
+	// buf holds one encrypted part plus one extra byte, which is used to
+	// learn whether the part is the last one. n is the number of bytes in
+	// buf.
+	buf []byte
+	n   int
+
+	// plaintext is the decrypted data not yet returned by Read.
+	plaintext []byte
+
+	numParts int
+	mac      hash.Hash
+	done     bool
+	err      error
+}
+
+// NewStreamDecryptor returns a StreamDecryptor that reads the encrypted parts
+// from src. The part size must match the one used by the StreamEncryptor.
+// Returns an error if the part size is not positive.
+func NewStreamDecryptor(
+	src io.Reader, key TransferKey, partSize int) (*StreamDecryptor, error) {
+	if partSize <= 0 {
+		return nil, errors.Errorf(streamPartSizeErr, partSize)
+	}
+
+	return &StreamDecryptor{
+		src:      src,
+		key:      key,
+		partSize: partSize,
+		buf:      make([]byte, partSize+StreamPartOverhead+1),
+		mac:      newTransferMAC(key),
+	}, nil
+}
+
+// Read reads the decrypted file into p. It returns io.EOF once the last part
+// has been read. It satisfies the io.Reader interface.
+func (s *StreamDecryptor) Read(p []byte) (int, error) {
+	for len(s.plaintext) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		} else if s.done {
+			return 0, io.EOF
+		}
+		s.err = s.readPart()
+	}
+
+	n := copy(p, s.plaintext)
+	s.plaintext = s.plaintext[n:]
+	return n, nil
+}
+
+// NumParts returns the number of parts read so far.
+func (s *StreamDecryptor) NumParts() uint16 {
+	return uint16(s.numParts)
+}
+
+// TransferMAC returns the transfer MAC of the data decrypted so far. Once Read
+// returns io.EOF, it matches CreateTransferMAC for the whole file.
+func (s *StreamDecryptor) TransferMAC() []byte {
+	return sumTransferMAC(s.mac)
+}
+
+// VerifyTransferMAC verifies that the transfer MAC of the data decrypted so
+// far matches the given MAC.
+func (s *StreamDecryptor) VerifyTransferMAC(mac []byte) bool {
+	return hmac.Equal(s.TransferMAC(), mac)
+}
+
+// readPart reads, authenticates, and decrypts the next part.
+func (s *StreamDecryptor) readPart() error {
+	n, err := io.ReadFull(s.src, s.buf[s.n:])
+	s.n += n
+	last := false
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		last = true
+	} else if err != nil {
+		return err
+	}
+
+	if s.numParts == maxParts {
+		return errors.Errorf(streamTooManyPartsErr, maxParts)
+	}
+
+	partLen := s.n
+	ad := streamLastPartAD
+	if !last {
+		partLen = len(s.buf) - 1
+		ad = streamPartAD
+	} else if partLen < StreamPartOverhead {
+		return errors.Errorf(streamPartTooSmallErr,
+			s.numParts, partLen, StreamPartOverhead)
+	}
+
+	aead, nonce := newStreamPartCipher(s.key, uint16(s.numParts))
+	plaintext, err := aead.Open(nil, nonce, s.buf[:partLen], ad)
+	if err != nil {
+		return errors.Errorf(streamPartAuthErr, s.numParts, err)
+	}
+	s.mac.Write(plaintext)
+	s.plaintext = plaintext
+	s.numParts++
+
+	// Keep the byte read past the end of the part as the start of the next
+	s.n = copy(s.buf, s.buf[partLen:s.n])
+	s.done = last
+	return nil
+}
+
+// newStreamPartCipher returns the AEAD and nonce for the part with the given
+// fingerprint number. The nonce is taken from the part's fingerprint, like in
+// EncryptPart.
+func newStreamPartCipher(
+	transferKey TransferKey, fpNum uint16) (cipher.AEAD, []byte) {
+	pk := getStreamPartKey(transferKey, fpNum)
+	aead, err := chacha20poly1305.NewX(pk[:])
+	if err != nil {
+		jww.FATAL.Panic(err)
+	}
+
+	fp := GenerateFingerprint(transferKey, fpNum)
+	return aead, fp[:chacha20poly1305.NonceSizeX]
+}
+
+// newTransferMAC returns a hash that computes the transfer MAC of the data
+// written to it, so that the MAC can be computed without holding the whole
+// file in memory. It must match CreateTransferMAC.
+func newTransferMAC(key TransferKey) hash.Hash {
+	return hmac.New(sha256.New, key.Bytes())
+}
+
+// sumTransferMAC returns the transfer MAC from a hash made by newTransferMAC.
+func sumTransferMAC(h hash.Hash) []byte {
+	mac := h.Sum(nil)
+
+	// Set the first bit to be 0 to comply with the group requirements in the
+	// cMix message format.
+	mac[0] &= 0x7F
+
+	return mac
+}
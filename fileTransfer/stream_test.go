@@ -0,0 +1,243 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package fileTransfer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// Consistency test for StreamEncryptor.
+func TestStreamEncryptor_Consistency(t *testing.T) {
+	prng := NewPrng(42)
+	expected := "MPV/ylRg3oklD34p22neAnog+p9F5WwH1Mzn6E08n3dSTdDufbgZ9ALx5su6" +
+		"+iP7tY8yIquoABwELG7TT5abvhnA6e1H49ZUJKiq++dTtd4y0/1gsSE7+w=="
+
+	key, err := NewTransferKey(prng)
+	if err != nil {
+		t.Fatalf("Failed to generate transfer key: %+v", err)
+	}
+	fileData := make([]byte, 40)
+	_, _ = prng.Read(fileData)
+
+	var buff bytes.Buffer
+	s, err := NewStreamEncryptor(&buff, key, 16)
+	if err != nil {
+		t.Fatalf("Failed to create stream encryptor: %+v", err)
+	}
+	if _, err = s.Write(fileData); err != nil {
+		t.Fatalf("Failed to write: %+v", err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatalf("Failed to close: %+v", err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(buff.Bytes())
+	if encoded != expected {
+		t.Errorf("Encrypted stream does not match expected."+
+			"\nexpected: %s\nreceived: %s", expected, encoded)
+	}
+}
+
+// Tests that a file encrypted with StreamEncryptor in writes of various sizes
+// is decrypted by StreamDecryptor, that the parts line up with
+// NumStreamParts, and that the transfer MAC matches CreateTransferMAC.
+func TestStreamEncryptor_StreamDecryptor(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	const partSize = 64
+
+	for _, fileSize := range []int{0, 1, partSize - 1, partSize, partSize + 1,
+		3 * partSize, 10*partSize + 7} {
+		var key TransferKey
+		prng.Read(key[:])
+		fileData := make([]byte, fileSize)
+		prng.Read(fileData)
+
+		var buff bytes.Buffer
+		s, err := NewStreamEncryptor(&buff, key, partSize)
+		if err != nil {
+			t.Fatalf("Failed to create stream encryptor: %+v", err)
+		}
+		for data := fileData; len(data) > 0; {
+			n := prng.Intn(2*partSize) + 1
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err = s.Write(data[:n]); err != nil {
+				t.Fatalf("Failed to write %d bytes: %+v", n, err)
+			}
+			data = data[n:]
+		}
+		if err = s.Close(); err != nil {
+			t.Fatalf("Failed to close: %+v", err)
+		}
+
+		numParts := NumStreamParts(fileSize, partSize)
+		if int(s.NumParts()) != numParts {
+			t.Errorf("Incorrect number of parts for %d bytes."+
+				"\nexpected: %d\nreceived: %d", fileSize, numParts, s.NumParts())
+		}
+		expectedLen := fileSize + numParts*StreamPartOverhead
+		if buff.Len() != expectedLen {
+			t.Errorf("Incorrect encrypted length for %d bytes."+
+				"\nexpected: %d\nreceived: %d", fileSize, expectedLen, buff.Len())
+		}
+
+		transferMAC := CreateTransferMAC(fileData, key)
+		if !bytes.Equal(s.TransferMAC(), transferMAC) {
+			t.Errorf("Encryptor transfer MAC does not match for %d bytes."+
+				"\nexpected: %v\nreceived: %v",
+				fileSize, transferMAC, s.TransferMAC())
+		}
+
+		d, err := NewStreamDecryptor(&buff, key, partSize)
+		if err != nil {
+			t.Fatalf("Failed to create stream decryptor: %+v", err)
+		}
+		decrypted, err := io.ReadAll(d)
+		if err != nil {
+			t.Fatalf("Failed to decrypt %d bytes: %+v", fileSize, err)
+		}
+		if !bytes.Equal(decrypted, fileData) {
+			t.Errorf("Decrypted file does not match original for %d bytes."+
+				"\nexpected: %v\nreceived: %v", fileSize, fileData, decrypted)
+		}
+		if !d.VerifyTransferMAC(transferMAC) {
+			t.Errorf("Decryptor failed to verify transfer MAC for %d bytes.",
+				fileSize)
+		}
+	}
+}
+
+// Tests that each encrypted part can be decrypted on its own with the key and
+// nonce of its fingerprint number.
+func TestStreamEncryptor_PartBoundaries(t *testing.T) {
+	prng := NewPrng(42)
+	key, err := NewTransferKey(prng)
+	if err != nil {
+		t.Fatalf("Failed to generate transfer key: %+v", err)
+	}
+	const partSize = 32
+	fileData := make([]byte, 5*partSize-3)
+	_, _ = prng.Read(fileData)
+
+	var buff bytes.Buffer
+	s, _ := NewStreamEncryptor(&buff, key, partSize)
+	_, _ = s.Write(fileData)
+	_ = s.Close()
+
+	fps := GenerateFingerprints(key, s.NumParts())
+	encrypted := buff.Bytes()
+	for i, fp := range fps {
+		ad := streamPartAD
+		end := (i + 1) * (partSize + StreamPartOverhead)
+		if i == len(fps)-1 {
+			ad = streamLastPartAD
+			end = len(encrypted)
+		}
+
+		aead, nonce := newStreamPartCipher(key, uint16(i))
+		if !bytes.Equal(nonce, fp[:len(nonce)]) {
+			t.Errorf("Nonce of part %d is not from its fingerprint.", i)
+		}
+		part, err := aead.Open(
+			nil, nonce, encrypted[i*(partSize+StreamPartOverhead):end], ad)
+		if err != nil {
+			t.Fatalf("Failed to open part %d: %+v", i, err)
+		}
+		if !bytes.Equal(part, fileData[i*partSize:i*partSize+len(part)]) {
+			t.Errorf("Part %d does not match the file data.", i)
+		}
+	}
+}
+
+// Error path: tests that StreamDecryptor returns an error when the stream is
+// modified, truncated, extended, or has its parts reordered.
+func TestStreamDecryptor_Read_Tampered(t *testing.T) {
+	prng := NewPrng(42)
+	key, err := NewTransferKey(prng)
+	if err != nil {
+		t.Fatalf("Failed to generate transfer key: %+v", err)
+	}
+	const partSize = 32
+	const encPartSize = partSize + StreamPartOverhead
+	fileData := make([]byte, 3*partSize)
+	_, _ = prng.Read(fileData)
+
+	var buff bytes.Buffer
+	s, _ := NewStreamEncryptor(&buff, key, partSize)
+	_, _ = s.Write(fileData)
+	_ = s.Close()
+	encrypted := buff.Bytes()
+
+	flipped := append([]byte{}, encrypted...)
+	flipped[encPartSize+5] ^= 1
+	reordered := append(append(append([]byte{},
+		encrypted[encPartSize:2*encPartSize]...),
+		encrypted[:encPartSize]...), encrypted[2*encPartSize:]...)
+
+	tests := map[string][]byte{
+		"modified":           flipped,
+		"truncated at part":  encrypted[:2*encPartSize],
+		"truncated mid part": encrypted[:2*encPartSize+10],
+		"extended":           append(append([]byte{}, encrypted...), 0),
+		"reordered":          reordered,
+		"empty":              {},
+		"shorter than a tag": encrypted[:StreamPartOverhead-1],
+		"first part removed": encrypted[encPartSize:],
+	}
+
+	for name, data := range tests {
+		d, _ := NewStreamDecryptor(bytes.NewReader(data), key, partSize)
+		if _, err = io.ReadAll(d); err == nil {
+			t.Errorf("Failed to get error for %s stream.", name)
+		}
+	}
+}
+
+// Error path: tests that a stream with more parts than there are fingerprint
+// numbers cannot be written.
+func TestStreamEncryptor_Write_TooManyParts(t *testing.T) {
+	var key TransferKey
+	s, _ := NewStreamEncryptor(io.Discard, key, 1)
+	n, err := s.Write(make([]byte, maxParts))
+	if err != nil || n != maxParts {
+		t.Fatalf("Failed to write %d parts (%d bytes written): %+v",
+			maxParts, n, err)
+	}
+
+	// The last part is only written on Close, since until then it may
+	// still be the last part
+	if _, err = s.Write([]byte{0}); err != nil {
+		t.Fatalf("Failed to write part %d: %+v", maxParts-1, err)
+	}
+	if err = s.Close(); err == nil {
+		t.Errorf("Failed to get error for part %d.", maxParts)
+	}
+}
+
+// Error path: tests that StreamEncryptor cannot be written to after Close and
+// that a non-positive part size is rejected.
+func TestStreamEncryptor_Errors(t *testing.T) {
+	var key TransferKey
+	s, _ := NewStreamEncryptor(io.Discard, key, 16)
+	_ = s.Close()
+	if _, err := s.Write([]byte{1}); err == nil {
+		t.Errorf("Failed to get error writing to closed stream.")
+	}
+
+	if _, err := NewStreamEncryptor(io.Discard, key, 0); err == nil {
+		t.Errorf("Failed to get error for part size 0.")
+	}
+	if _, err := NewStreamDecryptor(bytes.NewReader(nil), key, -1); err == nil {
+		t.Errorf("Failed to get error for part size -1.")
+	}
+}
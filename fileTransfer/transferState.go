@@ -0,0 +1,344 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package fileTransfer contains all cryptographic functions pertaining to the
+// transfer of large (MB) files over the xx network. It is designed to use
+// standard end-to-end encryption. However, it is separated from package e2e to
+// ensure encryption keys are not shared between the two systems to avoiding key
+// exhaustion.
+
+// transferState.go contains logic pertaining to the persistent state of an
+// in-progress file transfer.
+
+package fileTransfer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/bits"
+
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/primitives/format"
+
+	"gitlab.com/elixxir/crypto/indexedDb"
+)
+
+// transferStateVersion is the version of the marshalled TransferState.
+const transferStateVersion = 0
+
+// transferStateHeaderLen is the length of the marshalled TransferState before
+// the transfer MAC and bitmaps: version, transfer ID, transfer key, number of
+// parts, and length of the transfer MAC.
+const transferStateHeaderLen = 1 + TransferIdLength + TransferKeyLength + 2 + 1
+
+// Error messages.
+const (
+	// NewTransferState
+	stateNumPartsErr = "number of parts must be at least 1"
+	stateMacLenErr   = "transfer MAC cannot be longer than %d bytes; received %d"
+
+	// TransferState.MarkReceived, TransferState.MarkVerified
+	stateFpNumErr = "fingerprint number %d is not in transfer of %d parts"
+
+	// UnmarshalTransferState
+	stateDataLenErr    = "data must be %d bytes; received %d bytes"
+	stateVersionErr    = "unsupported transfer state version %d; expected %d"
+	stateBitmapErr     = "bitmap has bits set past the last of %d parts"
+	stateUnreceivedErr = "part %d is verified but not received"
+
+	// TransferState.Encrypt
+	stateEncryptErr = "failed to encrypt transfer state: %+v"
+
+	// DecryptTransferState
+	stateDecryptErr = "failed to decrypt transfer state: %+v"
+)
+
+// TransferState is the state of an in-progress file transfer that can be
+// saved so that the transfer can be resumed after a restart. It tracks which
+// parts, by fingerprint number, have been received and which have been
+// verified, such as with VerifyMerklePart or once the transfer MAC matches.
+// The fingerprints of the parts that have not yet been received can be
+// regenerated from the state.
+//
+// A TransferState is not safe for concurrent use.
+type TransferState struct {
+	tid         TransferID
+	key         TransferKey
+	numParts    uint16
+	transferMAC []byte
+
+	// received and verified are bitmaps of the fingerprint numbers.
+	received []byte
+	verified []byte
+}
+
+// NewTransferState creates the state of a new transfer of the given number of
+// parts with no parts received. The transfer MAC may be nil if it is not yet
+// known.
+func NewTransferState(tid TransferID, key TransferKey, numParts uint16,
+	transferMAC []byte) (*TransferState, error) {
+	if numParts == 0 {
+		return nil, errors.New(stateNumPartsErr)
+	} else if len(transferMAC) > 0xFF {
+		return nil, errors.Errorf(stateMacLenErr, 0xFF, len(transferMAC))
+	}
+
+	bitmapLen := transferStateBitmapLen(numParts)
+	return &TransferState{
+		tid:         tid,
+		key:         key,
+		numParts:    numParts,
+		transferMAC: append([]byte{}, transferMAC...),
+		received:    make([]byte, bitmapLen),
+		verified:    make([]byte, bitmapLen),
+	}, nil
+}
+
+// TransferID returns the ID of the transfer.
+func (ts *TransferState) TransferID() TransferID {
+	return ts.tid
+}
+
+// TransferKey returns the key of the transfer.
+func (ts *TransferState) TransferKey() TransferKey {
+	return ts.key
+}
+
+// NumParts returns the number of parts in the transfer.
+func (ts *TransferState) NumParts() uint16 {
+	return ts.numParts
+}
+
+// TransferMAC returns the MAC of the whole file, as sent by the sender.
+func (ts *TransferState) TransferMAC() []byte {
+	return ts.transferMAC
+}
+
+// MarkReceived marks the part with the given fingerprint number as received.
+// Returns an error if the fingerprint number is not part of the transfer.
+func (ts *TransferState) MarkReceived(fpNum uint16) error {
+	if fpNum >= ts.numParts {
+		return errors.Errorf(stateFpNumErr, fpNum, ts.numParts)
+	}
+	setBit(ts.received, fpNum)
+	return nil
+}
+
+// MarkVerified marks the part with the given fingerprint number as received
+// and verified. Returns an error if the fingerprint number is not part of the
+// transfer.
+func (ts *TransferState) MarkVerified(fpNum uint16) error {
+	if err := ts.MarkReceived(fpNum); err != nil {
+		return err
+	}
+	setBit(ts.verified, fpNum)
+	return nil
+}
+
+// IsReceived returns true if the part with the given fingerprint number has
+// been received.
+func (ts *TransferState) IsReceived(fpNum uint16) bool {
+	return fpNum < ts.numParts && getBit(ts.received, fpNum)
+}
+
+// IsVerified returns true if the part with the given fingerprint number has
+// been verified.
+func (ts *TransferState) IsVerified(fpNum uint16) bool {
+	return fpNum < ts.numParts && getBit(ts.verified, fpNum)
+}
+
+// NumReceived returns the number of parts that have been received.
+func (ts *TransferState) NumReceived() uint16 {
+	return countBits(ts.received)
+}
+
+// NumVerified returns the number of parts that have been verified.
+func (ts *TransferState) NumVerified() uint16 {
+	return countBits(ts.verified)
+}
+
+// IsComplete returns true if every part has been verified.
+func (ts *TransferState) IsComplete() bool {
+	return ts.NumVerified() == ts.numParts
+}
+
+// MissingFpNums returns the fingerprint numbers of the parts that have not
+// been received, in ascending order.
+func (ts *TransferState) MissingFpNums() []uint16 {
+	missing := make([]uint16, 0, ts.numParts-ts.NumReceived())
+	for fpNum := uint16(0); fpNum < ts.numParts; fpNum++ {
+		if !getBit(ts.received, fpNum) {
+			missing = append(missing, fpNum)
+		}
+	}
+	return missing
+}
+
+// MissingFingerprints regenerates the fingerprints of the parts that have not
+// been received, using GenerateFingerprint. The returned map goes from each
+// fingerprint to its fingerprint number, so that the fingerprints can be
+// registered again when resuming the transfer.
+func (ts *TransferState) MissingFingerprints() map[format.Fingerprint]uint16 {
+	missing := ts.MissingFpNums()
+	fps := make(map[format.Fingerprint]uint16, len(missing))
+	for _, fpNum := range missing {
+		fps[GenerateFingerprint(ts.key, fpNum)] = fpNum
+	}
+	return fps
+}
+
+// Marshal serialises the TransferState into a byte slice.
+//
+// Marshalled format:
+//
+//	+---------+-------------+--------------+-----------+---------+
+//	| version | transfer ID | transfer key | num parts | MAC len |
+//	| 1 byte  |  32 bytes   |   32 bytes   |  2 bytes  | 1 byte  |
+//	+---------+-------------+--------------+-----------+---------+
+//	+--------------+-----------------+-----------------+
+//	| transfer MAC | received bitmap | verified bitmap |
+//	|   MAC len    | ⌈parts/8⌉ bytes | ⌈parts/8⌉ bytes |
+//	+--------------+-----------------+-----------------+
+func (ts *TransferState) Marshal() []byte {
+	b := make([]byte, 0, transferStateHeaderLen+len(ts.transferMAC)+
+		2*len(ts.received))
+	b = append(b, transferStateVersion)
+	b = append(b, ts.tid[:]...)
+	b = append(b, ts.key[:]...)
+	b = binary.LittleEndian.AppendUint16(b, ts.numParts)
+	b = append(b, byte(len(ts.transferMAC)))
+	b = append(b, ts.transferMAC...)
+	b = append(b, ts.received...)
+	b = append(b, ts.verified...)
+	return b
+}
+
+// UnmarshalTransferState deserializes the byte slice into a TransferState.
+func UnmarshalTransferState(b []byte) (*TransferState, error) {
+	if len(b) < transferStateHeaderLen {
+		return nil, errors.Errorf(
+			stateDataLenErr, transferStateHeaderLen, len(b))
+	} else if b[0] != transferStateVersion {
+		return nil, errors.Errorf(
+			stateVersionErr, b[0], transferStateVersion)
+	}
+
+	ts := &TransferState{}
+	offset := 1
+	copy(ts.tid[:], b[offset:])
+	offset += TransferIdLength
+	copy(ts.key[:], b[offset:])
+	offset += TransferKeyLength
+	ts.numParts = binary.LittleEndian.Uint16(b[offset:])
+	offset += 2
+	macLen := int(b[offset])
+	offset++
+
+	bitmapLen := transferStateBitmapLen(ts.numParts)
+	expectedLen := transferStateHeaderLen + macLen + 2*bitmapLen
+	if ts.numParts == 0 {
+		return nil, errors.New(stateNumPartsErr)
+	} else if len(b) != expectedLen {
+		return nil, errors.Errorf(stateDataLenErr, expectedLen, len(b))
+	}
+
+	ts.transferMAC = append([]byte{}, b[offset:offset+macLen]...)
+	offset += macLen
+	ts.received = append([]byte{}, b[offset:offset+bitmapLen]...)
+	offset += bitmapLen
+	ts.verified = append([]byte{}, b[offset:offset+bitmapLen]...)
+
+	// Only the bits of existing parts may be set
+	if extra := uint(bitmapLen*8 - int(ts.numParts)); extra > 0 {
+		mask := byte(0xFF) << (8 - extra)
+		if ts.received[bitmapLen-1]&mask != 0 ||
+			ts.verified[bitmapLen-1]&mask != 0 {
+			return nil, errors.Errorf(stateBitmapErr, ts.numParts)
+		}
+	}
+
+	// A part can only be verified once it is received
+	for i := range ts.verified {
+		if unreceived := ts.verified[i] &^ ts.received[i]; unreceived != 0 {
+			fpNum := i*8 + bits.TrailingZeros8(unreceived)
+			return nil, errors.Errorf(stateUnreceivedErr, fpNum)
+		}
+	}
+
+	return ts, nil
+}
+
+// Encrypt marshals the TransferState and encrypts it with the given database
+// cipher. The marshalled state grows by 2 bits per part. A cipher with
+// indexedDb.FixedPadding, such as one from indexedDb.NewCipher, must have a
+// block size that fits it, while a cipher with a bucketed padding policy splits
+// larger states into chunks.
+func (ts *TransferState) Encrypt(c indexedDb.Cipher) (string, error) {
+	ciphertext, err := c.Encrypt(ts.Marshal())
+	if err != nil {
+		return "", errors.Errorf(stateEncryptErr, err)
+	}
+	return ciphertext, nil
+}
+
+// DecryptTransferState decrypts a TransferState encrypted with
+// TransferState.Encrypt.
+func DecryptTransferState(
+	ciphertext string, c indexedDb.Cipher) (*TransferState, error) {
+	data, err := c.Decrypt(ciphertext)
+	if err != nil {
+		return nil, errors.Errorf(stateDecryptErr, err)
+	}
+	return UnmarshalTransferState(data)
+}
+
+// MarshalJSON adheres to the [json.Marshaler] interface.
+func (ts *TransferState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ts.Marshal())
+}
+
+// UnmarshalJSON adheres to the [json.Unmarshaler] interface.
+func (ts *TransferState) UnmarshalJSON(b []byte) error {
+	var buff []byte
+	if err := json.Unmarshal(b, &buff); err != nil {
+		return err
+	}
+
+	newState, err := UnmarshalTransferState(buff)
+	if err != nil {
+		return err
+	}
+
+	*ts = *newState
+	return nil
+}
+
+// transferStateBitmapLen returns the number of bytes in a bitmap of the given
+// number of parts.
+func transferStateBitmapLen(numParts uint16) int {
+	return (int(numParts) + 7) / 8
+}
+
+// setBit sets the bit for the fingerprint number in the bitmap.
+func setBit(bitmap []byte, fpNum uint16) {
+	bitmap[fpNum/8] |= 1 << (fpNum % 8)
+}
+
+// getBit returns true if the bit for the fingerprint number is set in the
+// bitmap.
+func getBit(bitmap []byte, fpNum uint16) bool {
+	return bitmap[fpNum/8]&(1<<(fpNum%8)) != 0
+}
+
+// countBits returns the number of set bits in the bitmap.
+func countBits(bitmap []byte) uint16 {
+	var n int
+	for _, b := range bitmap {
+		n += bits.OnesCount8(b)
+	}
+	return uint16(n)
+}
@@ -0,0 +1,234 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package fileTransfer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gitlab.com/xx_network/crypto/csprng"
+
+	"gitlab.com/elixxir/crypto/indexedDb"
+)
+
+// newTestTransferState creates a TransferState with the given number of parts
+// for testing.
+func newTestTransferState(numParts uint16, t *testing.T) *TransferState {
+	prng := NewPrng(42)
+	tid, _ := NewTransferID(prng)
+	key, _ := NewTransferKey(prng)
+	ts, err := NewTransferState(
+		tid, key, numParts, CreateTransferMAC([]byte("file"), key))
+	if err != nil {
+		t.Fatalf("Failed to create transfer state: %+v", err)
+	}
+	return ts
+}
+
+// Tests that TransferState tracks received and verified parts and that
+// TransferState.MissingFingerprints regenerates the fingerprints of exactly
+// the missing parts.
+func TestTransferState_MarkReceived_MissingFingerprints(t *testing.T) {
+	const numParts = 20
+	ts := newTestTransferState(numParts, t)
+
+	if len(ts.MissingFpNums()) != numParts {
+		t.Errorf("New state is not missing every part.")
+	}
+
+	for _, fpNum := range []uint16{0, 3, 8, 19} {
+		if err := ts.MarkReceived(fpNum); err != nil {
+			t.Errorf("Failed to mark part %d received: %+v", fpNum, err)
+		}
+	}
+	for _, fpNum := range []uint16{3, 9} {
+		if err := ts.MarkVerified(fpNum); err != nil {
+			t.Errorf("Failed to mark part %d verified: %+v", fpNum, err)
+		}
+	}
+
+	if ts.NumReceived() != 5 || ts.NumVerified() != 2 {
+		t.Errorf("Incorrect counts.\nexpected: 5 received, 2 verified"+
+			"\nreceived: %d received, %d verified",
+			ts.NumReceived(), ts.NumVerified())
+	}
+	if !ts.IsReceived(9) || !ts.IsVerified(9) || ts.IsVerified(0) ||
+		ts.IsReceived(1) || ts.IsReceived(numParts) {
+		t.Errorf("Incorrect part status.")
+	}
+
+	fps := ts.MissingFingerprints()
+	if len(fps) != numParts-5 {
+		t.Errorf("Incorrect number of missing fingerprints."+
+			"\nexpected: %d\nreceived: %d", numParts-5, len(fps))
+	}
+	for i, fp := range GenerateFingerprints(ts.TransferKey(), numParts) {
+		fpNum, exists := fps[fp]
+		if exists == ts.IsReceived(uint16(i)) {
+			t.Errorf("Fingerprint %d missing: %t; received: %t",
+				i, exists, ts.IsReceived(uint16(i)))
+		} else if exists && int(fpNum) != i {
+			t.Errorf("Fingerprint %d maps to wrong number %d.", i, fpNum)
+		}
+	}
+
+	if ts.IsComplete() {
+		t.Errorf("Transfer is complete before all parts are verified.")
+	}
+	for fpNum := uint16(0); fpNum < numParts; fpNum++ {
+		_ = ts.MarkVerified(fpNum)
+	}
+	if !ts.IsComplete() || len(ts.MissingFingerprints()) != 0 {
+		t.Errorf("Transfer is not complete after all parts are verified.")
+	}
+}
+
+// Error path: tests that parts outside the transfer cannot be marked and that
+// a transfer must have parts.
+func TestTransferState_Errors(t *testing.T) {
+	ts := newTestTransferState(10, t)
+	if err := ts.MarkReceived(10); err == nil {
+		t.Errorf("Failed to get error for part past the end.")
+	}
+	if err := ts.MarkVerified(10); err == nil {
+		t.Errorf("Failed to get error for part past the end.")
+	}
+
+	if _, err := NewTransferState(ts.TransferID(), ts.TransferKey(), 0,
+		nil); err == nil {
+		t.Errorf("Failed to get error for zero parts.")
+	}
+}
+
+// Tests that a TransferState marshalled with TransferState.Marshal and
+// unmarshalled with UnmarshalTransferState, and through JSON, matches the
+// original.
+func TestTransferState_Marshal_UnmarshalTransferState(t *testing.T) {
+	for _, numParts := range []uint16{1, 8, 13, 0xFFFF} {
+		ts := newTestTransferState(numParts, t)
+		for fpNum := uint16(0); fpNum < numParts; fpNum += 3 {
+			_ = ts.MarkReceived(fpNum)
+		}
+		_ = ts.MarkVerified(numParts - 1)
+
+		newTs, err := UnmarshalTransferState(ts.Marshal())
+		if err != nil {
+			t.Fatalf("Failed to unmarshal %d parts: %+v", numParts, err)
+		}
+		if !reflect.DeepEqual(ts, newTs) {
+			t.Errorf("Unmarshalled state with %d parts does not match "+
+				"original.\nexpected: %+v\nreceived: %+v", numParts, ts, newTs)
+		}
+
+		data, err := json.Marshal(ts)
+		if err != nil {
+			t.Fatalf("Failed to JSON marshal: %+v", err)
+		}
+		jsonTs := &TransferState{}
+		if err = json.Unmarshal(data, jsonTs); err != nil {
+			t.Fatalf("Failed to JSON unmarshal: %+v", err)
+		}
+		if !reflect.DeepEqual(ts, jsonTs) {
+			t.Errorf("JSON unmarshalled state with %d parts does not match "+
+				"original.\nexpected: %+v\nreceived: %+v", numParts, ts, jsonTs)
+		}
+	}
+}
+
+// Error path: tests that UnmarshalTransferState rejects invalid data.
+func TestUnmarshalTransferState_Invalid(t *testing.T) {
+	data := newTestTransferState(13, t).Marshal()
+
+	wrongVersion := append([]byte{}, data...)
+	wrongVersion[0] = transferStateVersion + 1
+	extraBit := append([]byte{}, data...)
+	extraBit[len(extraBit)-1] |= 0x80
+	zeroParts := append([]byte{}, data...)
+	zeroParts[1+TransferIdLength+TransferKeyLength] = 0
+	zeroParts[2+TransferIdLength+TransferKeyLength] = 0
+	unreceived := append([]byte{}, data...)
+	unreceived[len(unreceived)-1] |= 0x01
+
+	tests := map[string][]byte{
+		"empty":         {},
+		"short":         data[:len(data)-1],
+		"long":          append(append([]byte{}, data...), 0),
+		"wrong version": wrongVersion,
+		"extra bit":     extraBit,
+		"zero parts":    zeroParts,
+		"unreceived":    unreceived,
+	}
+
+	for name, b := range tests {
+		if _, err := UnmarshalTransferState(b); err == nil {
+			t.Errorf("Failed to get error for %s data.", name)
+		}
+	}
+}
+
+// Tests that a TransferState encrypted with TransferState.Encrypt is decrypted
+// by DecryptTransferState and can resume the transfer.
+func TestTransferState_Encrypt_DecryptTransferState(t *testing.T) {
+	ts := newTestTransferState(1000, t)
+	_ = ts.MarkVerified(5)
+	_ = ts.MarkReceived(999)
+
+	c, err := indexedDb.NewCipher([]byte("password"), []byte("salt"), 512,
+		csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	ciphertext, err := ts.Encrypt(c)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+
+	newTs, err := DecryptTransferState(ciphertext, c)
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %+v", err)
+	}
+	if !reflect.DeepEqual(ts, newTs) {
+		t.Errorf("Decrypted state does not match original."+
+			"\nexpected: %+v\nreceived: %+v", ts, newTs)
+	}
+	if !reflect.DeepEqual(
+		ts.MissingFingerprints(), newTs.MissingFingerprints()) {
+		t.Errorf("Decrypted state has different missing fingerprints.")
+	}
+
+	// A state too large for the block size
+	if _, err = newTestTransferState(0xFFFF, t).Encrypt(c); err == nil {
+		t.Errorf("Failed to get error for state larger than block size.")
+	}
+
+	// A state larger than the block size is split into chunks by a cipher with
+	// a bucketed padding policy
+	padded, err := indexedDb.NewCipherWithPadding([]byte("password"),
+		[]byte("salt"), indexedDb.PadmePadding, 512, csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create padded cipher: %+v", err)
+	}
+	large := newTestTransferState(0xFFFF, t)
+	ciphertext, err = large.Encrypt(padded)
+	if err != nil {
+		t.Fatalf("Failed to encrypt large state: %+v", err)
+	}
+	if newTs, err = DecryptTransferState(ciphertext, padded); err != nil {
+		t.Errorf("Failed to decrypt large state: %+v", err)
+	} else if !reflect.DeepEqual(large, newTs) {
+		t.Errorf("Decrypted large state does not match original.")
+	}
+
+	other, _ := indexedDb.NewCipher([]byte("other"), []byte("salt"), 512,
+		csprng.NewSystemRNG())
+	if _, err = DecryptTransferState(ciphertext, other); err == nil {
+		t.Errorf("Failed to get error decrypting with the wrong cipher.")
+	}
+}
@@ -0,0 +1,45 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package indexedDb
+
+import (
+	"github.com/Max-Sum/base32768"
+	"golang.org/x/crypto/blake2b"
+)
+
+// blindIndexKeyVector separates the blind index key from the encryption key,
+// which are both derived from the database secret.
+const blindIndexKeyVector = "IndexedDbBlindIndexKey"
+
+// BlindIndex returns a deterministic keyed hash of the value for the given
+// column. Unlike Encrypt, the same value in the same column always gives the
+// same index, so it can be stored alongside the ciphertext and used to look the
+// value up by equality. Each column is hashed with its own key, so equal
+// values in different columns do not give equal indexes.
+//
+// The index reveals which rows of a column hold equal values, and so should
+// only be used on columns that must be searched, such as channel or message
+// IDs.
+func (c *cipher) BlindIndex(column string, value []byte) string {
+	mac, _ := blake2b.New256(deriveColumnKey(c.secret, column))
+	mac.Write(value)
+	return base32768.SafeEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// deriveColumnKey derives the blind index key of the column from the database
+// secret using keyed blake2b, first separating it from the encryption key and
+// then from the keys of the other columns.
+func deriveColumnKey(secret []byte, column string) []byte {
+	mac, _ := blake2b.New256(secret)
+	mac.Write([]byte(blindIndexKeyVector))
+	indexKey := mac.Sum(nil)
+
+	mac, _ = blake2b.New256(indexKey)
+	mac.Write([]byte(column))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,88 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package indexedDb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/Max-Sum/base32768"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Consistency test: tests that Cipher.BlindIndex returns the expected index.
+func TestCipher_BlindIndex_Consistency(t *testing.T) {
+	c, err := NewCipher([]byte("test123"), []byte("salt"), 50,
+		csprng.NewSystemRNG())
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	expected := "vvc+FDXKmBeCK75z64CnVOfKDkDsIXp6IHhbBQP5W+0="
+	decoded, err := base32768.SafeEncoding.DecodeString(
+		c.BlindIndex("channelID", []byte("channel")))
+	if err != nil {
+		t.Fatalf("Failed to decode index: %+v", err)
+	}
+	index := base64.StdEncoding.EncodeToString(decoded)
+	if index != expected {
+		t.Errorf("Blind index does not match expected."+
+			"\nexpected: %s\nreceived: %s", expected, index)
+	}
+}
+
+// Tests that Cipher.BlindIndex returns the same index for the same value and
+// column, including after the cipher is JSON marshalled and unmarshalled, and
+// different indexes for different values, columns, and secrets.
+func TestCipher_BlindIndex(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	c, err := NewCipher([]byte("test123"), []byte("salt"), 50, rng)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	index := c.BlindIndex("channelID", []byte("channel"))
+	if index != c.BlindIndex("channelID", []byte("channel")) {
+		t.Errorf("Same value in the same column gave different indexes.")
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Failed to JSON marshal cipher: %+v", err)
+	}
+	loaded, err := NewCipherFromJSON(data, rng)
+	if err != nil {
+		t.Fatalf("Failed to JSON unmarshal cipher: %+v", err)
+	}
+	if index != loaded.BlindIndex("channelID", []byte("channel")) {
+		t.Errorf("Unmarshalled cipher gave a different index.")
+	}
+
+	other, err := NewCipher([]byte("test123"), []byte("pepper"), 50, rng)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+
+	different := map[string]string{
+		"value":  c.BlindIndex("channelID", []byte("channel2")),
+		"column": c.BlindIndex("messageID", []byte("channel")),
+		"secret": other.BlindIndex("channelID", []byte("channel")),
+		"empty":  c.BlindIndex("channelID", nil),
+	}
+	for name, differentIndex := range different {
+		if differentIndex == index {
+			t.Errorf("Index with different %s matches.", name)
+		}
+	}
+
+	// The index must not be the encryption of the value
+	if _, err = c.Decrypt(index); err == nil {
+		t.Errorf("Blind index decrypted as a ciphertext.")
+	}
+}
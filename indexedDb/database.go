@@ -16,7 +16,9 @@ import (
 	"github.com/Max-Sum/base32768"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/crypto/backup"
 	"gitlab.com/elixxir/crypto/hash"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/blake2b"
 	"golang.org/x/crypto/chacha20poly1305"
 )
@@ -27,6 +29,21 @@ const (
 	// NewCipher
 	cipherInvalidBlockSizeErr = "block size must be at least 1 byte; received %d bytes"
 
+	// NewCipherWithPadding
+	cipherInvalidPaddingErr = "invalid padding policy %s"
+	cipherBucketSizeErr     = "block size must be at most %d bytes for %s " +
+		"padding; received %d bytes"
+
+	// NewCipherWithParams
+	cipherSaltLenErr       = "salt must be at least %d bytes; received %d bytes"
+	cipherInvalidParamsErr = "Argon2 time and threads must be at least 1; " +
+		"received time %d and threads %d"
+
+	// NewCipherFromJSON, NewCipherFromJSONWithPassword
+	cipherPasswordRequiredErr = "key is derived from a password; use " +
+		"NewCipherFromJSONWithPassword"
+	cipherNoKDFErr = "key is not derived from a password; use NewCipherFromJSON"
+
 	// cipher.Encrypt
 	plaintextTooLargeErr = "plaintext must be %d bytes or less; received %d bytes"
 	generateNoncePanic   = "Could not generate nonce for channel database message encryption: %+v"
@@ -53,17 +70,27 @@ type Cipher interface {
 	// includes the nonce (24 bytes) and the encrypted plaintext
 	// (with possible padding, if needed).
 	//
-	// Prior to encrypting the plaintext, a padding will be appended if it is
-	// shorter than the pre-defined block size passed into NewCipher.
+	// Prior to encrypting the plaintext, a padding will be appended to pad it
+	// to the length chosen by the cipher's PaddingPolicy. By default, it is
+	// padded to the pre-defined block size passed into NewCipher.
 	//
 	// If the plaintext is longer than the block size, then Encrypt will return
-	// an error.
+	// an error, unless the cipher uses a bucketed PaddingPolicy, in which case
+	// the plaintext is split into chunks of the block size that are each
+	// padded and encrypted.
 	Encrypt(plainText []byte) (cipherText string, err error)
 
 	// Decrypt decrypts the given encoded ciphertext and returns the plaintext.
 	// Any padding added to the plaintext during encryption is stripped.
 	Decrypt(cipherText string) (plainText []byte, err error)
 
+	// BlindIndex returns a deterministic keyed hash of the value for the given
+	// column. Unlike Encrypt, the same value in the same column always gives
+	// the same index, so it can be stored alongside the ciphertext and used
+	// to look the value up by equality. Each column is hashed with its own
+	// key, so equal values in different columns do not give equal indexes.
+	BlindIndex(column string, value []byte) string
+
 	// Marshaler marshals the cryptographic information in the cypher for
 	// sending over the wire.
 	json.Marshaler
@@ -75,16 +102,28 @@ type Cipher interface {
 
 // cipher adheres to the Cipher interface.
 type cipher struct {
-	// secret is derived using deriveDatabaseSecret.
+	// secret is derived using deriveDatabaseSecret or, for a cipher created
+	// with NewCipherWithParams, deriveDatabaseSecretArgon2.
 	secret []byte
 
+	// kdf is the salt and Argon2 parameters the secret was derived with. It is
+	// nil for a cipher created with NewCipher.
+	kdf *cipherKDF
+
 	// blockSize is the maximum allowed length of the plaintext.
 	//
 	// Any plaintext that is shorter is padded to the length of blockSize so
 	// that all encrypted data is of the same length. Any plaintext that is
 	// longer is rejected.
+	//
+	// With a bucketed padding policy, blockSize is instead the largest
+	// bucket. Longer plaintexts are split into chunks of blockSize.
 	blockSize int
 
+	// padding is the policy that selects the length that each plaintext is
+	// padded to.
+	padding PaddingPolicy
+
 	// rng is the random number generator that is used to generate a nonce while
 	// encrypting.
 	rng io.Reader
@@ -109,44 +148,172 @@ func NewCipher(internalPassword, salt []byte, plaintextBlockSize int,
 	}, nil
 }
 
+// NewCipherWithPadding generates a new Cipher from a password and salt that
+// pads plaintexts according to the given PaddingPolicy. With a bucketed
+// policy, the length of a ciphertext reveals only the bucket of its plaintext,
+// and plaintexts longer than the largest bucket are split into chunks of the
+// block size, so that the length of a ciphertext reveals only the number of
+// chunks and the bucket of the last chunk.
+//
+// plaintextBlockSize is the largest bucket. For FixedPadding, it is the maximum
+// allowed length of any encrypted plaintext, as with NewCipher.
+func NewCipherWithPadding(internalPassword, salt []byte, padding PaddingPolicy,
+	plaintextBlockSize int, csprng io.Reader) (Cipher, error) {
+	if err := checkCipherParams(padding, plaintextBlockSize); err != nil {
+		return nil, err
+	}
+
+	return &cipher{
+		secret:    deriveDatabaseSecret(internalPassword, salt),
+		blockSize: plaintextBlockSize,
+		padding:   padding,
+		rng:       csprng,
+	}, nil
+}
+
+// checkCipherParams returns an error if the padding policy is unknown or the
+// block size is invalid for it.
+func checkCipherParams(padding PaddingPolicy, plaintextBlockSize int) error {
+	if !padding.isValid() {
+		return errors.Errorf(cipherInvalidPaddingErr, padding)
+	} else if plaintextBlockSize <= 0 {
+		return errors.Errorf(cipherInvalidBlockSizeErr, plaintextBlockSize)
+	} else if padding != FixedPadding && plaintextBlockSize > maxBucketSize {
+		return errors.Errorf(
+			cipherBucketSizeErr, maxBucketSize, padding, plaintextBlockSize)
+	}
+	return nil
+}
+
+// NewCipherWithParams generates a new Cipher from a user supplied password and
+// salt using Argon2id with the given parameters. Unlike NewCipher, which
+// expects a high entropy internal password, it is meant for databases
+// protected only by a passphrase, where deriving the key must be slow enough to
+// resist offline guessing. The salt should be generated with backup.MakeSalt.
+// Plaintexts are padded according to the PaddingPolicy, as done by
+// NewCipherWithPadding.
+//
+// The salt and parameters are included in the cipher's JSON, but the key is
+// not, so the cipher must be loaded with NewCipherFromJSONWithPassword, which
+// derives the key again from the password.
+//
+// plaintextBlockSize is the largest bucket. For FixedPadding, it is the maximum
+// allowed length of any encrypted plaintext, as with NewCipher.
+func NewCipherWithParams(password, salt []byte, params backup.Params,
+	padding PaddingPolicy, plaintextBlockSize int,
+	csprng io.Reader) (Cipher, error) {
+	if err := checkCipherParams(padding, plaintextBlockSize); err != nil {
+		return nil, err
+	}
+	key, err := deriveDatabaseSecretArgon2(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cipher{
+		secret:    key,
+		kdf:       &cipherKDF{Salt: salt, Params: params},
+		blockSize: plaintextBlockSize,
+		padding:   padding,
+		rng:       csprng,
+	}, nil
+}
+
 // NewCipherFromJSON generates a new Cipher from its marshalled JSON and a
-// CSPRNG.
+// CSPRNG. Returns an error for a cipher created with NewCipherWithParams, whose
+// JSON does not hold the key; use NewCipherFromJSONWithPassword instead.
 func NewCipherFromJSON(data []byte, csprng io.Reader) (Cipher, error) {
 	c := &cipher{rng: csprng}
 	return c, json.Unmarshal(data, &c)
 }
 
+// NewCipherFromJSONWithPassword generates a new Cipher created with
+// NewCipherWithParams from its marshalled JSON, the password, and a CSPRNG. The
+// key is derived again from the password with the salt and parameters in the
+// JSON. A wrong password gives a cipher that cannot decrypt anything the
+// original cipher encrypted.
+func NewCipherFromJSONWithPassword(
+	data, password []byte, csprng io.Reader) (Cipher, error) {
+	var disk cipherDisk
+	if err := json.Unmarshal(data, &disk); err != nil {
+		return nil, err
+	} else if disk.KDF == nil {
+		return nil, errors.New(cipherNoKDFErr)
+	}
+
+	c := newCipherFromDisk(disk)
+	key, err := deriveDatabaseSecretArgon2(
+		password, disk.KDF.Salt, disk.KDF.Params)
+	if err != nil {
+		return nil, err
+	}
+	c.secret = key
+	c.rng = csprng
+	return c, nil
+}
+
 // Encrypt encrypts the raw data. The returned ciphertext is encoded and
 // includes the nonce (24 bytes) and the encrypted plaintext
 // (with possible padding, if needed).
 //
-// Prior to encrypting the plaintext, a padding will be appended if it is
-// shorter than the pre-defined block size passed into NewCipher.
+// Prior to encrypting the plaintext, a padding will be appended to pad it to
+// the length chosen by the cipher's PaddingPolicy. By default, it is padded to
+// the pre-defined block size passed into NewCipher.
 //
 // If the plaintext is longer than the block size, then Encrypt will return
-// an error.
+// an error, unless the cipher uses a bucketed PaddingPolicy, in which case the
+// plaintext is split into chunks of the block size that are each padded and
+// encrypted.
 func (c *cipher) Encrypt(plainText []byte) (cipherText string, err error) {
-	if len(plainText) > c.blockSize {
-		return "",
-			errors.Errorf(plaintextTooLargeErr, c.blockSize, len(plainText))
+	cipherBytes, err := c.seal(nil, plainText)
+	if err != nil {
+		return "", err
 	}
 
-	plainText, err = appendPadding(plainText, c.blockSize, c.rng)
-	if err != nil {
-		return "nil", err
+	// Encode and return
+	cipherText = base32768.SafeEncoding.EncodeToString(cipherBytes)
+	return
+}
+
+// seal pads and encrypts the plaintext and returns the prefix followed by the
+// nonce and encrypted plaintext of each chunk. The prefix is authenticated as
+// additional data.
+func (c *cipher) seal(prefix, plainText []byte) ([]byte, error) {
+	if c.padding == FixedPadding && len(plainText) > c.blockSize {
+		return nil,
+			errors.Errorf(plaintextTooLargeErr, c.blockSize, len(plainText))
 	}
 
-	// Generate cipher and nonce
 	chaCipher := initChaCha20Poly1305(c.secret)
-	nonce := make([]byte, chaCipher.NonceSize())
-	if _, err = io.ReadFull(c.rng, nonce); err != nil {
-		jww.FATAL.Panicf(generateNoncePanic, err)
+	chunks := splitChunks(plainText, c.blockSize)
+	out := make([]byte, 0, len(prefix)+len(chunks)*(chaCipher.NonceSize()+
+		lengthOfOverhead+c.blockSize+chaCipher.Overhead()))
+	out = append(out, prefix...)
+
+	var recordNonce []byte
+	for i, chunk := range chunks {
+		bucket := c.padding.bucket(len(chunk), c.blockSize)
+		paddedPlaintext, err := appendPadding(chunk, bucket, c.rng)
+		if err != nil {
+			return nil, err
+		}
+
+		// Generate nonce
+		nonce := make([]byte, chaCipher.NonceSize())
+		if _, err = io.ReadFull(c.rng, nonce); err != nil {
+			jww.FATAL.Panicf(generateNoncePanic, err)
+		}
+		if i == 0 {
+			recordNonce = nonce
+		}
+
+		// Encrypt data
+		ad := chunkAdditionalData(prefix, recordNonce, i, i == len(chunks)-1)
+		out = append(out, nonce...)
+		out = chaCipher.Seal(out, nonce, paddedPlaintext, ad)
 	}
 
-	// Encrypt data, encode, and return
-	cipherBytes := chaCipher.Seal(nonce, nonce, plainText, nil)
-	cipherText = base32768.SafeEncoding.EncodeToString(cipherBytes)
-	return
+	return out, nil
 }
 
 // Decrypt decrypts the given encoded ciphertext and returns the plaintext.
@@ -158,6 +325,13 @@ func (c *cipher) Decrypt(cipherText string) (plainText []byte, err error) {
 		return nil, err
 	}
 
+	return c.open(nil, decoded)
+}
+
+// open decrypts the chunks returned by seal, without the prefix, and returns
+// the plaintext with the padding stripped. The prefix must match the one passed
+// to seal.
+func (c *cipher) open(prefix, decoded []byte) ([]byte, error) {
 	// Generate cypher
 	chaCipher := initChaCha20Poly1305(c.secret)
 
@@ -166,50 +340,111 @@ func (c *cipher) Decrypt(cipherText string) (plainText []byte, err error) {
 		return nil, errors.Errorf(readNonceLenErr, len(decoded))
 	}
 
-	// The first nonceLen bytes of cipherText are the nonce
-	nonce, encrypted := decoded[:nonceLen], decoded[nonceLen:]
-
-	// Decrypt cipherText
-	paddedPlaintext, err := chaCipher.Open(nil, nonce, encrypted, nil)
-	if err != nil {
-		return nil, errors.Errorf(cipherCannotDecryptErr, err)
+	// Every chunk but the last is padded to the block size, so a chunk is the
+	// last chunk if no more than a full chunk remains
+	fullChunkLen :=
+		nonceLen + lengthOfOverhead + c.blockSize + chaCipher.Overhead()
+	recordNonce := decoded[:nonceLen]
+
+	var plainText []byte
+	for i := 0; len(decoded) > 0; i++ {
+		chunk := decoded
+		if len(chunk) > fullChunkLen {
+			chunk = decoded[:fullChunkLen]
+		}
+		decoded = decoded[len(chunk):]
+		if len(chunk)-nonceLen <= 0 {
+			return nil, errors.Errorf(readNonceLenErr, len(chunk))
+		}
+
+		// The first nonceLen bytes of each chunk are the nonce
+		nonce, encrypted := chunk[:nonceLen], chunk[nonceLen:]
+
+		// Decrypt chunk
+		ad := chunkAdditionalData(prefix, recordNonce, i, len(decoded) == 0)
+		paddedPlaintext, err := chaCipher.Open(nil, nonce, encrypted, ad)
+		if err != nil {
+			return nil, errors.Errorf(cipherCannotDecryptErr, err)
+		}
+
+		// Remove padding from chunk
+		if i == 0 && len(decoded) == 0 {
+			return discardPadding(paddedPlaintext), nil
+		}
+		plainText = append(plainText, discardPadding(paddedPlaintext)...)
 	}
 
-	// Remove padding from plainText
-	plainText = discardPadding(paddedPlaintext)
 	return plainText, nil
 }
 
-// cipherDisk represents a cipher for marshalling and unmarshalling.
+// cipherDisk represents a cipher for marshalling and unmarshalling. The secret
+// of a cipher created with NewCipherWithParams is not included, since it must
+// only be derivable from the password.
 type cipherDisk struct {
-	Secret    []byte `json:"secret"`
-	BlockSize int    `json:"blockSize"`
+	Secret    []byte        `json:"secret,omitempty"`
+	KDF       *cipherKDF    `json:"kdf,omitempty"`
+	BlockSize int           `json:"blockSize"`
+	Padding   PaddingPolicy `json:"padding,omitempty"`
+}
+
+// cipherKDF is the salt and Argon2 parameters used to derive the secret of a
+// cipher created with NewCipherWithParams.
+type cipherKDF struct {
+	Salt   []byte        `json:"salt"`
+	Params backup.Params `json:"params"`
 }
 
 // MarshalJSON marshals the cipher into valid JSON. This function adheres to the
 // json.Marshaler interface.
 func (c *cipher) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.disk())
+}
+
+// disk returns the cipherDisk of the cipher.
+func (c *cipher) disk() cipherDisk {
 	disk := cipherDisk{
-		Secret:    c.secret,
+		KDF:       c.kdf,
 		BlockSize: c.blockSize,
+		Padding:   c.padding,
+	}
+	if c.kdf == nil {
+		disk.Secret = c.secret
+	}
+	return disk
+}
+
+// newCipherFromDisk returns the cipher of the cipherDisk, without the RNG. The
+// secret of a cipher created with NewCipherWithParams must be derived again
+// from the password.
+func newCipherFromDisk(disk cipherDisk) *cipher {
+	return &cipher{
+		secret:    disk.Secret,
+		kdf:       disk.KDF,
+		blockSize: disk.BlockSize,
+		padding:   disk.Padding,
 	}
-	return json.Marshal(disk)
 }
 
 // UnmarshalJSON unmarshalls JSON into the cipher. This function adheres to the
 // json.Unmarshaler interface.
 //
 // Note that this function does not transfer the internal RNG. Use
-// NewCipherFromJSON to properly reconstruct a cipher from JSON.
+// NewCipherFromJSON to properly reconstruct a cipher from JSON. Returns an
+// error for a cipher created with NewCipherWithParams, whose key is not in the
+// JSON.
 func (c *cipher) UnmarshalJSON(data []byte) error {
 	var disk cipherDisk
 	err := json.Unmarshal(data, &disk)
 	if err != nil {
 		return err
+	} else if disk.KDF != nil {
+		return errors.New(cipherPasswordRequiredErr)
 	}
 
 	c.secret = disk.Secret
+	c.kdf = disk.KDF
 	c.blockSize = disk.BlockSize
+	c.padding = disk.Padding
 
 	return nil
 }
@@ -269,6 +504,22 @@ func deriveDatabaseSecret(password, salt []byte) []byte {
 	return h.Sum(nil)
 }
 
+// deriveDatabaseSecretArgon2 generates the key used for the
+// encryption/decryption of channel message contents from a user supplied
+// password using Argon2id.
+func deriveDatabaseSecretArgon2(
+	password, salt []byte, params backup.Params) ([]byte, error) {
+	if len(salt) < backup.SaltLen {
+		return nil, errors.Errorf(cipherSaltLenErr, backup.SaltLen, len(salt))
+	} else if params.Time < 1 || params.Threads < 1 {
+		return nil,
+			errors.Errorf(cipherInvalidParamsErr, params.Time, params.Threads)
+	}
+
+	return argon2.IDKey(password, salt, params.Time, params.Memory,
+		params.Threads, backup.KeyLen), nil
+}
+
 // initChaCha20Poly1305 returns a XChaCha20-Poly1305 cipher.AEAD that uses the
 // given password hashed into a 256-bit key.
 func initChaCha20Poly1305(key []byte) cryptoCipher.AEAD {
@@ -9,8 +9,10 @@ package indexedDb
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"gitlab.com/elixxir/crypto/backup"
 	"gitlab.com/xx_network/crypto/csprng"
 	"io"
 	"reflect"
@@ -170,6 +172,187 @@ func TestCipher_MarshalJSON_UnmarshalJSON(t *testing.T) {
 	}
 }
 
+// Tests that a Cipher created with NewCipherWithParams encrypts and decrypts,
+// derives a different secret for different parameters, and keeps its salt and
+// parameters through JSON marshalling.
+func TestNewCipherWithParams(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	salt, err := backup.MakeSalt(rng)
+	if err != nil {
+		t.Fatalf("Failed to make salt: %+v", err)
+	}
+	params := backup.Params{Time: 1, Memory: 1, Threads: 1}
+
+	c, err := NewCipherWithParams(
+		[]byte("hunter2"), salt, params, FixedPadding, 32, rng)
+	if err != nil {
+		t.Fatalf("Failed to create new Cipher: %+v", err)
+	}
+	ciphertext, err := c.Encrypt([]byte("plaintext"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	if plaintext, err := c.Decrypt(ciphertext); err != nil ||
+		string(plaintext) != "plaintext" {
+		t.Errorf("Failed to decrypt: %+v", err)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Failed to JSON marshal Cipher: %+v", err)
+	}
+	loaded, err := NewCipherFromJSONWithPassword(data, []byte("hunter2"), rng)
+	if err != nil {
+		t.Fatalf("Failed to JSON unmarshal Cipher: %+v", err)
+	}
+	if !reflect.DeepEqual(c, loaded) {
+		t.Errorf("Marshalled and unmarshaled Cipher does not match original."+
+			"\nexpected: %+v\nreceived: %+v", c, loaded)
+	}
+	kdf := loaded.(*cipher).kdf
+	if kdf == nil || !bytes.Equal(kdf.Salt, salt) || kdf.Params != params {
+		t.Errorf("Unmarshalled Cipher does not have the salt and parameters."+
+			"\nexpected: %v %+v\nreceived: %+v", salt, params, kdf)
+	}
+
+	again, _ := NewCipherWithParams(
+		[]byte("hunter2"), salt, params, FixedPadding, 32, rng)
+	if !bytes.Equal(c.(*cipher).secret, again.(*cipher).secret) {
+		t.Errorf("Same password, salt, and parameters give different secrets.")
+	}
+
+	otherParams := backup.Params{Time: 2, Memory: 1, Threads: 1}
+	other, _ := NewCipherWithParams(
+		[]byte("hunter2"), salt, otherParams, FixedPadding, 32, rng)
+	if bytes.Equal(c.(*cipher).secret, other.(*cipher).secret) {
+		t.Errorf("Different parameters give the same secret.")
+	}
+
+	blake, _ := NewCipher([]byte("hunter2"), salt, 32, rng)
+	if bytes.Equal(c.(*cipher).secret, blake.(*cipher).secret) {
+		t.Errorf("Argon2 secret matches the secret from NewCipher.")
+	}
+	if blake.(*cipher).kdf != nil {
+		t.Errorf("Cipher from NewCipher has KDF parameters: %+v",
+			blake.(*cipher).kdf)
+	}
+}
+
+// Tests that the JSON of a Cipher created with NewCipherWithParams holds no key
+// material, so that it can only be loaded with the password.
+func TestNewCipherWithParams_JSONHasNoKey(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	salt, _ := backup.MakeSalt(rng)
+	params := backup.Params{Time: 1, Memory: 1, Threads: 1}
+	c, err := NewCipherWithParams(
+		[]byte("hunter2"), salt, params, FixedPadding, 32, rng)
+	if err != nil {
+		t.Fatalf("Failed to create new Cipher: %+v", err)
+	}
+	ciphertext, _ := c.Encrypt([]byte("plaintext"))
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Failed to JSON marshal Cipher: %+v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Failed to JSON unmarshal fields: %+v", err)
+	}
+	if _, exists := fields["secret"]; exists {
+		t.Errorf("JSON has the secret: %s", data)
+	}
+	secret := c.(*cipher).secret
+	encodedSecret := base64.StdEncoding.EncodeToString(secret)
+	if bytes.Contains(data, secret) ||
+		bytes.Contains(data, []byte(encodedSecret)) {
+		t.Errorf("JSON contains the key: %s", data)
+	}
+
+	if _, err = NewCipherFromJSON(data, rng); err == nil {
+		t.Errorf("Loaded Cipher without the password.")
+	}
+
+	wrong, err := NewCipherFromJSONWithPassword(data, []byte("hunter3"), rng)
+	if err != nil {
+		t.Fatalf("Failed to load Cipher with wrong password: %+v", err)
+	}
+	if _, err = wrong.Decrypt(ciphertext); err == nil {
+		t.Errorf("Cipher with the wrong password decrypted the ciphertext.")
+	}
+
+	// A cipher that is not derived from a password cannot be loaded with one
+	blake, _ := NewCipher([]byte("hunter2"), salt, 32, rng)
+	data, _ = json.Marshal(blake)
+	_, err = NewCipherFromJSONWithPassword(data, []byte("hunter2"), rng)
+	if err == nil {
+		t.Errorf("Loaded Cipher from NewCipher with a password.")
+	}
+}
+
+// Tests that a Cipher created with NewCipherWithParams pads and chunks
+// plaintexts according to its PaddingPolicy, including once loaded from JSON.
+func TestNewCipherWithParams_Padding(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	salt, _ := backup.MakeSalt(rng)
+	params := backup.Params{Time: 1, Memory: 1, Threads: 1}
+	c, err := NewCipherWithParams(
+		[]byte("hunter2"), salt, params, PadmePadding, 64, rng)
+	if err != nil {
+		t.Fatalf("Failed to create new Cipher: %+v", err)
+	}
+	data, _ := json.Marshal(c)
+	loaded, err := NewCipherFromJSONWithPassword(data, []byte("hunter2"), rng)
+	if err != nil {
+		t.Fatalf("Failed to JSON unmarshal Cipher: %+v", err)
+	}
+	if loaded.(*cipher).padding != PadmePadding {
+		t.Errorf("Loaded Cipher has padding %s.", loaded.(*cipher).padding)
+	}
+
+	plaintext := bytes.Repeat([]byte("A"), 200)
+	ciphertext, err := c.Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Failed to encrypt plaintext longer than the block: %+v", err)
+	}
+	if decrypted, err := loaded.Decrypt(ciphertext); err != nil ||
+		!bytes.Equal(plaintext, decrypted) {
+		t.Errorf("Failed to decrypt: %+v", err)
+	}
+
+	_, err = NewCipherWithParams(
+		[]byte("hunter2"), salt, params, PaddingPolicy(3), 64, rng)
+	if err == nil {
+		t.Errorf("Failed to get error for unknown padding policy.")
+	}
+}
+
+// Error path: tests that NewCipherWithParams rejects short salts, invalid
+// Argon2 parameters, and invalid block sizes.
+func TestNewCipherWithParams_InvalidParams(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	salt := make([]byte, backup.SaltLen)
+	params := backup.Params{Time: 1, Memory: 1, Threads: 1}
+
+	tests := map[string]struct {
+		salt      []byte
+		params    backup.Params
+		blockSize int
+	}{
+		"short salt":  {salt[:backup.SaltLen-1], params, 32},
+		"zero time":   {salt, backup.Params{Memory: 1, Threads: 1}, 32},
+		"zero thread": {salt, backup.Params{Time: 1, Memory: 1}, 32},
+		"block size":  {salt, params, 0},
+	}
+	for name, tt := range tests {
+		_, err := NewCipherWithParams([]byte("password"), tt.salt, tt.params,
+			FixedPadding, tt.blockSize, rng)
+		if err == nil {
+			t.Errorf("Failed to get error for %s.", name)
+		}
+	}
+}
+
 // Tests that a number of plaintexts with different block sizes can have padding
 // added via appendPadding and discarded via discardPadding and match the
 // original.
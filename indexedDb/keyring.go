@@ -0,0 +1,368 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package indexedDb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/Max-Sum/base32768"
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/crypto/backup"
+	"golang.org/x/crypto/blake2b"
+)
+
+// keyIDVector separates the key ID from the other values derived from the
+// database secret.
+const keyIDVector = "IndexedDbKeyID"
+
+// KeyIDLength is the length, in bytes, of the key ID prefixed to ciphertexts
+// encrypted by a Keyring.
+const KeyIDLength = 4
+
+// Error messages.
+const (
+	// NewKeyringFromCipher
+	keyringInvalidCipherErr = "cipher must be created by NewCipher or " +
+		"NewCipherWithParams"
+
+	// NewKeyringFromJSON, NewKeyringFromJSONWithPasswords
+	keyringNoKeysErr           = "keyring must have at least one key"
+	keyringPasswordRequiredErr = "key %d is derived from a password; use " +
+		"NewKeyringFromJSONWithPasswords"
+	keyringNoPasswordErr = "none of the passwords derive key %d"
+
+	// keyring.Decrypt
+	keyringCannotDecryptErr = "cannot decrypt ciphertext with any key in " +
+		"the keyring"
+)
+
+// Keyring is a Cipher that holds every version of the database key. It
+// encrypts under the newest key and decrypts under any key, so that the key
+// can be rotated, when the password changes or a key is suspected to have
+// leaked, and the database migrated in the background.
+//
+// Ciphertexts encrypted by a Keyring are prefixed, inside the encoding, with
+// the ID of the key that encrypted them. A Keyring also decrypts ciphertexts
+// without a prefix that were encrypted by a Cipher before it was moved into a
+// keyring.
+type Keyring interface {
+	// Cipher encrypts and computes blind indexes under the newest key and
+	// decrypts under any key.
+	//
+	// Note that blind indexes change when the key is rotated, so indexes must
+	// be recomputed as their rows are re-encrypted. Until then, look values
+	// up with BlindIndexes.
+	Cipher
+
+	// BlindIndexes returns the blind index of the value for the given column
+	// under every key, newest first. During a migration, a row may still hold
+	// the index under any older key, so lookups must match any of them until
+	// IsCurrent holds for every row, after which BlindIndex is enough.
+	BlindIndexes(column string, value []byte) []string
+
+	// Rotate adds a new key derived from the password and salt. All further
+	// encryption uses the new key.
+	Rotate(internalPassword, salt []byte)
+
+	// RotateWithParams adds a new key derived from a user supplied password
+	// and salt using Argon2id, as done by NewCipherWithParams. All further
+	// encryption uses the new key. The key is not included in the keyring's
+	// JSON, which must then be loaded with NewKeyringFromJSONWithPasswords.
+	RotateWithParams(password, salt []byte, params backup.Params) error
+
+	// Reencrypt decrypts the ciphertext under any key and encrypts it under
+	// the newest key.
+	Reencrypt(cipherText string) (string, error)
+
+	// IsCurrent returns true if the ciphertext is encrypted under the newest
+	// key and does not need to be re-encrypted. It does not decrypt the
+	// ciphertext.
+	IsCurrent(cipherText string) bool
+}
+
+// keyring adheres to the Keyring interface.
+type keyring struct {
+	// keys are the versions of the key, oldest first.
+	keys []*cipher
+
+	// ids are the IDs of the keys, in the same order.
+	ids [][]byte
+}
+
+// NewKeyring generates a new Keyring with a single key from a password and
+// salt.
+//
+// plaintextBlockSize is the maximum allowed length of any encrypted plaintext.
+func NewKeyring(internalPassword, salt []byte, plaintextBlockSize int,
+	csprng io.Reader) (Keyring, error) {
+	c, err := NewCipher(internalPassword, salt, plaintextBlockSize, csprng)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyringFromCipher(c)
+}
+
+// NewKeyringFromCipher generates a new Keyring whose only key is that of the
+// Cipher. The Keyring decrypts everything the Cipher encrypted.
+func NewKeyringFromCipher(c Cipher) (Keyring, error) {
+	key, ok := c.(*cipher)
+	if !ok {
+		return nil, errors.New(keyringInvalidCipherErr)
+	}
+
+	kr := &keyring{}
+	kr.add(key)
+	return kr, nil
+}
+
+// NewKeyringFromJSON generates a new Keyring from its marshalled JSON and a
+// CSPRNG. Returns an error if any key was added by NewCipherWithParams or
+// Keyring.RotateWithParams, since their keys are not in the JSON; use
+// NewKeyringFromJSONWithPasswords instead.
+func NewKeyringFromJSON(data []byte, csprng io.Reader) (Keyring, error) {
+	kr := &keyring{}
+	if err := json.Unmarshal(data, kr); err != nil {
+		return nil, err
+	}
+
+	for _, key := range kr.keys {
+		key.rng = csprng
+	}
+	return kr, nil
+}
+
+// NewKeyringFromJSONWithPasswords generates a new Keyring from its marshalled
+// JSON, the passwords of its keys, and a CSPRNG. Each key added by
+// NewCipherWithParams or Keyring.RotateWithParams is derived again from
+// whichever of the passwords matches its key ID, so the passwords may be given
+// in any order. Returns an error if no password matches a key.
+func NewKeyringFromJSONWithPasswords(
+	data []byte, passwords [][]byte, csprng io.Reader) (Keyring, error) {
+	var disk keyringDisk
+	if err := json.Unmarshal(data, &disk); err != nil {
+		return nil, err
+	} else if len(disk.Keys) == 0 {
+		return nil, errors.New(keyringNoKeysErr)
+	}
+
+	kr := &keyring{}
+	for i, keyDisk := range disk.Keys {
+		key := newCipherFromDisk(keyDisk.cipherDisk)
+		key.rng = csprng
+		if key.kdf != nil {
+			secret, err := findKeyringSecret(key.kdf, keyDisk.ID, passwords)
+			if err != nil {
+				return nil, err
+			} else if secret == nil {
+				return nil, errors.Errorf(keyringNoPasswordErr, i)
+			}
+			key.secret = secret
+		}
+		kr.add(key)
+	}
+	return kr, nil
+}
+
+// Encrypt encrypts the raw data under the newest key. The returned ciphertext
+// is encoded and includes the key ID (KeyIDLength bytes), the nonce
+// (24 bytes), and the encrypted plaintext (with possible padding, if needed).
+func (kr *keyring) Encrypt(plainText []byte) (string, error) {
+	newest := len(kr.keys) - 1
+	cipherBytes, err := kr.keys[newest].seal(kr.ids[newest], plainText)
+	if err != nil {
+		return "", err
+	}
+	return base32768.SafeEncoding.EncodeToString(cipherBytes), nil
+}
+
+// Decrypt decrypts the given encoded ciphertext under the key whose ID it is
+// prefixed with. If it was encrypted by a Cipher without a key ID, it is
+// decrypted under whichever key encrypted it.
+func (kr *keyring) Decrypt(cipherText string) ([]byte, error) {
+	decoded, err := base32768.SafeEncoding.DecodeString(cipherText)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decoded) > KeyIDLength {
+		prefix, encrypted := decoded[:KeyIDLength], decoded[KeyIDLength:]
+		for i := range kr.keys {
+			if bytes.Equal(kr.ids[i], prefix) {
+				plainText, err := kr.keys[i].open(prefix, encrypted)
+				if err == nil {
+					return plainText, nil
+				}
+			}
+		}
+	}
+
+	// The ciphertext may be from before the keyring, with no key ID
+	for i := len(kr.keys) - 1; i >= 0; i-- {
+		if plainText, err := kr.keys[i].open(nil, decoded); err == nil {
+			return plainText, nil
+		}
+	}
+
+	return nil, errors.New(keyringCannotDecryptErr)
+}
+
+// BlindIndex returns the blind index of the value for the given column under
+// the newest key.
+func (kr *keyring) BlindIndex(column string, value []byte) string {
+	return kr.keys[len(kr.keys)-1].BlindIndex(column, value)
+}
+
+// BlindIndexes returns the blind index of the value for the given column under
+// every key, newest first.
+func (kr *keyring) BlindIndexes(column string, value []byte) []string {
+	indexes := make([]string, len(kr.keys))
+	for i := range kr.keys {
+		indexes[i] = kr.keys[len(kr.keys)-1-i].BlindIndex(column, value)
+	}
+	return indexes
+}
+
+// Rotate adds a new key derived from the password and salt. All further
+// encryption uses the new key. The new key uses the same block size and
+// padding as the current key.
+func (kr *keyring) Rotate(internalPassword, salt []byte) {
+	current := kr.keys[len(kr.keys)-1]
+	kr.add(&cipher{
+		secret:    deriveDatabaseSecret(internalPassword, salt),
+		blockSize: current.blockSize,
+		padding:   current.padding,
+		rng:       current.rng,
+	})
+}
+
+// RotateWithParams adds a new key derived from a user supplied password and
+// salt using Argon2id, as done by NewCipherWithParams. All further encryption
+// uses the new key. The new key uses the same block size and padding as the
+// current key.
+func (kr *keyring) RotateWithParams(
+	password, salt []byte, params backup.Params) error {
+	key, err := deriveDatabaseSecretArgon2(password, salt, params)
+	if err != nil {
+		return err
+	}
+
+	current := kr.keys[len(kr.keys)-1]
+	kr.add(&cipher{
+		secret:    key,
+		kdf:       &cipherKDF{Salt: salt, Params: params},
+		blockSize: current.blockSize,
+		padding:   current.padding,
+		rng:       current.rng,
+	})
+	return nil
+}
+
+// Reencrypt decrypts the ciphertext under any key and encrypts it under the
+// newest key.
+func (kr *keyring) Reencrypt(cipherText string) (string, error) {
+	plainText, err := kr.Decrypt(cipherText)
+	if err != nil {
+		return "", err
+	}
+	return kr.Encrypt(plainText)
+}
+
+// IsCurrent returns true if the ciphertext is encrypted under the newest key
+// and does not need to be re-encrypted. It does not decrypt the ciphertext.
+func (kr *keyring) IsCurrent(cipherText string) bool {
+	decoded, err := base32768.SafeEncoding.DecodeString(cipherText)
+	if err != nil || len(decoded) <= KeyIDLength {
+		return false
+	}
+	return bytes.Equal(decoded[:KeyIDLength], kr.ids[len(kr.ids)-1])
+}
+
+// add adds the key as the newest key.
+func (kr *keyring) add(key *cipher) {
+	kr.keys = append(kr.keys, key)
+	kr.ids = append(kr.ids, makeKeyID(key.secret))
+}
+
+// keyringDisk represents a keyring for marshalling and unmarshalling.
+type keyringDisk struct {
+	Keys []keyringKeyDisk `json:"keys"`
+}
+
+// keyringKeyDisk represents a key of a keyring for marshalling and
+// unmarshalling. The key ID of a key derived from a password is included to
+// find which password it is derived from, since the key itself is not. The ID
+// is already prefixed to every ciphertext encrypted under the key.
+type keyringKeyDisk struct {
+	cipherDisk
+	ID []byte `json:"id,omitempty"`
+}
+
+// MarshalJSON marshals the keyring into valid JSON. This function adheres to
+// the json.Marshaler interface.
+func (kr *keyring) MarshalJSON() ([]byte, error) {
+	disk := keyringDisk{Keys: make([]keyringKeyDisk, len(kr.keys))}
+	for i, key := range kr.keys {
+		disk.Keys[i].cipherDisk = key.disk()
+		if key.kdf != nil {
+			disk.Keys[i].ID = kr.ids[i]
+		}
+	}
+	return json.Marshal(disk)
+}
+
+// UnmarshalJSON unmarshalls JSON into the keyring. This function adheres to
+// the json.Unmarshaler interface.
+//
+// Note that this function does not transfer the internal RNG. Use
+// NewKeyringFromJSON to properly reconstruct a keyring from JSON. Returns an
+// error if any key is derived from a password, since it is not in the JSON.
+func (kr *keyring) UnmarshalJSON(data []byte) error {
+	var disk keyringDisk
+	if err := json.Unmarshal(data, &disk); err != nil {
+		return err
+	}
+	if len(disk.Keys) == 0 {
+		return errors.New(keyringNoKeysErr)
+	}
+
+	kr.keys, kr.ids = nil, nil
+	for i, key := range disk.Keys {
+		if key.KDF != nil {
+			return errors.Errorf(keyringPasswordRequiredErr, i)
+		}
+		kr.add(newCipherFromDisk(key.cipherDisk))
+	}
+	return nil
+}
+
+// findKeyringSecret returns the secret derived from whichever password gives
+// the key ID, or nil if none do.
+func findKeyringSecret(
+	kdf *cipherKDF, id []byte, passwords [][]byte) ([]byte, error) {
+	for _, password := range passwords {
+		secret, err := deriveDatabaseSecretArgon2(
+			password, kdf.Salt, kdf.Params)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(makeKeyID(secret), id) {
+			return secret, nil
+		}
+	}
+	return nil, nil
+}
+
+// makeKeyID returns the ID of the key with the given secret.
+func makeKeyID(secret []byte) []byte {
+	h, _ := blake2b.New256(nil)
+	h.Write(secret)
+	h.Write([]byte(keyIDVector))
+	return h.Sum(nil)[:KeyIDLength]
+}
@@ -0,0 +1,306 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package indexedDb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Max-Sum/base32768"
+	"gitlab.com/elixxir/crypto/backup"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that a Keyring decrypts ciphertexts from every key version after
+// rotation, including ciphertexts from the Cipher it was created from, and
+// that Keyring.Reencrypt moves them to the newest key.
+func TestKeyring_Rotate_Reencrypt(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	c, err := NewCipher([]byte("password1"), []byte("salt"), 50, rng)
+	if err != nil {
+		t.Fatalf("Failed to create cipher: %+v", err)
+	}
+	legacy, err := c.Encrypt([]byte("legacy"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+
+	kr, err := NewKeyringFromCipher(c)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %+v", err)
+	}
+	first, err := kr.Encrypt([]byte("first"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	if !kr.IsCurrent(first) || kr.IsCurrent(legacy) {
+		t.Errorf("Incorrect IsCurrent before rotation.")
+	}
+
+	kr.Rotate([]byte("password2"), []byte("salt"))
+	second, err := kr.Encrypt([]byte("second"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	if kr.IsCurrent(first) || !kr.IsCurrent(second) {
+		t.Errorf("Incorrect IsCurrent after rotation.")
+	}
+	if _, err = c.Decrypt(second); err == nil {
+		t.Errorf("Old cipher decrypted ciphertext under the new key.")
+	}
+
+	for expected, cipherText := range map[string]string{
+		"legacy": legacy, "first": first, "second": second} {
+		plainText, err := kr.Decrypt(cipherText)
+		if err != nil {
+			t.Errorf("Failed to decrypt %s: %+v", expected, err)
+		} else if string(plainText) != expected {
+			t.Errorf("Decrypted %s does not match.\nexpected: %s"+
+				"\nreceived: %s", expected, expected, plainText)
+		}
+
+		reencrypted, err := kr.Reencrypt(cipherText)
+		if err != nil {
+			t.Errorf("Failed to re-encrypt %s: %+v", expected, err)
+		}
+		if !kr.IsCurrent(reencrypted) {
+			t.Errorf("Re-encrypted %s is not under the newest key.", expected)
+		}
+		plainText, err = kr.Decrypt(reencrypted)
+		if err != nil || string(plainText) != expected {
+			t.Errorf("Failed to decrypt re-encrypted %s: %+v", expected, err)
+		}
+	}
+
+	if kr.BlindIndex("col", []byte("v")) == c.BlindIndex("col", []byte("v")) {
+		t.Errorf("Blind index did not change with the key.")
+	}
+}
+
+// Tests that a row written with its blind index before Keyring.Rotate is still
+// found by equality lookup with Keyring.BlindIndexes, and that once the row is
+// re-encrypted and reindexed, the newest index finds it.
+func TestKeyring_BlindIndexes(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	kr, err := NewKeyring([]byte("password1"), []byte("salt"), 50, rng)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %+v", err)
+	}
+
+	// The table maps the blind index of a row to its ciphertext
+	table := make(map[string]string)
+	lookup := func(value []byte) (string, bool) {
+		for _, index := range kr.BlindIndexes("channelID", value) {
+			if cipherText, exists := table[index]; exists {
+				return cipherText, true
+			}
+		}
+		return "", false
+	}
+
+	cipherText, err := kr.Encrypt([]byte("row"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	oldIndex := kr.BlindIndex("channelID", []byte("channel"))
+	table[oldIndex] = cipherText
+
+	kr.Rotate([]byte("password2"), []byte("salt"))
+	indexes := kr.BlindIndexes("channelID", []byte("channel"))
+	if len(indexes) != 2 {
+		t.Fatalf("Expected an index for each key.\nexpected: %d"+
+			"\nreceived: %d", 2, len(indexes))
+	} else if indexes[0] != kr.BlindIndex("channelID", []byte("channel")) {
+		t.Errorf("First index is not under the newest key.")
+	} else if indexes[1] != oldIndex {
+		t.Errorf("Second index is not under the old key.")
+	}
+
+	found, exists := lookup([]byte("channel"))
+	if !exists || found != cipherText {
+		t.Errorf("Failed to look up row written before rotation.")
+	}
+	if _, exists = lookup([]byte("other")); exists {
+		t.Errorf("Looked up row with a different value.")
+	}
+
+	// Migrate the row
+	reencrypted, err := kr.Reencrypt(table[oldIndex])
+	if err != nil {
+		t.Fatalf("Failed to re-encrypt: %+v", err)
+	}
+	delete(table, oldIndex)
+	table[kr.BlindIndex("channelID", []byte("channel"))] = reencrypted
+
+	found, exists = lookup([]byte("channel"))
+	if !exists || found != reencrypted || !kr.IsCurrent(found) {
+		t.Errorf("Failed to look up migrated row.")
+	}
+}
+
+// Tests that a Keyring encrypts plaintexts to the same length as a Cipher plus
+// the key ID and rejects ciphertexts whose key ID was changed.
+func TestKeyring_Encrypt_KeyID(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	c, _ := NewCipher([]byte("password"), []byte("salt"), 50, rng)
+	kr, err := NewKeyring([]byte("password"), []byte("salt"), 50, rng)
+	if err != nil {
+		t.Fatalf("Failed to create keyring: %+v", err)
+	}
+
+	cipherText, _ := c.Encrypt([]byte("data"))
+	keyringText, err := kr.Encrypt([]byte("data"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	decoded, _ := base32768.SafeEncoding.DecodeString(cipherText)
+	keyringDecoded, _ := base32768.SafeEncoding.DecodeString(keyringText)
+	if len(keyringDecoded) != len(decoded)+KeyIDLength {
+		t.Errorf("Unexpected ciphertext length.\nexpected: %d\nreceived: %d",
+			len(decoded)+KeyIDLength, len(keyringDecoded))
+	}
+	keyID := makeKeyID(c.(*cipher).secret)
+	if !bytes.Equal(keyringDecoded[:KeyIDLength], keyID) {
+		t.Errorf("Ciphertext not prefixed with key ID.")
+	}
+
+	keyringDecoded[0] ^= 1
+	tampered := base32768.SafeEncoding.EncodeToString(keyringDecoded)
+	if _, err = kr.Decrypt(tampered); err == nil {
+		t.Errorf("Decrypted ciphertext with a modified key ID.")
+	}
+
+	if _, err = kr.Encrypt(make([]byte, 51)); err == nil {
+		t.Errorf("Failed to get error for plaintext larger than block size.")
+	}
+}
+
+// Tests that a Keyring can be JSON marshalled and unmarshalled with all its
+// keys.
+func TestKeyring_MarshalJSON_NewKeyringFromJSON(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	kr, _ := NewKeyring([]byte("password1"), []byte("salt"), 50, rng)
+	first, _ := kr.Encrypt([]byte("first"))
+	kr.Rotate([]byte("password2"), []byte("salt"))
+
+	data, err := json.Marshal(kr)
+	if err != nil {
+		t.Fatalf("Failed to JSON marshal keyring: %+v", err)
+	}
+	loaded, err := NewKeyringFromJSON(data, rng)
+	if err != nil {
+		t.Fatalf("Failed to JSON unmarshal keyring: %+v", err)
+	}
+
+	if plainText, err := loaded.Decrypt(first); err != nil ||
+		string(plainText) != "first" {
+		t.Errorf("Failed to decrypt under the old key: %+v", err)
+	}
+	second, err := loaded.Encrypt([]byte("second"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	if !kr.IsCurrent(second) {
+		t.Errorf("Loaded keyring did not encrypt under the newest key.")
+	}
+}
+
+// Tests that Keyring.RotateWithParams adds an Argon2 key that encrypts new
+// ciphertexts and is kept through JSON marshalling.
+func TestKeyring_RotateWithParams(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	kr, _ := NewKeyring([]byte("password1"), []byte("salt"), 50, rng)
+	first, _ := kr.Encrypt([]byte("first"))
+
+	salt, _ := backup.MakeSalt(rng)
+	params := backup.Params{Time: 1, Memory: 1, Threads: 1}
+	err := kr.RotateWithParams([]byte("passphrase"), salt, params)
+	if err != nil {
+		t.Fatalf("Failed to rotate: %+v", err)
+	}
+	c, _ := NewCipherWithParams(
+		[]byte("passphrase"), salt, params, FixedPadding, 50, rng)
+	second, err := kr.Encrypt([]byte("second"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %+v", err)
+	}
+	decoded, _ := base32768.SafeEncoding.DecodeString(second)
+	if !bytes.Equal(decoded[:KeyIDLength], makeKeyID(c.(*cipher).secret)) {
+		t.Errorf("Ciphertext not encrypted under the Argon2 key.")
+	}
+
+	// The Argon2 key is only loaded with its password
+	data, _ := json.Marshal(kr)
+	if bytes.Contains(data, []byte(
+		base64.StdEncoding.EncodeToString(c.(*cipher).secret))) {
+		t.Errorf("Keyring JSON contains the Argon2 key: %s", data)
+	}
+	if _, err = NewKeyringFromJSON(data, rng); err == nil {
+		t.Errorf("Loaded keyring without the password.")
+	}
+	_, err = NewKeyringFromJSONWithPasswords(
+		data, [][]byte{[]byte("wrong")}, rng)
+	if err == nil {
+		t.Errorf("Loaded keyring with the wrong password.")
+	}
+	loaded, err := NewKeyringFromJSONWithPasswords(
+		data, [][]byte{[]byte("wrong"), []byte("passphrase")}, rng)
+	if err != nil {
+		t.Fatalf("Failed to JSON unmarshal keyring: %+v", err)
+	}
+	if !reflect.DeepEqual(kr, loaded) {
+		t.Errorf("Marshalled and unmarshaled keyring does not match original."+
+			"\nexpected: %+v\nreceived: %+v", kr, loaded)
+	}
+	for expected, cipherText := range map[string]string{
+		"first": first, "second": second} {
+		if plainText, err := loaded.Decrypt(cipherText); err != nil ||
+			string(plainText) != expected {
+			t.Errorf("Failed to decrypt %s: %+v", expected, err)
+		}
+	}
+
+	if err = kr.RotateWithParams([]byte("passphrase"), salt[:1], params); err == nil {
+		t.Errorf("Failed to get error for short salt.")
+	}
+}
+
+// Error path: tests that keyrings cannot be made from other ciphers or JSON
+// without keys, and that undecryptable ciphertexts return errors.
+func TestKeyring_Errors(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	kr, _ := NewKeyring([]byte("password"), []byte("salt"), 50, rng)
+
+	if _, err := NewKeyringFromCipher(kr); err == nil {
+		t.Errorf("Failed to get error for keyring as cipher.")
+	}
+	if _, err := NewKeyringFromJSON([]byte(`{"keys":[]}`), rng); err == nil {
+		t.Errorf("Failed to get error for JSON without keys.")
+	}
+	if _, err := NewKeyring(nil, nil, 0, rng); err == nil {
+		t.Errorf("Failed to get error for invalid block size.")
+	}
+
+	other, _ := NewCipher([]byte("other"), []byte("salt"), 50, rng)
+	cipherText, _ := other.Encrypt([]byte("data"))
+	if _, err := kr.Decrypt(cipherText); err == nil {
+		t.Errorf("Decrypted ciphertext from an unknown key.")
+	}
+	if _, err := kr.Reencrypt(cipherText); err == nil {
+		t.Errorf("Re-encrypted ciphertext from an unknown key.")
+	}
+	if _, err := kr.Decrypt("not base32768"); err == nil {
+		t.Errorf("Decrypted invalid encoding.")
+	}
+	if kr.IsCurrent("") {
+		t.Errorf("Empty ciphertext is current.")
+	}
+}
@@ -0,0 +1,134 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package indexedDb
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"strconv"
+)
+
+// PaddingPolicy selects the lengths that a Cipher pads plaintexts to.
+type PaddingPolicy uint8
+
+const (
+	// FixedPadding pads every plaintext to the block size and rejects
+	// plaintexts longer than the block size. It is the padding used by
+	// NewCipher.
+	FixedPadding PaddingPolicy = iota
+
+	// PowerOfTwoPadding pads every plaintext to the next power of two, up to
+	// the block size. It wastes at most half of each ciphertext and reveals
+	// only the base-2 logarithm of the length of the plaintext.
+	PowerOfTwoPadding
+
+	// PadmePadding pads every plaintext with the Padmé scheme from "Reducing
+	// Metadata Leakage from Encrypted Files and Communication with PURBs"
+	// (Nikitin et al., 2019), up to the block size. It wastes at most 12% of
+	// each ciphertext and reveals O(log log L) bits of the length L of the
+	// plaintext.
+	PadmePadding
+)
+
+// maxBucketSize is the largest block size of a bucketed PaddingPolicy. It is
+// the largest plaintext length that fits in lengthOfOverhead bytes.
+const maxBucketSize = 1<<(7*lengthOfOverhead) - 1
+
+// bucket returns the length that a plaintext of the given size is padded to.
+// The size must be no larger than the block size.
+func (p PaddingPolicy) bucket(size, blockSize int) int {
+	var bucket int
+	switch p {
+	case PowerOfTwoPadding:
+		bucket = 1
+		if size > 1 {
+			bucket = 1 << bits.Len(uint(size-1))
+		}
+	case PadmePadding:
+		bucket = padme(size)
+	default:
+		return blockSize
+	}
+
+	if bucket > blockSize {
+		return blockSize
+	}
+	return bucket
+}
+
+// isValid returns true if the PaddingPolicy is one of the defined policies.
+func (p PaddingPolicy) isValid() bool {
+	return p <= PadmePadding
+}
+
+// String returns a human-readable name for the PaddingPolicy. This function
+// adheres to the fmt.Stringer interface.
+func (p PaddingPolicy) String() string {
+	switch p {
+	case FixedPadding:
+		return "Fixed"
+	case PowerOfTwoPadding:
+		return "PowerOfTwo"
+	case PadmePadding:
+		return "Padmé"
+	default:
+		return "INVALID PADDING POLICY: " + strconv.Itoa(int(p))
+	}
+}
+
+// padme returns the Padmé padded length of a plaintext of the given size. The
+// padded length keeps the log2(log2(size)) + 1 most significant bits of the
+// size and rounds the remaining bits up.
+func padme(size int) int {
+	if size < 2 {
+		return size
+	}
+
+	// e is floor(log2(size)) and s is floor(log2(e)) + 1
+	e := bits.Len(uint(size)) - 1
+	s := bits.Len(uint(e))
+	mask := 1<<(e-s) - 1
+	return (size + mask) &^ mask
+}
+
+// splitChunks splits the plaintext into chunks of the block size. The last
+// chunk holds the remainder. An empty plaintext is a single empty chunk.
+func splitChunks(plainText []byte, blockSize int) [][]byte {
+	chunks := make([][]byte, 0, len(plainText)/blockSize+1)
+	for len(plainText) > blockSize {
+		chunks = append(chunks, plainText[:blockSize])
+		plainText = plainText[blockSize:]
+	}
+	return append(chunks, plainText)
+}
+
+// chunkAdditionalData returns the additional data authenticated with a chunk
+// of a record. A record with a single chunk authenticates only the prefix, as
+// before chunking was added. The chunks of a longer record also authenticate
+// the nonce of the first chunk, the index of the chunk, and whether it is the
+// last chunk, so that chunks cannot be reordered, dropped, or moved between
+// records.
+//
+//	+--------+--------------+-------+-------+
+//	| prefix | record nonce | index | last  |
+//	|        |  (24 bytes)  |  (4)  |  (1)  |
+//	+--------+--------------+-------+-------+
+func chunkAdditionalData(
+	prefix, recordNonce []byte, index int, last bool) []byte {
+	if index == 0 && last {
+		return prefix
+	}
+
+	ad := make([]byte, 0, len(prefix)+len(recordNonce)+5)
+	ad = append(append(ad, prefix...), recordNonce...)
+	ad = binary.BigEndian.AppendUint32(ad, uint32(index))
+	if last {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
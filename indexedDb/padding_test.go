@@ -0,0 +1,211 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package indexedDb
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Max-Sum/base32768"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+// Tests that PaddingPolicy.bucket returns the expected bucket for each policy
+// and never exceeds the block size.
+func TestPaddingPolicy_bucket(t *testing.T) {
+	tests := []struct {
+		policy    PaddingPolicy
+		size      int
+		blockSize int
+		expected  int
+	}{
+		{FixedPadding, 0, 256, 256},
+		{FixedPadding, 100, 256, 256},
+		{PowerOfTwoPadding, 0, 256, 1},
+		{PowerOfTwoPadding, 1, 256, 1},
+		{PowerOfTwoPadding, 3, 256, 4},
+		{PowerOfTwoPadding, 64, 256, 64},
+		{PowerOfTwoPadding, 65, 256, 128},
+		{PowerOfTwoPadding, 200, 256, 256},
+		{PowerOfTwoPadding, 200, 300, 256},
+		{PowerOfTwoPadding, 257, 300, 300},
+		{PadmePadding, 0, 2048, 0},
+		{PadmePadding, 1, 2048, 1},
+		{PadmePadding, 9, 2048, 10},
+		{PadmePadding, 100, 2048, 104},
+		{PadmePadding, 1000, 2048, 1024},
+		{PadmePadding, 1025, 2048, 1088},
+		{PadmePadding, 1025, 1050, 1050},
+	}
+
+	for i, tt := range tests {
+		bucket := tt.policy.bucket(tt.size, tt.blockSize)
+		if bucket != tt.expected {
+			t.Errorf("Unexpected %s bucket for size %d (%d)."+
+				"\nexpected: %d\nreceived: %d",
+				tt.policy, tt.size, i, tt.expected, bucket)
+		}
+	}
+
+	// Padmé overhead is at most 12%
+	for size := 2; size < maxBucketSize; size++ {
+		bucket := PadmePadding.bucket(size, maxBucketSize)
+		if bucket < size || float64(bucket-size)/float64(size) > 0.12 {
+			t.Fatalf("Padmé bucket %d is not within 12%% of size %d.",
+				bucket, size)
+		}
+	}
+}
+
+// Tests that plaintexts in the same bucket encrypt to ciphertexts of the same
+// length and plaintexts in different buckets do not.
+func TestNewCipherWithPadding_CiphertextLength(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	c, err := NewCipherWithPadding(
+		[]byte("password"), []byte("salt"), PowerOfTwoPadding, 256, rng)
+	if err != nil {
+		t.Fatalf("Failed to create new Cipher: %+v", err)
+	}
+
+	decodedLen := func(plaintextLen int) int {
+		cipherText, err := c.Encrypt(make([]byte, plaintextLen))
+		if err != nil {
+			t.Fatalf("Failed to encrypt %d bytes: %+v", plaintextLen, err)
+		}
+		decoded, _ := base32768.SafeEncoding.DecodeString(cipherText)
+		return len(decoded)
+	}
+
+	if decodedLen(33) != decodedLen(64) {
+		t.Errorf("Plaintexts in the same bucket have different lengths.")
+	}
+	if decodedLen(32) == decodedLen(33) {
+		t.Errorf("Plaintexts in different buckets have the same length.")
+	}
+	if decodedLen(10) >= decodedLen(256) {
+		t.Errorf("Small plaintext not padded to a smaller bucket.")
+	}
+}
+
+// Tests that plaintexts longer than the block size are split into chunks that
+// are decrypted back into the original plaintext, including by a Keyring and
+// a Cipher loaded from JSON.
+func TestNewCipherWithPadding_Chunks(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	const blockSize = 64
+	for _, policy := range []PaddingPolicy{PowerOfTwoPadding, PadmePadding} {
+		c, err := NewCipherWithPadding(
+			[]byte("password"), []byte("salt"), policy, blockSize, rng)
+		if err != nil {
+			t.Fatalf("Failed to create new %s Cipher: %+v", policy, err)
+		}
+		data, _ := json.Marshal(c)
+		loaded, err := NewCipherFromJSON(data, rng)
+		if err != nil {
+			t.Fatalf("Failed to JSON unmarshal %s Cipher: %+v", policy, err)
+		}
+		if !reflect.DeepEqual(c, loaded) {
+			t.Errorf("Marshalled and unmarshaled %s Cipher does not match "+
+				"original.\nexpected: %+v\nreceived: %+v", policy, c, loaded)
+		}
+		kr, _ := NewKeyringFromCipher(loaded)
+		ciphers := map[string]Cipher{"cipher": c, "keyring": kr}
+
+		for _, size := range []int{0, 1, 63, 64, 65, 128, 129, 1000} {
+			plaintext := make([]byte, size)
+			_, _ = rng.Read(plaintext)
+
+			for name, ciph := range ciphers {
+				cipherText, err := ciph.Encrypt(plaintext)
+				if err != nil {
+					t.Fatalf("%s %s failed to encrypt %d bytes: %+v",
+						policy, name, size, err)
+				}
+				decrypted, err := ciph.Decrypt(cipherText)
+				if err != nil {
+					t.Errorf("%s %s failed to decrypt %d bytes: %+v",
+						policy, name, size, err)
+				} else if !bytes.Equal(plaintext, decrypted) {
+					t.Errorf("%s %s decrypted %d bytes do not match."+
+						"\nexpected: %v\nreceived: %v",
+						policy, name, size, plaintext, decrypted)
+				}
+			}
+		}
+	}
+}
+
+// Error path: tests that chunked ciphertexts fail to decrypt when chunks are
+// dropped, reordered, or moved to another record.
+func TestCipher_Decrypt_TamperedChunks(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	const blockSize = 64
+	c, _ := NewCipherWithPadding(
+		[]byte("password"), []byte("salt"), PadmePadding, blockSize, rng)
+	chunkLen := 24 + lengthOfOverhead + blockSize + 16
+
+	encrypt := func() []byte {
+		cipherText, err := c.Encrypt(make([]byte, 3*blockSize))
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %+v", err)
+		}
+		decoded, _ := base32768.SafeEncoding.DecodeString(cipherText)
+		if len(decoded) != 3*chunkLen {
+			t.Fatalf("Unexpected ciphertext length.\nexpected: %d"+
+				"\nreceived: %d", 3*chunkLen, len(decoded))
+		}
+		return decoded
+	}
+	a, b := encrypt(), encrypt()
+
+	swapped := append(append(append([]byte{}, a[chunkLen:2*chunkLen]...),
+		a[:chunkLen]...), a[2*chunkLen:]...)
+	moved := append(append([]byte{}, a[:chunkLen]...), b[chunkLen:]...)
+	tests := map[string][]byte{
+		"dropped last":  a[:2*chunkLen],
+		"dropped first": a[chunkLen:],
+		"single chunk":  a[:chunkLen],
+		"swapped":       swapped,
+		"moved":         moved,
+	}
+	for name, decoded := range tests {
+		cipherText := base32768.SafeEncoding.EncodeToString(decoded)
+		if _, err := c.Decrypt(cipherText); err == nil {
+			t.Errorf("Decrypted ciphertext with %s chunks.", name)
+		}
+	}
+}
+
+// Error path: tests that NewCipherWithPadding rejects unknown policies, block
+// sizes too large for a bucketed policy, and invalid block sizes, and that a
+// FixedPadding cipher still rejects plaintexts larger than the block size.
+func TestNewCipherWithPadding_Errors(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	pw, salt := []byte("password"), []byte("salt")
+
+	if _, err := NewCipherWithPadding(pw, salt, 3, 64, rng); err == nil {
+		t.Errorf("Failed to get error for unknown policy.")
+	}
+	_, err := NewCipherWithPadding(pw, salt, PadmePadding, maxBucketSize+1, rng)
+	if err == nil {
+		t.Errorf("Failed to get error for block size too large.")
+	}
+	if _, err = NewCipherWithPadding(pw, salt, PadmePadding, 0, rng); err == nil {
+		t.Errorf("Failed to get error for invalid block size.")
+	}
+
+	c, err := NewCipherWithPadding(pw, salt, FixedPadding, 64, rng)
+	if err != nil {
+		t.Fatalf("Failed to create new Cipher: %+v", err)
+	}
+	if _, err = c.Encrypt(make([]byte, 65)); err == nil {
+		t.Errorf("Failed to get error for plaintext larger than block size.")
+	}
+}
@@ -0,0 +1,246 @@
+////////////////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                                       //
+//                                                                                        //
+// Use of this source code is governed by a license that can be found in the LICENSE file //
+////////////////////////////////////////////////////////////////////////////////////////////
+
+package kem
+
+import (
+	"encoding/pem"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+
+	"gitlab.com/elixxir/crypto/nike"
+)
+
+// dhkemSecretSize is the size of the secret output by the DH-KEM.
+const dhkemSecretSize = blake2b.Size256
+
+var _ PrivateKey = (*dhkemPrivateKey)(nil)
+var _ PublicKey = (*dhkemPublicKey)(nil)
+var _ Scheme = (*dhkem)(nil)
+
+// dhkem implements the Scheme interface on top of a nike.Nike.
+type dhkem struct {
+	name   string
+	scheme nike.Nike
+}
+
+// NewDHKEM turns the given NIKE into a DH-KEM. A secret is encapsulated by
+// generating an ephemeral keypair and sending its public key as the
+// ciphertext. The shared secret is a hash of the name, the DH secret and both
+// public keys, so it is bound to the exchange that produced it.
+func NewDHKEM(name string, scheme nike.Nike) Scheme {
+	return &dhkem{
+		name:   name,
+		scheme: scheme,
+	}
+}
+
+func (d *dhkem) Name() string { return d.name }
+
+func (d *dhkem) PublicKeySize() int {
+	return d.scheme.PublicKeySize()
+}
+
+func (d *dhkem) PrivateKeySize() int {
+	return d.scheme.PrivateKeySize()
+}
+
+func (d *dhkem) CiphertextSize() int {
+	return d.scheme.PublicKeySize()
+}
+
+func (d *dhkem) SharedSecretSize() int {
+	return dhkemSecretSize
+}
+
+func (d *dhkem) NewKeypair(rng io.Reader) (PrivateKey, PublicKey) {
+	privKey, pubKey := d.scheme.NewKeypair(rng)
+	return &dhkemPrivateKey{
+		scheme:     d,
+		privateKey: privKey,
+	}, &dhkemPublicKey{
+		scheme:    d,
+		publicKey: pubKey,
+	}
+}
+
+// Encapsulate generates an ephemeral keypair and derives a secret between it
+// and the given public key. The ciphertext is the ephemeral public key.
+func (d *dhkem) Encapsulate(publicKey PublicKey, rng io.Reader) (
+	ciphertext, sharedSecret []byte, err error) {
+	pubKey, ok := publicKey.(*dhkemPublicKey)
+	if !ok || pubKey.scheme.scheme != d.scheme {
+		return nil, nil, errors.Errorf(
+			"public key must be from the %s scheme", d.name)
+	}
+
+	ephemeralPrivKey, ephemeralPubKey := d.scheme.NewKeypair(rng)
+	defer ephemeralPrivKey.Reset()
+
+	secret, err := deriveSecret(ephemeralPrivKey, pubKey.publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ciphertext = ephemeralPubKey.Bytes()
+	return ciphertext, d.combine(secret, ciphertext,
+		pubKey.publicKey.Bytes()), nil
+}
+
+// Decapsulate parses the ephemeral public key from the ciphertext and
+// derives the secret between it and the given private key.
+func (d *dhkem) Decapsulate(privateKey PrivateKey, ciphertext []byte) (
+	sharedSecret []byte, err error) {
+	privKey, ok := privateKey.(*dhkemPrivateKey)
+	if !ok || privKey.scheme.scheme != d.scheme {
+		return nil, errors.Errorf(
+			"private key must be from the %s scheme", d.name)
+	}
+	if len(ciphertext) != d.CiphertextSize() {
+		return nil, errors.Errorf("invalid ciphertext size: %d != %d",
+			len(ciphertext), d.CiphertextSize())
+	}
+
+	ephemeralPubKey, err := d.scheme.UnmarshalBinaryPublicKey(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := deriveSecret(privKey.privateKey, ephemeralPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey := d.scheme.DerivePublicKey(privKey.privateKey)
+	return d.combine(secret, ciphertext, pubKey.Bytes()), nil
+}
+
+func (d *dhkem) UnmarshalBinaryPublicKey(b []byte) (PublicKey, error) {
+	pubKey := d.NewEmptyPublicKey()
+	err := pubKey.FromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return pubKey, nil
+}
+
+func (d *dhkem) UnmarshalBinaryPrivateKey(b []byte) (PrivateKey, error) {
+	privKey := d.NewEmptyPrivateKey()
+	err := privKey.FromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return privKey, nil
+}
+
+func (d *dhkem) NewEmptyPrivateKey() PrivateKey {
+	return &dhkemPrivateKey{
+		scheme:     d,
+		privateKey: d.scheme.NewEmptyPrivateKey(),
+	}
+}
+
+func (d *dhkem) NewEmptyPublicKey() PublicKey {
+	return &dhkemPublicKey{
+		scheme:    d,
+		publicKey: d.scheme.NewEmptyPublicKey(),
+	}
+}
+
+func (d *dhkem) DerivePublicKey(privKey PrivateKey) PublicKey {
+	return &dhkemPublicKey{
+		scheme: d,
+		publicKey: d.scheme.DerivePublicKey(
+			privKey.(*dhkemPrivateKey).privateKey),
+	}
+}
+
+// combine hashes the DH secret with the ephemeral and recipient public keys.
+func (d *dhkem) combine(secret, ephemeralPubKey, pubKey []byte) []byte {
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte(d.name))
+	h.Write(secret)
+	h.Write(ephemeralPubKey)
+	h.Write(pubKey)
+	return h.Sum(nil)
+}
+
+// deriveSecret calls DeriveSecret on the private key, converting a panic into
+// an error. Several NIKE implementations panic on invalid public keys, which
+// must not crash the process when the key is read from a ciphertext.
+func deriveSecret(privKey nike.PrivateKey, pubKey nike.PublicKey) (
+	secret []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("failed to derive secret: %v", r)
+		}
+	}()
+	return privKey.DeriveSecret(pubKey), nil
+}
+
+// dhkemPrivateKey is an implementation of the PrivateKey interface wrapping a
+// nike.PrivateKey.
+type dhkemPrivateKey struct {
+	scheme     *dhkem
+	privateKey nike.PrivateKey
+}
+
+func (p *dhkemPrivateKey) Scheme() Scheme {
+	return p.scheme
+}
+
+func (p *dhkemPrivateKey) Reset() {
+	p.privateKey.Reset()
+}
+
+func (p *dhkemPrivateKey) Bytes() []byte {
+	return p.privateKey.Bytes()
+}
+
+func (p *dhkemPrivateKey) FromBytes(data []byte) error {
+	return p.privateKey.FromBytes(data)
+}
+
+func (p *dhkemPrivateKey) ToPEMFile(f string) error {
+	return PrivateKeyToPEMFile(p, f)
+}
+
+func (p *dhkemPrivateKey) ToPEM() (*pem.Block, error) {
+	return PrivateKeyToPEM(p)
+}
+
+// dhkemPublicKey is an implementation of the PublicKey interface wrapping a
+// nike.PublicKey.
+type dhkemPublicKey struct {
+	scheme    *dhkem
+	publicKey nike.PublicKey
+}
+
+func (p *dhkemPublicKey) Scheme() Scheme {
+	return p.scheme
+}
+
+func (p *dhkemPublicKey) Reset() {
+	p.publicKey.Reset()
+}
+
+func (p *dhkemPublicKey) Bytes() []byte {
+	return p.publicKey.Bytes()
+}
+
+func (p *dhkemPublicKey) FromBytes(data []byte) error {
+	return p.publicKey.FromBytes(data)
+}
+
+func (p *dhkemPublicKey) ToPEMFile(f string) error {
+	return PublicKeyToPEMFile(p, f)
+}
+
+func (p *dhkemPublicKey) ToPEM() (*pem.Block, error) {
+	return PublicKeyToPEM(p)
+}
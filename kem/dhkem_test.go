@@ -0,0 +1,114 @@
+////////////////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                                       //
+//                                                                                        //
+// Use of this source code is governed by a license that can be found in the LICENSE file //
+////////////////////////////////////////////////////////////////////////////////////////////
+
+package kem
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/crypto/csprng"
+
+	"gitlab.com/elixxir/crypto/nike"
+	"gitlab.com/elixxir/crypto/nike/dh"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+)
+
+var testSchemes = []struct {
+	name   string
+	scheme nike.Nike
+}{
+	{"ECDH", ecdh.ECDHNIKE},
+	{"DH", dh.DHNIKE},
+}
+
+func TestDHKEM_EncapsulateDecapsulate(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	for _, tt := range testSchemes {
+		scheme := NewDHKEM(tt.name, tt.scheme)
+		bobPrivateKey, bobPublicKey := scheme.NewKeypair(rng)
+
+		ciphertext, secret1, err := scheme.Encapsulate(bobPublicKey, rng)
+		require.NoError(t, err, tt.name)
+		require.Len(t, ciphertext, scheme.CiphertextSize(), tt.name)
+		require.Len(t, secret1, scheme.SharedSecretSize(), tt.name)
+
+		secret2, err := scheme.Decapsulate(bobPrivateKey, ciphertext)
+		require.NoError(t, err, tt.name)
+
+		require.Equal(t, secret1, secret2, tt.name)
+	}
+}
+
+// Tests that a secret decapsulated with the wrong private key does not match.
+func TestDHKEM_Decapsulate_WrongKey(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	scheme := NewDHKEM("ECDH", ecdh.ECDHNIKE)
+	_, bobPublicKey := scheme.NewKeypair(rng)
+	malloryPrivateKey, _ := scheme.NewKeypair(rng)
+
+	ciphertext, secret1, err := scheme.Encapsulate(bobPublicKey, rng)
+	require.NoError(t, err)
+
+	secret2, err := scheme.Decapsulate(malloryPrivateKey, ciphertext)
+	require.NoError(t, err)
+	require.NotEqual(t, secret1, secret2)
+}
+
+// Tests that keys from another scheme and malformed ciphertexts are rejected.
+func TestDHKEM_InvalidInputs(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	ecdhKEM := NewDHKEM("ECDH", ecdh.ECDHNIKE)
+	dhKEM := NewDHKEM("DH", dh.DHNIKE)
+	ecdhPrivateKey, ecdhPublicKey := ecdhKEM.NewKeypair(rng)
+
+	_, _, err := dhKEM.Encapsulate(ecdhPublicKey, rng)
+	require.Error(t, err)
+
+	_, err = dhKEM.Decapsulate(ecdhPrivateKey, make([]byte, 32))
+	require.Error(t, err)
+
+	_, err = ecdhKEM.Decapsulate(ecdhPrivateKey, []byte{1, 2, 3})
+	require.Error(t, err)
+
+	// The identity point decodes but produces an all zero X25519 output,
+	// which ecdh panics on.
+	identity := make([]byte, ecdhKEM.CiphertextSize())
+	identity[0] = 1
+	_, err = ecdhKEM.Decapsulate(ecdhPrivateKey, identity)
+	require.Error(t, err)
+}
+
+func TestDHKEM_PrivateKeyMarshaling(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	scheme := NewDHKEM("ECDH", ecdh.ECDHNIKE)
+	alicePrivateKey, _ := scheme.NewKeypair(rng)
+
+	alicePrivateKeyBytes := alicePrivateKey.Bytes()
+	alice2PrivateKey, err := scheme.UnmarshalBinaryPrivateKey(
+		alicePrivateKeyBytes)
+	require.NoError(t, err)
+
+	require.Equal(t, alicePrivateKeyBytes, alice2PrivateKey.Bytes())
+	require.Equal(t, len(alicePrivateKeyBytes), scheme.PrivateKeySize())
+	require.Equal(t, scheme, alice2PrivateKey.Scheme())
+}
+
+func TestDHKEM_PublicKeyMarshaling(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	scheme := NewDHKEM("ECDH", ecdh.ECDHNIKE)
+	alicePrivateKey, alicePublicKey := scheme.NewKeypair(rng)
+
+	alicePublicKeyBytes := alicePublicKey.Bytes()
+	alice2PublicKey, err := scheme.UnmarshalBinaryPublicKey(
+		alicePublicKeyBytes)
+	require.NoError(t, err)
+
+	require.Equal(t, alicePublicKeyBytes, alice2PublicKey.Bytes())
+	require.Equal(t, len(alicePublicKeyBytes), scheme.PublicKeySize())
+	require.Equal(t, alicePublicKeyBytes,
+		scheme.DerivePublicKey(alicePrivateKey).Bytes())
+}
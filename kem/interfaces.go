@@ -0,0 +1,93 @@
+////////////////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                                       //
+//                                                                                        //
+// Use of this source code is governed by a license that can be found in the LICENSE file //
+////////////////////////////////////////////////////////////////////////////////////////////
+
+// Package kem contains the interfaces for key encapsulation mechanisms. It is
+// the interactive counterpart to the nike package: rather than both parties
+// deriving a secret from each other's public keys, the sender encapsulates a
+// fresh secret to the recipient's public key and sends the ciphertext along.
+package kem
+
+import "io"
+
+// Key is an interface for types encapsulating key material.
+type Key interface {
+
+	// Reset resets the key material to all zeros.
+	Reset()
+
+	// Bytes serializes key material into a byte slice.
+	Bytes() []byte
+
+	// FromBytes copys key material from the given byte slice and
+	// initializes the Key
+	FromBytes(data []byte) error
+
+	Scheme() Scheme
+}
+
+// PrivateKey is an interface for types encapsulating
+// private key material.
+type PrivateKey interface {
+	Key
+}
+
+// PublicKey is an interface for types encapsulating
+// public key material.
+type PublicKey interface {
+	Key
+}
+
+// Scheme is an interface encapsulating a key encapsulation
+// mechanism.
+type Scheme interface {
+
+	// Name returns the name of the scheme.
+	Name() string
+
+	// PublicKeySize returns the size in bytes of the public key.
+	PublicKeySize() int
+
+	// PrivateKeySize returns the size in bytes of the private key.
+	PrivateKeySize() int
+
+	// CiphertextSize returns the size in bytes of an encapsulated
+	// secret.
+	CiphertextSize() int
+
+	// SharedSecretSize returns the size in bytes of the shared secret.
+	SharedSecretSize() int
+
+	// NewKeypair returns a newly generated key pair.
+	NewKeypair(rng io.Reader) (PrivateKey, PublicKey)
+
+	// Encapsulate generates a fresh shared secret for the given
+	// public key and returns it along with the ciphertext that
+	// carries it to the owner of the public key.
+	Encapsulate(publicKey PublicKey, rng io.Reader) (
+		ciphertext, sharedSecret []byte, err error)
+
+	// Decapsulate recovers the shared secret carried by the
+	// ciphertext using the given private key.
+	Decapsulate(privateKey PrivateKey, ciphertext []byte) (
+		sharedSecret []byte, err error)
+
+	// UnmarshalBinaryPublicKey unmarshals the public key bytes.
+	UnmarshalBinaryPublicKey(b []byte) (PublicKey, error)
+
+	// UnmarshalBinaryPrivateKey unmarshals the private key bytes.
+	UnmarshalBinaryPrivateKey(b []byte) (PrivateKey, error)
+
+	// NewEmptyPrivateKey is helper method used to help
+	// implement UnmarshalBinaryPrivateKey.
+	NewEmptyPrivateKey() PrivateKey
+
+	// NewEmptyPublicKey is a helper method used to help
+	// implement UnmarshalBinaryPublicKey.
+	NewEmptyPublicKey() PublicKey
+
+	// DerivePublicKey derives a public key given a private key.
+	DerivePublicKey(PrivateKey) PublicKey
+}
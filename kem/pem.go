@@ -0,0 +1,113 @@
+////////////////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                                       //
+//                                                                                        //
+// Use of this source code is governed by a license that can be found in the LICENSE file //
+////////////////////////////////////////////////////////////////////////////////////////////
+
+package kem
+
+import (
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	publicKeyPEMSuffix  = " PUBLIC KEY"
+	privateKeyPEMSuffix = " PRIVATE KEY"
+)
+
+// PublicKeyToPEM encodes the public key into a PEM block whose type is the
+// upper case scheme name followed by "PUBLIC KEY".
+func PublicKeyToPEM(pubKey PublicKey) (*pem.Block, error) {
+	return &pem.Block{
+		Type:  pemType(pubKey.Scheme(), publicKeyPEMSuffix),
+		Bytes: pubKey.Bytes(),
+	}, nil
+}
+
+// PrivateKeyToPEM encodes the private key into a PEM block whose type is the
+// upper case scheme name followed by "PRIVATE KEY".
+func PrivateKeyToPEM(privKey PrivateKey) (*pem.Block, error) {
+	return &pem.Block{
+		Type:  pemType(privKey.Scheme(), privateKeyPEMSuffix),
+		Bytes: privKey.Bytes(),
+	}, nil
+}
+
+// PublicKeyToPEMFile writes the PEM encoded public key to the given file.
+func PublicKeyToPEMFile(pubKey PublicKey, f string) error {
+	block, err := PublicKeyToPEM(pubKey)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f, pem.EncodeToMemory(block), 0644)
+}
+
+// PrivateKeyToPEMFile writes the PEM encoded private key to the given file.
+// The file is only readable by its owner.
+func PrivateKeyToPEMFile(privKey PrivateKey, f string) error {
+	block, err := PrivateKeyToPEM(privKey)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(f, pem.EncodeToMemory(block), 0600)
+}
+
+// PublicKeyFromPEM decodes a public key of the given scheme from a PEM
+// block. Returns an error if the block type does not match the scheme.
+func PublicKeyFromPEM(scheme Scheme, block *pem.Block) (PublicKey, error) {
+	expected := pemType(scheme, publicKeyPEMSuffix)
+	if block == nil || block.Type != expected {
+		return nil, errors.Errorf("PEM block is not of type %s", expected)
+	}
+	return scheme.UnmarshalBinaryPublicKey(block.Bytes)
+}
+
+// PrivateKeyFromPEM decodes a private key of the given scheme from a PEM
+// block. Returns an error if the block type does not match the scheme.
+func PrivateKeyFromPEM(scheme Scheme, block *pem.Block) (PrivateKey, error) {
+	expected := pemType(scheme, privateKeyPEMSuffix)
+	if block == nil || block.Type != expected {
+		return nil, errors.Errorf("PEM block is not of type %s", expected)
+	}
+	return scheme.UnmarshalBinaryPrivateKey(block.Bytes)
+}
+
+// PublicKeyFromPEMFile reads a PEM encoded public key of the given scheme
+// from the file.
+func PublicKeyFromPEMFile(scheme Scheme, f string) (PublicKey, error) {
+	block, err := readPEMFile(f)
+	if err != nil {
+		return nil, err
+	}
+	return PublicKeyFromPEM(scheme, block)
+}
+
+// PrivateKeyFromPEMFile reads a PEM encoded private key of the given scheme
+// from the file.
+func PrivateKeyFromPEMFile(scheme Scheme, f string) (PrivateKey, error) {
+	block, err := readPEMFile(f)
+	if err != nil {
+		return nil, err
+	}
+	return PrivateKeyFromPEM(scheme, block)
+}
+
+func readPEMFile(f string) (*pem.Block, error) {
+	data, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("failed to decode PEM file %s", f)
+	}
+	return block, nil
+}
+
+func pemType(scheme Scheme, suffix string) string {
+	return strings.ToUpper(scheme.Name()) + suffix
+}
@@ -0,0 +1,76 @@
+////////////////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                                       //
+//                                                                                        //
+// Use of this source code is governed by a license that can be found in the LICENSE file //
+////////////////////////////////////////////////////////////////////////////////////////////
+
+package kem
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/crypto/csprng"
+
+	"gitlab.com/elixxir/crypto/nike/dh"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+)
+
+func TestPEM(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	scheme := NewDHKEM("ECDH", ecdh.ECDHNIKE)
+	privKey, pubKey := scheme.NewKeypair(rng)
+
+	pubBlock, err := PublicKeyToPEM(pubKey)
+	require.NoError(t, err)
+	require.Equal(t, "ECDH PUBLIC KEY", pubBlock.Type)
+	privBlock, err := PrivateKeyToPEM(privKey)
+	require.NoError(t, err)
+	require.Equal(t, "ECDH PRIVATE KEY", privBlock.Type)
+
+	pubKey2, err := PublicKeyFromPEM(scheme, pubBlock)
+	require.NoError(t, err)
+	require.Equal(t, pubKey.Bytes(), pubKey2.Bytes())
+	privKey2, err := PrivateKeyFromPEM(scheme, privBlock)
+	require.NoError(t, err)
+	require.Equal(t, privKey.Bytes(), privKey2.Bytes())
+
+	// Blocks must not be accepted as the wrong key type or scheme
+	_, err = PublicKeyFromPEM(scheme, privBlock)
+	require.Error(t, err)
+	_, err = PrivateKeyFromPEM(scheme, pubBlock)
+	require.Error(t, err)
+	_, err = PublicKeyFromPEM(NewDHKEM("DH", dh.DHNIKE), pubBlock)
+	require.Error(t, err)
+	_, err = PublicKeyFromPEM(scheme, nil)
+	require.Error(t, err)
+}
+
+func TestPEMFile(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	scheme := NewDHKEM("ECDH", ecdh.ECDHNIKE)
+	privKey, pubKey := scheme.NewKeypair(rng)
+
+	dir := t.TempDir()
+	pubFile := filepath.Join(dir, "key.pub")
+	privFile := filepath.Join(dir, "key.priv")
+
+	require.NoError(t, pubKey.(*dhkemPublicKey).ToPEMFile(pubFile))
+	require.NoError(t, privKey.(*dhkemPrivateKey).ToPEMFile(privFile))
+
+	pubKey2, err := PublicKeyFromPEMFile(scheme, pubFile)
+	require.NoError(t, err)
+	require.Equal(t, pubKey.Bytes(), pubKey2.Bytes())
+
+	privKey2, err := PrivateKeyFromPEMFile(scheme, privFile)
+	require.NoError(t, err)
+	require.Equal(t, privKey.Bytes(), privKey2.Bytes())
+
+	block, err := privKey.(*dhkemPrivateKey).ToPEM()
+	require.NoError(t, err)
+	require.Equal(t, "ECDH PRIVATE KEY", block.Type)
+
+	_, err = PublicKeyFromPEMFile(scheme, filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
@@ -11,6 +11,7 @@ package ctidh
 
 import (
 	"encoding/pem"
+	"io"
 
 	ctidh "git.xx.network/elixxir/ctidh_cgo"
 
@@ -44,8 +45,9 @@ func (e *ctidhNIKE) PrivateKeySize() int {
 	return ctidh.PrivateKeySize
 }
 
-// NewKeypair returns a newly generated key pair.
-func (e *ctidhNIKE) NewKeypair() (nike.PrivateKey, nike.PublicKey) {
+// NewKeypair returns a newly generated key pair. The rng is unused, as the
+// underlying ctidh library draws its own randomness.
+func (e *ctidhNIKE) NewKeypair(io.Reader) (nike.PrivateKey, nike.PublicKey) {
 	privKey, pubKey := ctidh.GenerateKeyPair()
 	return &PrivateKey{
 			privateKey: privKey,
@@ -13,11 +13,13 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/crypto/csprng"
 )
 
 func TestNike(t *testing.T) {
-	alicePrivateKey, alicePublicKey := CTIDHNIKE.NewKeypair()
-	bobPrivateKey, bobPublicKey := CTIDHNIKE.NewKeypair()
+	rng := csprng.NewSystemRNG()
+	alicePrivateKey, alicePublicKey := CTIDHNIKE.NewKeypair(rng)
+	bobPrivateKey, bobPublicKey := CTIDHNIKE.NewKeypair(rng)
 
 	secret1 := alicePrivateKey.DeriveSecret(bobPublicKey)
 	secret2 := bobPrivateKey.DeriveSecret(alicePublicKey)
@@ -26,10 +28,11 @@ func TestNike(t *testing.T) {
 }
 
 func TestPrivateKeyMarshaling(t *testing.T) {
-	alicePrivateKey, _ := CTIDHNIKE.NewKeypair()
+	rng := csprng.NewSystemRNG()
+	alicePrivateKey, _ := CTIDHNIKE.NewKeypair(rng)
 
 	alicePrivateKeyBytes := alicePrivateKey.Bytes()
-	alice2PrivateKey, _ := CTIDHNIKE.NewKeypair()
+	alice2PrivateKey, _ := CTIDHNIKE.NewKeypair(rng)
 
 	err := alice2PrivateKey.FromBytes(alicePrivateKeyBytes)
 	require.NoError(t, err)
@@ -48,10 +51,11 @@ func TestPrivateKeyMarshaling(t *testing.T) {
 }
 
 func TestPublicKeyMarshaling(t *testing.T) {
-	_, alicePublicKey := CTIDHNIKE.NewKeypair()
+	rng := csprng.NewSystemRNG()
+	_, alicePublicKey := CTIDHNIKE.NewKeypair(rng)
 
 	alicePublicKeyBytes := alicePublicKey.Bytes()
-	_, alice2PublicKey := CTIDHNIKE.NewKeypair()
+	_, alice2PublicKey := CTIDHNIKE.NewKeypair(rng)
 
 	err := alice2PublicKey.FromBytes(alicePublicKeyBytes)
 	require.NoError(t, err)
@@ -0,0 +1,20 @@
+//go:build ctidh
+// +build ctidh
+
+////////////////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                                       //
+//                                                                                        //
+// Use of this source code is governed by a license that can be found in the LICENSE file //
+////////////////////////////////////////////////////////////////////////////////////////////
+
+package hybrid
+
+import (
+	"gitlab.com/elixxir/crypto/nike"
+	"gitlab.com/elixxir/crypto/nike/ctidh"
+	"gitlab.com/elixxir/crypto/nike/dh"
+)
+
+// CTIDHDiffieHellman is a hybrid of CTIDH and 2048-bit Diffie-Hellman.
+var CTIDHDiffieHellman nike.Nike = New("CTIDHDiffieHellman",
+	ctidh.CTIDHNIKE, dh.DHNIKE)
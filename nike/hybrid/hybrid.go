@@ -1,24 +1,38 @@
-//go:build ctidh
-// +build ctidh
-
 ////////////////////////////////////////////////////////////////////////////////////////////
 // Copyright © 2024 xx foundation                                                       //
 //                                                                                        //
 // Use of this source code is governed by a license that can be found in the LICENSE file //
 ////////////////////////////////////////////////////////////////////////////////////////////
 
+// Package hybrid combines key exchange schemes so that the result is as
+// strong as the strongest of its parts.
 package hybrid
 
 import (
+	"hash"
+	"io"
+
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/hkdf"
+
 	"gitlab.com/elixxir/crypto/nike"
-	"gitlab.com/elixxir/crypto/nike/ctidh"
-	"gitlab.com/elixxir/crypto/nike/dh"
 )
 
-var CTIDHDiffieHellman nike.Nike = &scheme{
-	name:   "CTIDHDiffieHellman",
-	first:  ctidh.CTIDHNIKE,
-	second: dh.DHNIKE,
+var _ nike.PrivateKey = (*privateKey)(nil)
+var _ nike.PublicKey = (*publicKey)(nil)
+var _ nike.Nike = (*scheme)(nil)
+
+// New returns a nike.Nike which runs both of the given schemes side by side.
+// Keys are the concatenation of the keys of each scheme, and the secrets
+// derived by each scheme are combined with HKDF, using the name as the info
+// parameter, so the derived secret is bound to this particular hybrid.
+func New(name string, first, second nike.Nike) nike.Nike {
+	return &scheme{
+		name:   name,
+		first:  first,
+		second: second,
+	}
 }
 
 type scheme struct {
@@ -27,24 +41,26 @@ type scheme struct {
 	second nike.Nike
 }
 
-func (s *scheme) NewKeypair() (nike.PrivateKey, nike.PublicKey) {
-	privKey1, pubKey1 := s.first.NewKeypair()
-	privKey2, pubKey2 := s.second.NewKeypair()
+func (s *scheme) NewKeypair(rng io.Reader) (nike.PrivateKey, nike.PublicKey) {
+	privKey1, pubKey1 := s.first.NewKeypair(rng)
+	privKey2, pubKey2 := s.second.NewKeypair(rng)
 	return &privateKey{
-			first:  privKey1,
-			second: privKey2,
-		}, &publicKey{
-			first:  pubKey1,
-			second: pubKey2,
-		}
+		scheme: s,
+		first:  privKey1,
+		second: privKey2,
+	}, &publicKey{
+		scheme: s,
+		first:  pubKey1,
+		second: pubKey2,
+	}
 }
 
 func (s *scheme) DerivePublicKey(privKey nike.PrivateKey) nike.PublicKey {
-	pubKey1 := privKey.(*privateKey).first.Scheme().DerivePublicKey(privKey.(*privateKey).first)
-	pubKey2 := privKey.(*privateKey).second.Scheme().DerivePublicKey(privKey.(*privateKey).second)
+	p := privKey.(*privateKey)
 	return &publicKey{
-		first:  pubKey1,
-		second: pubKey2,
+		scheme: s,
+		first:  s.first.DerivePublicKey(p.first),
+		second: s.second.DerivePublicKey(p.second),
 	}
 }
 
@@ -60,6 +76,7 @@ func (s *scheme) PrivateKeySize() int {
 
 func (s *scheme) NewEmptyPrivateKey() nike.PrivateKey {
 	return &privateKey{
+		scheme: s,
 		first:  s.first.NewEmptyPrivateKey(),
 		second: s.second.NewEmptyPrivateKey(),
 	}
@@ -67,6 +84,7 @@ func (s *scheme) NewEmptyPrivateKey() nike.PrivateKey {
 
 func (s *scheme) NewEmptyPublicKey() nike.PublicKey {
 	return &publicKey{
+		scheme: s,
 		first:  s.first.NewEmptyPublicKey(),
 		second: s.second.NewEmptyPublicKey(),
 	}
@@ -90,19 +108,39 @@ func (s *scheme) UnmarshalBinaryPrivateKey(b []byte) (nike.PrivateKey, error) {
 	return privKey, nil
 }
 
+// kdf combines the secrets derived by each scheme into a single secret.
+func (s *scheme) kdf(secret1, secret2 []byte) []byte {
+	h := func() hash.Hash {
+		h, _ := blake2b.New256(nil)
+		return h
+	}
+
+	secret := make([]byte, 0, len(secret1)+len(secret2))
+	secret = append(secret, secret1...)
+	secret = append(secret, secret2...)
+
+	hkdfReader := hkdf.New(h, secret, nil, []byte(s.name))
+	key := make([]byte, sharedSecretSize)
+	if _, err := io.ReadFull(hkdfReader, key); err != nil {
+		jww.FATAL.Panicf("Failed to read key bytes: %+v", err)
+	}
+	return key
+}
+
 type privateKey struct {
+	scheme *scheme
 	first  nike.PrivateKey
 	second nike.PrivateKey
 }
 
 func (p *privateKey) Scheme() nike.Nike {
-	return CTIDHDiffieHellman
+	return p.scheme
 }
 
 func (p *privateKey) DeriveSecret(pubKey nike.PublicKey) []byte {
 	secret1 := p.first.DeriveSecret(pubKey.(*publicKey).first)
 	secret2 := p.second.DeriveSecret(pubKey.(*publicKey).second)
-	return append(secret1, secret2...)
+	return p.scheme.kdf(secret1, secret2)
 }
 
 func (p *privateKey) Bytes() []byte {
@@ -110,30 +148,35 @@ func (p *privateKey) Bytes() []byte {
 }
 
 func (p *privateKey) Reset() {
-	p.first = nil
-	p.second = nil
+	p.first.Reset()
+	p.second.Reset()
 }
 
 func (p *privateKey) FromBytes(data []byte) error {
-	err := p.first.FromBytes(data[:p.first.Scheme().PrivateKeySize()])
+	if len(data) != p.scheme.PrivateKeySize() {
+		return ErrInvalidKeySize
+	}
+	firstSize := p.scheme.first.PrivateKeySize()
+	err := p.first.FromBytes(data[:firstSize])
 	if err != nil {
 		return err
 	}
-	return p.second.FromBytes(data[p.first.Scheme().PrivateKeySize():])
+	return p.second.FromBytes(data[firstSize:])
 }
 
 type publicKey struct {
+	scheme *scheme
 	first  nike.PublicKey
 	second nike.PublicKey
 }
 
 func (p *publicKey) Scheme() nike.Nike {
-	return CTIDHDiffieHellman
+	return p.scheme
 }
 
 func (p *publicKey) Reset() {
-	p.first = nil
-	p.second = nil
+	p.first.Reset()
+	p.second.Reset()
 }
 
 func (p *publicKey) Bytes() []byte {
@@ -141,9 +184,13 @@ func (p *publicKey) Bytes() []byte {
 }
 
 func (p *publicKey) FromBytes(data []byte) error {
-	err := p.first.FromBytes(data[:p.first.Scheme().PublicKeySize()])
+	if len(data) != p.scheme.PublicKeySize() {
+		return ErrInvalidKeySize
+	}
+	firstSize := p.scheme.first.PublicKeySize()
+	err := p.first.FromBytes(data[:firstSize])
 	if err != nil {
 		return err
 	}
-	return p.second.FromBytes(data[p.first.Scheme().PublicKeySize():])
+	return p.second.FromBytes(data[firstSize:])
 }
@@ -1,6 +1,3 @@
-//go:build ctidh
-// +build ctidh
-
 ////////////////////////////////////////////////////////////////////////////////////////////
 // Copyright © 2024 xx foundation                                                       //
 //                                                                                        //
@@ -10,26 +7,75 @@
 package hybrid
 
 import (
+	"encoding/base64"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/crypto/csprng"
+
+	"gitlab.com/elixxir/crypto/nike/dh"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
 )
 
-func TestNike(t *testing.T) {
-	alicePrivateKey, alicePublicKey := CTIDHDiffieHellman.NewKeypair()
-	bobPrivateKey, bobPublicKey := CTIDHDiffieHellman.NewKeypair()
+var ecdhDiffieHellman = New("ECDHDiffieHellman", ecdh.ECDHNIKE, dh.DHNIKE)
+
+func TestNew_Nike(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivateKey, alicePublicKey := ecdhDiffieHellman.NewKeypair(rng)
+	bobPrivateKey, bobPublicKey := ecdhDiffieHellman.NewKeypair(rng)
 
 	secret1 := alicePrivateKey.DeriveSecret(bobPublicKey)
 	secret2 := bobPrivateKey.DeriveSecret(alicePublicKey)
 
 	require.Equal(t, secret1, secret2)
+	require.Len(t, secret1, sharedSecretSize)
 }
 
-func TestPrivateKeyMarshaling(t *testing.T) {
-	alicePrivateKey, _ := CTIDHDiffieHellman.NewKeypair()
+// Consistency test of DeriveSecret for an ECDH and DH hybrid.
+func TestNew_DeriveSecret_Consistency(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	expectedSecrets := []string{
+		"1L54jGkIwt0moCaPJ4UqHqCCSndh7WEjdOSjD6fTcY4=",
+		"uo8tOUIFPW3JdxuT7wK09obvJEuE/klNJ/nSKx+MFV4=",
+		"zCOfN6Ojy0/wsB2980ZZ0+lP+4pofAJnWtAMqoLYBl8=",
+	}
+
+	for i, expected := range expectedSecrets {
+		alicePrivateKey, _ := ecdhDiffieHellman.NewKeypair(prng)
+		_, bobPublicKey := ecdhDiffieHellman.NewKeypair(prng)
+
+		secret := base64.StdEncoding.EncodeToString(
+			alicePrivateKey.DeriveSecret(bobPublicKey))
+		require.Equal(t, expected, secret, "secret %d", i)
+	}
+}
+
+// Tests that the name of the hybrid is bound into the derived secret, so the
+// same keys used in hybrids with different names derive different secrets.
+func TestNew_DeriveSecret_NameSeparation(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	other := New("OtherName", ecdh.ECDHNIKE, dh.DHNIKE)
+
+	alicePrivateKey, _ := ecdhDiffieHellman.NewKeypair(rng)
+	_, bobPublicKey := ecdhDiffieHellman.NewKeypair(rng)
+
+	otherPrivateKey, err := other.UnmarshalBinaryPrivateKey(
+		alicePrivateKey.Bytes())
+	require.NoError(t, err)
+	otherPublicKey, err := other.UnmarshalBinaryPublicKey(bobPublicKey.Bytes())
+	require.NoError(t, err)
+
+	require.NotEqual(t, alicePrivateKey.DeriveSecret(bobPublicKey),
+		otherPrivateKey.DeriveSecret(otherPublicKey))
+}
+
+func TestNew_PrivateKeyMarshaling(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivateKey, alicePublicKey := ecdhDiffieHellman.NewKeypair(rng)
 
 	alicePrivateKeyBytes := alicePrivateKey.Bytes()
-	alice2PrivateKey, _ := CTIDHDiffieHellman.NewKeypair()
+	alice2PrivateKey, _ := ecdhDiffieHellman.NewKeypair(rng)
 
 	err := alice2PrivateKey.FromBytes(alicePrivateKeyBytes)
 	require.NoError(t, err)
@@ -38,20 +84,29 @@ func TestPrivateKeyMarshaling(t *testing.T) {
 
 	require.Equal(t, alice2PrivateKeyBytes, alicePrivateKeyBytes)
 
-	alice3PrivateKey, err := CTIDHDiffieHellman.UnmarshalBinaryPrivateKey(alice2PrivateKeyBytes)
+	alice3PrivateKey, err := ecdhDiffieHellman.UnmarshalBinaryPrivateKey(
+		alice2PrivateKeyBytes)
 	require.NoError(t, err)
 
 	alice3PrivateKeyBytes := alice3PrivateKey.Bytes()
 
 	require.Equal(t, alice3PrivateKeyBytes, alice2PrivateKeyBytes)
-	require.Equal(t, len(alice3PrivateKeyBytes), CTIDHDiffieHellman.PrivateKeySize())
+	require.Equal(t, len(alice3PrivateKeyBytes),
+		ecdhDiffieHellman.PrivateKeySize())
+	require.Equal(t, ecdhDiffieHellman, alice3PrivateKey.Scheme())
+	require.Equal(t, alicePublicKey.Bytes(),
+		ecdhDiffieHellman.DerivePublicKey(alice3PrivateKey).Bytes())
+
+	_, err = ecdhDiffieHellman.UnmarshalBinaryPrivateKey([]byte{1, 2, 3})
+	require.ErrorIs(t, err, ErrInvalidKeySize)
 }
 
-func TestPublicKeyMarshaling(t *testing.T) {
-	_, alicePublicKey := CTIDHDiffieHellman.NewKeypair()
+func TestNew_PublicKeyMarshaling(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	_, alicePublicKey := ecdhDiffieHellman.NewKeypair(rng)
 
 	alicePublicKeyBytes := alicePublicKey.Bytes()
-	_, alice2PublicKey := CTIDHDiffieHellman.NewKeypair()
+	_, alice2PublicKey := ecdhDiffieHellman.NewKeypair(rng)
 
 	err := alice2PublicKey.FromBytes(alicePublicKeyBytes)
 	require.NoError(t, err)
@@ -60,11 +115,17 @@ func TestPublicKeyMarshaling(t *testing.T) {
 
 	require.Equal(t, alice2PublicKeyBytes, alicePublicKeyBytes)
 
-	alice3PublicKey, err := CTIDHDiffieHellman.UnmarshalBinaryPublicKey(alice2PublicKeyBytes)
+	alice3PublicKey, err := ecdhDiffieHellman.UnmarshalBinaryPublicKey(
+		alice2PublicKeyBytes)
 	require.NoError(t, err)
 
 	alice3PublicKeyBytes := alice3PublicKey.Bytes()
 
 	require.Equal(t, alice3PublicKeyBytes, alice2PublicKeyBytes)
-	require.Equal(t, len(alice3PublicKeyBytes), CTIDHDiffieHellman.PublicKeySize())
+	require.Equal(t, len(alice3PublicKeyBytes),
+		ecdhDiffieHellman.PublicKeySize())
+	require.Equal(t, ecdhDiffieHellman, alice3PublicKey.Scheme())
+
+	_, err = ecdhDiffieHellman.UnmarshalBinaryPublicKey([]byte{1, 2, 3})
+	require.ErrorIs(t, err, ErrInvalidKeySize)
 }
@@ -0,0 +1,309 @@
+////////////////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                                       //
+//                                                                                        //
+// Use of this source code is governed by a license that can be found in the LICENSE file //
+////////////////////////////////////////////////////////////////////////////////////////////
+
+package hybrid
+
+import (
+	"encoding/pem"
+	"errors"
+	"io"
+	"runtime"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	jww "github.com/spf13/jwalterweatherman"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/curve25519"
+
+	"gitlab.com/elixxir/crypto/kem"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+)
+
+// X25519Kyber768 is a post-quantum hybrid key encapsulation mechanism
+// pairing the X25519 keys of ecdh.ECDHNIKE with Kyber768, the round 3
+// submission standardised as ML-KEM-768.
+//
+// The X25519 half is encapsulated by generating an ephemeral keypair and
+// sending its public key. Both halves are then combined with a hash over
+// the two shared secrets, the X25519 ciphertext and the recipient's X25519
+// public key, so the result stays secure as long as either scheme holds.
+var X25519Kyber768 kem.Scheme = &x25519Kyber768{}
+
+const (
+	x25519Kyber768Name = "X25519Kyber768"
+	sharedSecretSize   = blake2b.Size256
+)
+
+var (
+	// ErrInvalidKeySize is returned when key material of the wrong
+	// size is passed to FromBytes.
+	ErrInvalidKeySize = errors.New("invalid key size")
+
+	// ErrInvalidCiphertextSize is returned when a ciphertext of the
+	// wrong size is passed to Decapsulate.
+	ErrInvalidCiphertextSize = errors.New("invalid ciphertext size")
+)
+
+var _ kem.PrivateKey = (*x25519Kyber768PrivateKey)(nil)
+var _ kem.PublicKey = (*x25519Kyber768PublicKey)(nil)
+var _ kem.Scheme = (*x25519Kyber768)(nil)
+
+type x25519Kyber768 struct{}
+
+func (s *x25519Kyber768) Name() string { return x25519Kyber768Name }
+
+func (s *x25519Kyber768) PublicKeySize() int {
+	return ecdh.ECDHNIKE.PublicKeySize() + kyber768.PublicKeySize
+}
+
+func (s *x25519Kyber768) PrivateKeySize() int {
+	return ecdh.ECDHNIKE.PrivateKeySize() + kyber768.PrivateKeySize
+}
+
+func (s *x25519Kyber768) CiphertextSize() int {
+	return ecdh.ECDHNIKE.PublicKeySize() + kyber768.CiphertextSize
+}
+
+func (s *x25519Kyber768) SharedSecretSize() int {
+	return sharedSecretSize
+}
+
+func (s *x25519Kyber768) NewKeypair(rng io.Reader) (
+	kem.PrivateKey, kem.PublicKey) {
+	ecdhPrivKey, ecdhPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	kyberPubKey, kyberPrivKey, err := kyber768.GenerateKeyPair(rng)
+	if err != nil {
+		jww.FATAL.Panicf("rng failure: %+v", err)
+	}
+
+	return &x25519Kyber768PrivateKey{
+		ecdh:  ecdhPrivKey.(*ecdh.PrivateKey),
+		kyber: kyberPrivKey,
+	}, &x25519Kyber768PublicKey{
+		ecdh:  ecdhPubKey.(*ecdh.PublicKey),
+		kyber: kyberPubKey,
+	}
+}
+
+// Encapsulate generates a fresh shared secret for the given public key. The
+// returned ciphertext is formatted as such:
+// X25519 Ephemeral Public Key | Kyber768 Ciphertext
+func (s *x25519Kyber768) Encapsulate(publicKey kem.PublicKey,
+	rng io.Reader) (ciphertext, sharedSecret []byte, err error) {
+	pubKey, ok := publicKey.(*x25519Kyber768PublicKey)
+	if !ok {
+		return nil, nil, errors.New("public key must be X25519Kyber768")
+	}
+
+	ephemeralPrivKey, ephemeralPubKey := ecdh.ECDHNIKE.NewKeypair(rng)
+	ecdhSecret, err := x25519(ephemeralPrivKey.(*ecdh.PrivateKey),
+		pubKey.ecdh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seed := make([]byte, kyber768.EncapsulationSeedSize)
+	if _, err = io.ReadFull(rng, seed); err != nil {
+		return nil, nil, err
+	}
+	kyberCiphertext := make([]byte, kyber768.CiphertextSize)
+	kyberSecret := make([]byte, kyber768.SharedKeySize)
+	pubKey.kyber.EncapsulateTo(kyberCiphertext, kyberSecret, seed)
+
+	ciphertext = append(ephemeralPubKey.Bytes(), kyberCiphertext...)
+	sharedSecret = combineSecrets(ecdhSecret, kyberSecret,
+		ephemeralPubKey.Bytes(), pubKey.ecdh.Bytes())
+	return ciphertext, sharedSecret, nil
+}
+
+// Decapsulate recovers the shared secret from a ciphertext produced by
+// Encapsulate.
+func (s *x25519Kyber768) Decapsulate(privateKey kem.PrivateKey,
+	ciphertext []byte) (sharedSecret []byte, err error) {
+	privKey, ok := privateKey.(*x25519Kyber768PrivateKey)
+	if !ok {
+		return nil, errors.New("private key must be X25519Kyber768")
+	}
+	if len(ciphertext) != s.CiphertextSize() {
+		return nil, ErrInvalidCiphertextSize
+	}
+
+	ecdhSize := ecdh.ECDHNIKE.PublicKeySize()
+	ephemeralPubKey, err := ecdh.ECDHNIKE.UnmarshalBinaryPublicKey(
+		ciphertext[:ecdhSize])
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := x25519(privKey.ecdh,
+		ephemeralPubKey.(*ecdh.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	kyberSecret := make([]byte, kyber768.SharedKeySize)
+	privKey.kyber.DecapsulateTo(kyberSecret, ciphertext[ecdhSize:])
+
+	ecdhPubKey := ecdh.ECDHNIKE.DerivePublicKey(privKey.ecdh)
+	return combineSecrets(ecdhSecret, kyberSecret,
+		ciphertext[:ecdhSize], ecdhPubKey.Bytes()), nil
+}
+
+func (s *x25519Kyber768) UnmarshalBinaryPublicKey(b []byte) (
+	kem.PublicKey, error) {
+	pubKey := s.NewEmptyPublicKey()
+	err := pubKey.FromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return pubKey, nil
+}
+
+func (s *x25519Kyber768) UnmarshalBinaryPrivateKey(b []byte) (
+	kem.PrivateKey, error) {
+	privKey := s.NewEmptyPrivateKey()
+	err := privKey.FromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return privKey, nil
+}
+
+func (s *x25519Kyber768) NewEmptyPrivateKey() kem.PrivateKey {
+	return &x25519Kyber768PrivateKey{
+		ecdh:  ecdh.ECDHNIKE.NewEmptyPrivateKey().(*ecdh.PrivateKey),
+		kyber: new(kyber768.PrivateKey),
+	}
+}
+
+func (s *x25519Kyber768) NewEmptyPublicKey() kem.PublicKey {
+	return &x25519Kyber768PublicKey{
+		ecdh:  ecdh.ECDHNIKE.NewEmptyPublicKey().(*ecdh.PublicKey),
+		kyber: new(kyber768.PublicKey),
+	}
+}
+
+func (s *x25519Kyber768) DerivePublicKey(
+	privKey kem.PrivateKey) kem.PublicKey {
+	p := privKey.(*x25519Kyber768PrivateKey)
+	return &x25519Kyber768PublicKey{
+		ecdh:  ecdh.ECDHNIKE.DerivePublicKey(p.ecdh).(*ecdh.PublicKey),
+		kyber: p.kyber.Public().(*kyber768.PublicKey),
+	}
+}
+
+type x25519Kyber768PrivateKey struct {
+	ecdh  *ecdh.PrivateKey
+	kyber *kyber768.PrivateKey
+}
+
+func (p *x25519Kyber768PrivateKey) Scheme() kem.Scheme {
+	return X25519Kyber768
+}
+
+//go:noinline
+func (p *x25519Kyber768PrivateKey) Reset() {
+	p.ecdh.Reset()
+	// The Kyber768 key does not expose its internals, so the best we can
+	// do is clear the values held in place and drop the references.
+	*p.kyber = kyber768.PrivateKey{}
+	runtime.KeepAlive(p.kyber)
+}
+
+// Bytes serializes the private key. It is formatted as such:
+// X25519 Private Key | Kyber768 Private Key
+func (p *x25519Kyber768PrivateKey) Bytes() []byte {
+	res := make([]byte, X25519Kyber768.PrivateKeySize())
+	ecdhSize := ecdh.ECDHNIKE.PrivateKeySize()
+	copy(res, p.ecdh.Bytes())
+	p.kyber.Pack(res[ecdhSize:])
+	return res
+}
+
+func (p *x25519Kyber768PrivateKey) FromBytes(data []byte) error {
+	if len(data) != X25519Kyber768.PrivateKeySize() {
+		return ErrInvalidKeySize
+	}
+	ecdhSize := ecdh.ECDHNIKE.PrivateKeySize()
+	err := p.ecdh.FromBytes(data[:ecdhSize])
+	if err != nil {
+		return err
+	}
+	p.kyber.Unpack(data[ecdhSize:])
+	return nil
+}
+
+func (p *x25519Kyber768PrivateKey) ToPEMFile(f string) error {
+	return kem.PrivateKeyToPEMFile(p, f)
+}
+
+func (p *x25519Kyber768PrivateKey) ToPEM() (*pem.Block, error) {
+	return kem.PrivateKeyToPEM(p)
+}
+
+type x25519Kyber768PublicKey struct {
+	ecdh  *ecdh.PublicKey
+	kyber *kyber768.PublicKey
+}
+
+func (p *x25519Kyber768PublicKey) Scheme() kem.Scheme {
+	return X25519Kyber768
+}
+
+func (p *x25519Kyber768PublicKey) Reset() {
+	p.ecdh.Reset()
+	p.kyber = new(kyber768.PublicKey)
+}
+
+// Bytes serializes the public key. It is formatted as such:
+// X25519 Public Key | Kyber768 Public Key
+func (p *x25519Kyber768PublicKey) Bytes() []byte {
+	res := make([]byte, X25519Kyber768.PublicKeySize())
+	ecdhSize := ecdh.ECDHNIKE.PublicKeySize()
+	copy(res, p.ecdh.Bytes())
+	p.kyber.Pack(res[ecdhSize:])
+	return res
+}
+
+func (p *x25519Kyber768PublicKey) FromBytes(data []byte) error {
+	if len(data) != X25519Kyber768.PublicKeySize() {
+		return ErrInvalidKeySize
+	}
+	ecdhSize := ecdh.ECDHNIKE.PublicKeySize()
+	err := p.ecdh.FromBytes(data[:ecdhSize])
+	if err != nil {
+		return err
+	}
+	p.kyber.Unpack(data[ecdhSize:])
+	return nil
+}
+
+func (p *x25519Kyber768PublicKey) ToPEMFile(f string) error {
+	return kem.PublicKeyToPEMFile(p, f)
+}
+
+func (p *x25519Kyber768PublicKey) ToPEM() (*pem.Block, error) {
+	return kem.PublicKeyToPEM(p)
+}
+
+// x25519 derives the X25519 secret between the keys. Unlike
+// ecdh.PrivateKey.DeriveSecret it returns an error rather than panicking on
+// low order points, which an attacker controls when decapsulating.
+func x25519(privKey *ecdh.PrivateKey, pubKey *ecdh.PublicKey) ([]byte, error) {
+	return curve25519.X25519(privKey.MontgomeryBytes(),
+		pubKey.MontgomeryBytes())
+}
+
+// combineSecrets hashes both shared secrets together with the X25519
+// ciphertext and recipient public key, binding the result to the exchange.
+func combineSecrets(ecdhSecret, kyberSecret, ecdhCiphertext,
+	ecdhPubKey []byte) []byte {
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte(x25519Kyber768Name))
+	h.Write(kyberSecret)
+	h.Write(ecdhSecret)
+	h.Write(ecdhCiphertext)
+	h.Write(ecdhPubKey)
+	return h.Sum(nil)
+}
@@ -0,0 +1,118 @@
+////////////////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                                       //
+//                                                                                        //
+// Use of this source code is governed by a license that can be found in the LICENSE file //
+////////////////////////////////////////////////////////////////////////////////////////////
+
+package hybrid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/crypto/csprng"
+)
+
+func TestX25519Kyber768_EncapsulateDecapsulate(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	bobPrivateKey, bobPublicKey := X25519Kyber768.NewKeypair(rng)
+
+	ciphertext, secret1, err := X25519Kyber768.Encapsulate(bobPublicKey, rng)
+	require.NoError(t, err)
+	require.Len(t, ciphertext, X25519Kyber768.CiphertextSize())
+	require.Len(t, secret1, X25519Kyber768.SharedSecretSize())
+
+	secret2, err := X25519Kyber768.Decapsulate(bobPrivateKey, ciphertext)
+	require.NoError(t, err)
+
+	require.Equal(t, secret1, secret2)
+}
+
+// Tests that tampering with either half of the ciphertext changes the
+// decapsulated secret.
+func TestX25519Kyber768_Decapsulate_Tampered(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	bobPrivateKey, bobPublicKey := X25519Kyber768.NewKeypair(rng)
+
+	ciphertext, secret, err := X25519Kyber768.Encapsulate(bobPublicKey, rng)
+	require.NoError(t, err)
+
+	kyberTampered := make([]byte, len(ciphertext))
+	copy(kyberTampered, ciphertext)
+	kyberTampered[len(kyberTampered)-1] ^= 0xFF
+	secret2, err := X25519Kyber768.Decapsulate(bobPrivateKey, kyberTampered)
+	require.NoError(t, err)
+	require.NotEqual(t, secret, secret2)
+
+	_, ecdhPublicKey := X25519Kyber768.NewKeypair(rng)
+	ecdhTampered := make([]byte, len(ciphertext))
+	copy(ecdhTampered, ciphertext)
+	copy(ecdhTampered, ecdhPublicKey.Bytes()[:32])
+	secret3, err := X25519Kyber768.Decapsulate(bobPrivateKey, ecdhTampered)
+	require.NoError(t, err)
+	require.NotEqual(t, secret, secret3)
+}
+
+func TestX25519Kyber768_Decapsulate_BadCiphertext(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	bobPrivateKey, _ := X25519Kyber768.NewKeypair(rng)
+
+	_, err := X25519Kyber768.Decapsulate(bobPrivateKey, []byte{1, 2, 3})
+	require.ErrorIs(t, err, ErrInvalidCiphertextSize)
+}
+
+func TestX25519Kyber768_PrivateKeyMarshaling(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivateKey, _ := X25519Kyber768.NewKeypair(rng)
+
+	alicePrivateKeyBytes := alicePrivateKey.Bytes()
+	alice2PrivateKey, _ := X25519Kyber768.NewKeypair(rng)
+
+	err := alice2PrivateKey.FromBytes(alicePrivateKeyBytes)
+	require.NoError(t, err)
+
+	alice2PrivateKeyBytes := alice2PrivateKey.Bytes()
+
+	require.Equal(t, alice2PrivateKeyBytes, alicePrivateKeyBytes)
+
+	alice3PrivateKey, err := X25519Kyber768.UnmarshalBinaryPrivateKey(
+		alice2PrivateKeyBytes)
+	require.NoError(t, err)
+
+	alice3PrivateKeyBytes := alice3PrivateKey.Bytes()
+
+	require.Equal(t, alice3PrivateKeyBytes, alice2PrivateKeyBytes)
+	require.Equal(t, len(alice3PrivateKeyBytes),
+		X25519Kyber768.PrivateKeySize())
+
+	_, err = X25519Kyber768.UnmarshalBinaryPrivateKey([]byte{1, 2, 3})
+	require.ErrorIs(t, err, ErrInvalidKeySize)
+}
+
+func TestX25519Kyber768_PublicKeyMarshaling(t *testing.T) {
+	rng := csprng.NewSystemRNG()
+	alicePrivateKey, alicePublicKey := X25519Kyber768.NewKeypair(rng)
+
+	alicePublicKeyBytes := alicePublicKey.Bytes()
+	_, alice2PublicKey := X25519Kyber768.NewKeypair(rng)
+
+	err := alice2PublicKey.FromBytes(alicePublicKeyBytes)
+	require.NoError(t, err)
+
+	alice2PublicKeyBytes := alice2PublicKey.Bytes()
+
+	require.Equal(t, alice2PublicKeyBytes, alicePublicKeyBytes)
+
+	alice3PublicKey, err := X25519Kyber768.UnmarshalBinaryPublicKey(
+		alice2PublicKeyBytes)
+	require.NoError(t, err)
+
+	alice3PublicKeyBytes := alice3PublicKey.Bytes()
+
+	require.Equal(t, alice3PublicKeyBytes, alice2PublicKeyBytes)
+	require.Equal(t, len(alice3PublicKeyBytes),
+		X25519Kyber768.PublicKeySize())
+
+	derivedPublicKey := X25519Kyber768.DerivePublicKey(alicePrivateKey)
+	require.Equal(t, alicePublicKeyBytes, derivedPublicKey.Bytes())
+}
@@ -0,0 +1,209 @@
+package notifications
+
+// Registering an identity with SignIdentity hands the notifications server the
+// identity itself, so the server learns every identity a client tracks. The
+// functions here instead register an oblivious pseudorandom function (OPRF)
+// token of each sih.Preimage. The notifications server sees only tokens and
+// learns that a message is for a tracked identity when the message's SIH
+// matches a token.
+//
+// The OPRF is 2HashDH over the prime order subgroup of a safe prime
+// cyclic.Group. An OPRF server holds an OPRFKey k. A token is
+//
+//	H(preimage, H'(preimage)^k)
+//
+// where H' hashes into the subgroup. To get the token of a preimage, the client
+// blinds H'(preimage) with a random exponent r using BlindPreimage and sends
+// H'(preimage)^r to the OPRF server. The OPRF server raises it to k with
+// OPRFKey.Evaluate and the client removes r with BlindedPreimage.Unblind. The
+// OPRF server never sees the preimage or H'(preimage), and each blinding of the
+// same preimage looks unrelated to the last.
+//
+// The client registers its tokens with the notifications server, signed with
+// SignIdentity using RegisterTrackedTokenTag. A sender gets the token of the
+// recipient's preimage the same way and makes the message's SIH with
+// sih.HashFromMessageHash using the token as the preimage. The notifications
+// server checks each message against its registered tokens with
+// sih.ForMeFromMessageHash.
+//
+// The OPRF server and the notifications server must be run by separate parties
+// that do not collude. Whoever holds k can compute the token of any preimage it
+// knows, so a notifications server holding k could link the registered tokens
+// to the identities it observes. This is not a private set intersection, and it
+// does not hide tokens from a notifications server that can evaluate the OPRF:
+//   - Tokens are only as private as k. If the two servers share it, the
+//     notifications server learns every tracked identity it can guess.
+//   - The OPRF server evaluates blinded preimages for anyone who asks, so the
+//     notifications server can query it like any client and learn the token of
+//     a preimage it knows. The OPRF server should only evaluate for
+//     authenticated clients and limit how many preimages each one evaluates,
+//     which bounds, but does not prevent, such guessing.
+//   - The notifications server still learns which registered token each
+//     matching message is for, and so which messages share a recipient.
+
+import (
+	"crypto"
+	"io"
+
+	"github.com/pkg/errors"
+	"gitlab.com/xx_network/crypto/large"
+
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/elixxir/crypto/diffieHellman"
+	"gitlab.com/elixxir/crypto/hash"
+	"gitlab.com/elixxir/crypto/sih"
+)
+
+const (
+	oprfHashToGroupVector = "NotificationsOPRFHashToGroup"
+	oprfTokenVector       = "NotificationsOPRFToken"
+)
+
+var ErrInvalidOPRFElement = errors.New(
+	"OPRF element is not in the prime order subgroup")
+
+// OPRFKey is the key of the OPRF server. It must not be given to the
+// notifications server, which could then compute the token of any preimage.
+type OPRFKey struct {
+	grp *cyclic.Group
+	k   *cyclic.Int
+}
+
+// NewOPRFKey generates a new OPRF key in the group, which must have a safe
+// prime.
+func NewOPRFKey(grp *cyclic.Group, rng io.Reader) *OPRFKey {
+	return &OPRFKey{
+		grp: grp,
+		k: diffieHellman.GeneratePrivateKey(
+			diffieHellman.DefaultPrivateKeyLength, grp, rng),
+	}
+}
+
+// NewOPRFKeyFromBytes loads an OPRF key in the group from the bytes returned
+// by OPRFKey.Bytes. Returns an error if the key is 0 or 1 modulo the subgroup
+// order, since every token would then be the same or be the hash of the
+// preimage.
+func NewOPRFKeyFromBytes(grp *cyclic.Group, b []byte) (*OPRFKey, error) {
+	k := large.NewIntFromBytes(b)
+	if !grp.Inside(k) {
+		return nil, errors.New("OPRF key is not in the group")
+	}
+
+	kModQ := large.NewInt(0).Mod(k, grp.GetPSub1Factor())
+	if kModQ.Cmp(large.NewInt(1)) <= 0 {
+		return nil, errors.New(
+			"OPRF key must not be 0 or 1 modulo the subgroup order")
+	}
+	return &OPRFKey{grp: grp, k: grp.NewIntFromLargeInt(k)}, nil
+}
+
+// Bytes returns the key so that it can be stored and reloaded with
+// NewOPRFKeyFromBytes.
+func (key *OPRFKey) Bytes() []byte {
+	return key.k.Bytes()
+}
+
+// Evaluate is the OPRF server's side of the OPRF. It raises a blinded preimage
+// received from a client to the key. Returns ErrInvalidOPRFElement if the
+// blinded preimage is not in the subgroup, which keeps a client from learning
+// anything about the key from the result.
+func (key *OPRFKey) Evaluate(blinded []byte) ([]byte, error) {
+	b, err := decodeOPRFElement(key.grp, blinded)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluated := key.grp.NewInt(1)
+	key.grp.Exp(b, key.k, evaluated)
+	return encodeOPRFElement(key.grp, evaluated), nil
+}
+
+// BlindedPreimage is a sih.Preimage blinded for evaluation by the OPRF server.
+// It holds the blind, so it must be kept by the client and not sent.
+type BlindedPreimage struct {
+	grp      *cyclic.Group
+	preimage sih.Preimage
+	blind    *cyclic.Int
+	blinded  *cyclic.Int
+}
+
+// BlindPreimage blinds the preimage with a random exponent. The result of
+// BlindedPreimage.Bytes is sent to the OPRF server for evaluation.
+func BlindPreimage(grp *cyclic.Group, preimage sih.Preimage,
+	rng io.Reader) *BlindedPreimage {
+	// The blind is non-zero and smaller than the order of the subgroup, so it
+	// is invertible
+	blind := diffieHellman.GeneratePrivateKey(
+		diffieHellman.DefaultPrivateKeyLength, grp, rng)
+
+	blinded := grp.NewInt(1)
+	grp.Exp(hashToOPRFGroup(grp, preimage), blind, blinded)
+
+	return &BlindedPreimage{
+		grp:      grp,
+		preimage: preimage,
+		blind:    blind,
+		blinded:  blinded,
+	}
+}
+
+// Bytes returns the blinded preimage to send to the OPRF server.
+func (bp *BlindedPreimage) Bytes() []byte {
+	return encodeOPRFElement(bp.grp, bp.blinded)
+}
+
+// Unblind removes the blind from the OPRF server's evaluation of the blinded
+// preimage and returns the token of the preimage. The token is used in place
+// of the preimage when making and matching SIHs. Returns
+// ErrInvalidOPRFElement if the evaluation is not in the subgroup.
+func (bp *BlindedPreimage) Unblind(evaluated []byte) (sih.Preimage, error) {
+	e, err := decodeOPRFElement(bp.grp, evaluated)
+	if err != nil {
+		return sih.Preimage{}, err
+	}
+
+	// The subgroup has order (p-1)/2, so the blind is removed by raising to
+	// its inverse modulo (p-1)/2
+	inverse := large.NewInt(1).ModInverse(
+		bp.blind.GetLargeInt(), bp.grp.GetPSub1Factor())
+	unblinded := bp.grp.NewInt(1)
+	bp.grp.Exp(e, bp.grp.NewIntFromLargeInt(inverse), unblinded)
+
+	h := crypto.BLAKE2b_256.New()
+	h.Write([]byte(oprfTokenVector))
+	h.Write(bp.preimage[:])
+	h.Write(encodeOPRFElement(bp.grp, unblinded))
+
+	var token sih.Preimage
+	copy(token[:], h.Sum(nil))
+	return token, nil
+}
+
+// hashToOPRFGroup hashes the preimage to an element of the prime order
+// subgroup. Squaring a value in a safe prime group gives a quadratic residue,
+// which is in the subgroup, without revealing its discrete log.
+func hashToOPRFGroup(grp *cyclic.Group, preimage sih.Preimage) *cyclic.Int {
+	data := append([]byte(oprfHashToGroupVector), preimage[:]...)
+	x := hash.ExpandKey(crypto.BLAKE2b_256.New, grp, data, grp.NewInt(1))
+	return grp.Mul(x, x, x)
+}
+
+// encodeOPRFElement returns the element padded to the length of the prime.
+func encodeOPRFElement(grp *cyclic.Group, x *cyclic.Int) []byte {
+	return x.LeftpadBytes(uint64(len(grp.GetPBytes())))
+}
+
+// decodeOPRFElement decodes an element encoded by encodeOPRFElement and
+// checks that it is in the subgroup.
+func decodeOPRFElement(grp *cyclic.Group, b []byte) (*cyclic.Int, error) {
+	v := large.NewIntFromBytes(b)
+	if len(b) != len(grp.GetPBytes()) || !grp.Inside(v) {
+		return nil, errors.WithStack(ErrInvalidOPRFElement)
+	}
+
+	x := grp.NewIntFromLargeInt(v)
+	if !diffieHellman.CheckPublicKey(grp, x) {
+		return nil, errors.WithStack(ErrInvalidOPRFElement)
+	}
+	return x, nil
+}
@@ -0,0 +1,171 @@
+package notifications
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/large"
+
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/elixxir/crypto/diffieHellman"
+	"gitlab.com/elixxir/crypto/sih"
+)
+
+// newOPRFTestGroup returns the 2048-bit MODP group from RFC 3526, which has a
+// safe prime.
+func newOPRFTestGroup() *cyclic.Group {
+	primeString := "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+		"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+		"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+		"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+		"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+		"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+		"15728E5A8AACAA68FFFFFFFFFFFFFFFF"
+	p := large.NewInt(1)
+	p.SetString(primeString, 16)
+	return cyclic.NewGroup(p, large.NewInt(2))
+}
+
+// getToken runs the OPRF between a client and the server.
+func getToken(grp *cyclic.Group, key *OPRFKey, preimage sih.Preimage,
+	t *testing.T) sih.Preimage {
+	bp := BlindPreimage(grp, preimage, csprng.NewSystemRNG())
+	evaluated, err := key.Evaluate(bp.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to evaluate: %+v", err)
+	}
+	token, err := bp.Unblind(evaluated)
+	if err != nil {
+		t.Fatalf("Failed to unblind: %+v", err)
+	}
+	return token
+}
+
+// Tests that a recipient and a sender that separately get the token of a
+// preimage get the same token, that the server matches the sender's SIH with
+// the recipient's registered token, and that the server does not see the same
+// blinded value twice.
+func TestBlindPreimage_Unblind(t *testing.T) {
+	grp := newOPRFTestGroup()
+	rng := csprng.NewSystemRNG()
+	key := NewOPRFKey(grp, rng)
+	preimage := sih.MakePreimage([]byte("identifier"), "tag")
+
+	registered := getToken(grp, key, preimage, t)
+	senderToken := getToken(grp, key, preimage, t)
+	if registered != senderToken {
+		t.Errorf("Tokens of the same preimage differ.\nrecipient: %v"+
+			"\nsender:    %v", registered, senderToken)
+	}
+	if registered == preimage {
+		t.Errorf("Token is the preimage.")
+	}
+
+	bp1 := BlindPreimage(grp, preimage, rng)
+	bp2 := BlindPreimage(grp, preimage, rng)
+	if bytes.Equal(bp1.Bytes(), bp2.Bytes()) {
+		t.Errorf("Two blindings of the same preimage are the same.")
+	}
+	if !diffieHellman.CheckPublicKey(grp, grp.NewIntFromBytes(bp1.Bytes())) {
+		t.Errorf("Blinded preimage is not in the subgroup.")
+	}
+
+	msgHash := sih.GetMessageHash([]byte("message contents"))
+	messageSIH := sih.HashFromMessageHash(senderToken, msgHash)
+	if !sih.ForMeFromMessageHash(registered, msgHash, messageSIH) {
+		t.Errorf("Server did not match SIH to registered token.")
+	}
+
+	other := getToken(grp, key, sih.MakePreimage([]byte("other"), "tag"), t)
+	if sih.ForMeFromMessageHash(other, msgHash, messageSIH) {
+		t.Errorf("Server matched SIH to the wrong token.")
+	}
+}
+
+// Tests that different server keys give different tokens and that a key
+// reloaded with NewOPRFKeyFromBytes gives the same tokens.
+func TestOPRFKey_Bytes_NewOPRFKeyFromBytes(t *testing.T) {
+	grp := newOPRFTestGroup()
+	key := NewOPRFKey(grp, csprng.NewSystemRNG())
+	preimage := sih.MakePreimage([]byte("identifier"), sih.Default)
+
+	loaded, err := NewOPRFKeyFromBytes(grp, key.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to load key: %+v", err)
+	}
+	if getToken(grp, key, preimage, t) != getToken(grp, loaded, preimage, t) {
+		t.Errorf("Reloaded key gives a different token.")
+	}
+
+	otherKey := NewOPRFKey(grp, csprng.NewSystemRNG())
+	if getToken(grp, key, preimage, t) == getToken(grp, otherKey, preimage, t) {
+		t.Errorf("Different keys give the same token.")
+	}
+
+	if _, err = NewOPRFKeyFromBytes(grp, grp.GetPBytes()); err == nil {
+		t.Errorf("Failed to get error for key outside the group.")
+	}
+}
+
+// Error path: tests that NewOPRFKeyFromBytes rejects keys that are 0 or 1
+// modulo the subgroup order, which would make every token the same or the hash
+// of the preimage.
+func TestNewOPRFKeyFromBytes_WeakKey(t *testing.T) {
+	grp := newOPRFTestGroup()
+	q := grp.GetPSub1Factor()
+
+	for name, k := range map[string]*large.Int{
+		"1":    large.NewInt(1),
+		"q":    large.NewInt(0).Set(q),
+		"q+1":  large.NewInt(0).Add(q, large.NewInt(1)),
+		"2q":   large.NewInt(0).Mul(q, large.NewInt(2)),
+		"zero": large.NewInt(0),
+	} {
+		if _, err := NewOPRFKeyFromBytes(grp, k.Bytes()); err == nil {
+			t.Errorf("Failed to get error for key %s.", name)
+		}
+	}
+
+	if _, err := NewOPRFKeyFromBytes(grp, large.NewInt(2).Bytes()); err != nil {
+		t.Errorf("Failed to load key 2: %+v", err)
+	}
+}
+
+// Error path: tests that OPRFKey.Evaluate and BlindedPreimage.Unblind reject
+// elements outside the subgroup.
+func TestOPRFKey_Evaluate_InvalidElement(t *testing.T) {
+	grp := newOPRFTestGroup()
+	key := NewOPRFKey(grp, csprng.NewSystemRNG())
+	size := uint64(len(grp.GetPBytes()))
+
+	// Find a quadratic non-residue, which is outside the subgroup
+	nonResidue := grp.NewInt(2)
+	for i := int64(3); diffieHellman.CheckPublicKey(grp, nonResidue); i++ {
+		nonResidue = grp.NewInt(i)
+	}
+
+	tests := map[string][]byte{
+		"empty":       {},
+		"short":       grp.NewInt(4).Bytes(),
+		"zero":        make([]byte, size),
+		"one":         grp.NewInt(1).LeftpadBytes(size),
+		"p-1":         grp.GetPSub1().LeftpadBytes(size),
+		"p":           grp.GetPBytes(),
+		"non-residue": nonResidue.LeftpadBytes(size),
+	}
+
+	bp := BlindPreimage(grp, sih.Preimage{}, csprng.NewSystemRNG())
+	for name, element := range tests {
+		if _, err := key.Evaluate(element); err == nil {
+			t.Errorf("Failed to get error evaluating %s element.", name)
+		}
+		if _, err := bp.Unblind(element); err == nil {
+			t.Errorf("Failed to get error unblinding %s element.", name)
+		}
+	}
+}
@@ -11,6 +11,8 @@ const (
 	UnregisterTokenTag
 	RegisterTrackedIDTag
 	UnregisterTrackedIDTag
+	RegisterTrackedTokenTag
+	UnregisterTrackedTokenTag
 )
 
 func (nt NotificationTag) String() string {
@@ -23,6 +25,10 @@ func (nt NotificationTag) String() string {
 		return "RegisterTrackedIDTag"
 	case UnregisterTrackedIDTag:
 		return "UnregisterTrackedIDTag"
+	case RegisterTrackedTokenTag:
+		return "RegisterTrackedTokenTag"
+	case UnregisterTrackedTokenTag:
+		return "UnregisterTrackedTokenTag"
 	default:
 		return "UnknownTag: " + strconv.Itoa(int(nt))
 	}
@@ -14,6 +14,8 @@ func TestNotificationTag_String(t *testing.T) {
 	expected[UnregisterTokenTag] = "UnregisterTokenTag"
 	expected[RegisterTrackedIDTag] = "RegisterTrackedIDTag"
 	expected[UnregisterTrackedIDTag] = "UnregisterTrackedIDTag"
+	expected[RegisterTrackedTokenTag] = "RegisterTrackedTokenTag"
+	expected[UnregisterTrackedTokenTag] = "UnregisterTrackedTokenTag"
 
 	for i := 0; i < 256; i++ {
 		nt := NotificationTag(i)
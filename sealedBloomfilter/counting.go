@@ -0,0 +1,361 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+var ErrInvalidParameters = errors.Errorf("size and hash functions must be " +
+	"greater than 0")
+var ErrInvalidElements = errors.Errorf("elements must be greater than 0 and " +
+	"false positive rate must be between 0 and 1")
+var ErrNotInFilter = errors.Errorf("data is not in the filter")
+var ErrIncompatibleFilters = errors.Errorf("filters must have the same size " +
+	"and number of hash functions to merge")
+
+// counterMax is the largest value of a 4-bit counter. A counter that reaches
+// it is saturated: it is never incremented or decremented again, so removing
+// an element can never clear a counter shared with an element still in the
+// filter.
+const counterMax = 0xF
+
+type SealedCounting interface {
+	// Seal encrypts the filter in order to hide its contents. It returns the
+	// encrypted counters with the appended metadata inside the encrypted
+	// payload. The payload is always SealedSize bytes, no matter how many
+	// elements have been added.
+	// Note: the length of the metadata must be the same as
+	// the passed size on initialization otherwise an error will
+	// be returned
+	Seal(metadata []byte) ([]byte, error)
+
+	// Unseal decrypts the sealed filter and stores it in the filter, returning
+	// the appended metadata.
+	// Will error if the passed in ciphertext is not the correct length. The
+	// size can be retrieved using SealedSize()
+	Unseal(ciphertext []byte) ([]byte, error)
+
+	// SetNonce replaces the nonce used by Seal and Unseal. A filter that is
+	// sealed more than once, such as a list that is updated and stored again,
+	// must be given a new nonce before every Seal.
+	SetNonce(nonce []byte) error
+
+	// Add adds the data to the filter.
+	Add(data []byte)
+
+	// Remove removes data that was added to the filter. It returns
+	// ErrNotInFilter, and leaves the filter unchanged, if the data is not in
+	// the filter. Removing data that was never added but tests as present
+	// removes another element.
+	Remove(data []byte) error
+
+	// Test returns a bool if the data is in the filter. True
+	// indicates that the data may be in the filter, while false
+	// indicates that the data is not in the filter.
+	Test(data []byte) bool
+
+	// EstimatedCount returns the estimated number of elements in the filter.
+	EstimatedCount() uint64
+
+	// Returns the number of counters in the filter.
+	GetSize() uint64
+
+	// Returns the number the hash operations
+	GetHashOpCount() uint64
+
+	// Reset clears all counters in the filter.
+	Reset()
+
+	// Merge adds every element of the sent filter to this one. The filters
+	// must have the same size and number of hash operations.
+	Merge(m SealedCounting) error
+
+	// SealedSize returns the size in bytes of a sealed payload this
+	// filter is expecting/ will return
+	SealedSize() int
+}
+
+// sealedCounting is a counting bloom filter. Each position holds a 4-bit
+// counter instead of a bit, so an element can be removed by decrementing the
+// counters it incremented.
+type sealedCounting struct {
+	key   []byte
+	nonce []byte
+
+	// size of the optionally appendable metadata
+	metadataSize uint
+
+	// counters holds two 4-bit counters per byte, the even counter in the low
+	// nibble
+	counters      []byte
+	size          uint64
+	hashFunctions uint64
+}
+
+// InitCounting initializes and returns a new sealed counting bloom filter
+// sized to hold the given number of elements within the false positive rate.
+// The number of counters is rounded up to a prime so that the locations of
+// every element are spread over distinct counters.
+// metadataSize is the size of optional data appended to the filter
+// which is inside the seal and will be returned on unsealing.
+// It must be known a-priori by both sides
+//
+// WARNING: the (key, nonce) must never been repeated between seals, otherwise
+// the seal can be trivially decrypted.
+func InitCounting(key, nonce []byte, elements int,
+	falsePositive float64, metadataSize uint) (SealedCounting, error) {
+	if elements <= 0 || !(falsePositive > 0 && falsePositive < 1) {
+		return nil, errors.WithStack(ErrInvalidElements)
+	}
+
+	n := float64(elements)
+	size := math.Ceil(-n * math.Log(falsePositive) / (math.Ln2 * math.Ln2))
+	hashFunctions := math.Ceil(math.Ln2 * size / n)
+	return InitCountingByParameters(key, nonce, nextPrime(uint64(size)),
+		uint64(hashFunctions), metadataSize)
+}
+
+// InitCountingByParameters initializes a sealed counting bloom filter allowing
+// the user to explicitly set the number of counters and the amount of hash
+// functions. A prime number of counters, or else a power of two, gives every
+// element distinct locations; other sizes may repeat locations.
+// metadataSize is the size of optional data appended to the filter
+// which is inside the seal and will be returned on unsealing.
+// It must be known a-priori by both sides
+//
+// WARNING: the (key, nonce) must never been repeated between seals, otherwise
+// the seal can be trivially decrypted.
+func InitCountingByParameters(key, nonce []byte, size,
+	hashFunctions uint64, metadataSize uint) (SealedCounting, error) {
+	if len(nonce) != chacha20.NonceSizeX {
+		return nil, errors.WithStack(ErrNonceSize)
+	}
+	if len(key) != chacha20.KeySize {
+		return nil, errors.WithStack(ErrKeySize)
+	}
+	if size == 0 || hashFunctions == 0 {
+		return nil, errors.WithStack(ErrInvalidParameters)
+	}
+
+	return &sealedCounting{
+		key:           key,
+		nonce:         nonce,
+		metadataSize:  metadataSize,
+		counters:      make([]byte, (size+1)/2),
+		size:          size,
+		hashFunctions: hashFunctions,
+	}, nil
+}
+
+// Seal encrypts the filter in order to hide its contents. It returns the
+// encrypted counters with the appended metadata inside the encrypted
+// payload. The payload is always SealedSize bytes, no matter how many
+// elements have been added.
+// Note: the length of the metadata must be the same as
+// the passed size on initialization otherwise an error will
+// be returned
+func (s *sealedCounting) Seal(metadata []byte) ([]byte, error) {
+	// check the metadata
+	if (s.metadataSize == 0 && metadata != nil) ||
+		uint(len(metadata)) != s.metadataSize {
+		return nil, errors.WithStack(ErrInvalidMetadataLen)
+	}
+
+	data := make([]byte, 0, s.SealedSize())
+	data = append(append(data, s.counters...), metadata...)
+
+	// seal the filter by encrypting it
+	cipher, err := chacha20.NewUnauthenticatedCipher(s.key, s.nonce)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	cipher.XORKeyStream(data, data)
+	return data, nil
+}
+
+// Unseal decrypts the sealed filter and stores it in the filter, returning
+// the appended metadata.
+// Will error if the passed in ciphertext is not the correct length. The
+// size can be retrieved using SealedSize()
+func (s *sealedCounting) Unseal(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) != s.SealedSize() {
+		return nil, errors.WithStack(ErrInvalidSealedLen)
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher, err := chacha20.NewUnauthenticatedCipher(s.key, s.nonce)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	cipher.XORKeyStream(plaintext, ciphertext)
+
+	copy(s.counters, plaintext)
+
+	// Clear the unused counter of an odd sized filter so that it does not
+	// count towards the estimate
+	if s.size%2 == 1 {
+		s.counters[len(s.counters)-1] &= 0x0F
+	}
+	return plaintext[len(s.counters):], nil
+}
+
+func (s *sealedCounting) SetNonce(nonce []byte) error {
+	if len(nonce) != chacha20.NonceSizeX {
+		return errors.WithStack(ErrNonceSize)
+	}
+	s.nonce = nonce
+	return nil
+}
+
+func (s *sealedCounting) Add(data []byte) {
+	for _, i := range s.locations(data) {
+		if c := s.counter(i); c < counterMax {
+			s.setCounter(i, c+1)
+		}
+	}
+}
+
+func (s *sealedCounting) Remove(data []byte) error {
+	locations := s.locations(data)
+	for _, i := range locations {
+		if s.counter(i) == 0 {
+			return errors.WithStack(ErrNotInFilter)
+		}
+	}
+
+	// A location may repeat, so a counter is never decremented past zero
+	for _, i := range locations {
+		if c := s.counter(i); c > 0 && c < counterMax {
+			s.setCounter(i, c-1)
+		}
+	}
+	return nil
+}
+
+func (s *sealedCounting) Test(data []byte) bool {
+	for _, i := range s.locations(data) {
+		if s.counter(i) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// EstimatedCount returns the estimated number of elements in the filter.
+// Every element adds one to each of its counters, so the count is the sum of
+// the counters over the number of hash operations. Once a counter saturates,
+// it is instead estimated from the number of non-zero counters.
+func (s *sealedCounting) EstimatedCount() uint64 {
+	var sum, nonZero uint64
+	saturated := false
+	for i := uint64(0); i < s.size; i++ {
+		c := s.counter(i)
+		sum += uint64(c)
+		if c > 0 {
+			nonZero++
+		}
+		saturated = saturated || c == counterMax
+	}
+
+	if !saturated {
+		return sum / s.hashFunctions
+	}
+
+	// Swamidass and Baldi estimate: -(m / k) * ln(1 - X / m), where m is the
+	// number of counters, k is the number of hash operations, and X is the
+	// number of non-zero counters
+	m, k := float64(s.size), float64(s.hashFunctions)
+	if nonZero == s.size {
+		return uint64(math.Ceil(m * math.Log(m) / k))
+	}
+	return uint64(math.Round(-m / k * math.Log(1-float64(nonZero)/m)))
+}
+
+func (s *sealedCounting) GetSize() uint64 {
+	return s.size
+}
+
+func (s *sealedCounting) GetHashOpCount() uint64 {
+	return s.hashFunctions
+}
+
+func (s *sealedCounting) Reset() {
+	for i := range s.counters {
+		s.counters[i] = 0
+	}
+}
+
+func (s *sealedCounting) Merge(m SealedCounting) error {
+	other, ok := m.(*sealedCounting)
+	if !ok || other.size != s.size ||
+		other.hashFunctions != s.hashFunctions {
+		return errors.WithStack(ErrIncompatibleFilters)
+	}
+
+	for i := uint64(0); i < s.size; i++ {
+		c := uint64(s.counter(i)) + uint64(other.counter(i))
+		if c > counterMax || s.counter(i) == counterMax ||
+			other.counter(i) == counterMax {
+			c = counterMax
+		}
+		s.setCounter(i, byte(c))
+	}
+	return nil
+}
+
+func (s *sealedCounting) SealedSize() int {
+	return int(s.metadataSize) + len(s.counters)
+}
+
+// locations returns the counters of the data, using double hashing of a
+// single blake2b hash to derive every location.
+//
+// The step h2 is made odd and nonzero modulo the size, as in Kirsch and
+// Mitzenmacher, so that it is coprime to a prime or power of two size and the
+// locations do not collapse onto a few counters.
+func (s *sealedCounting) locations(data []byte) []uint64 {
+	h := blake2b.Sum256(data)
+	h1 := binary.LittleEndian.Uint64(h[:8])
+	h2 := (binary.LittleEndian.Uint64(h[8:16]) | 1) % s.size
+	if h2 == 0 {
+		h2 = 1
+	}
+
+	locations := make([]uint64, s.hashFunctions)
+	for i := range locations {
+		locations[i] = (h1 + uint64(i)*h2) % s.size
+	}
+	return locations
+}
+
+// nextPrime returns the smallest prime greater than or equal to n.
+func nextPrime(n uint64) uint64 {
+	if n <= 2 {
+		return 2
+	}
+	p := new(big.Int).SetUint64(n | 1)
+	for !p.ProbablyPrime(0) {
+		p.Add(p, big.NewInt(2))
+	}
+	return p.Uint64()
+}
+
+func (s *sealedCounting) counter(i uint64) byte {
+	return (s.counters[i/2] >> (4 * (i % 2))) & 0x0F
+}
+
+func (s *sealedCounting) setCounter(i uint64, c byte) {
+	shift := 4 * (i % 2)
+	s.counters[i/2] = s.counters[i/2]&^(0x0F<<shift) | c<<shift
+}
@@ -0,0 +1,222 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package bloomfilter
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+// TestSealedCountingFuncs creates, adds, removes, checks, encrypts, unseals,
+// and checks again on a SealedCounting filter
+func TestSealedCountingFuncs(t *testing.T) {
+	testVals := [][]byte{
+		[]byte("How"),
+		[]byte("Are"),
+		[]byte("You"),
+		[]byte("Doing"),
+		[]byte("My"),
+		[]byte("Friend"),
+		[]byte("8675309"),
+		[]byte("AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"),
+	}
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+
+	orig, err := InitCounting(key[:], nonce[:24], 50, 0.01, 2)
+	require.NoError(t, err)
+	unsealed, err := InitCounting(key[:], nonce[:24], 50, 0.01, 2)
+	require.NoError(t, err)
+	emptySize := orig.SealedSize()
+
+	for i := 0; i < len(testVals); i++ {
+		orig.Add(testVals[i])
+	}
+	for i := 0; i < len(testVals); i++ {
+		require.True(t, orig.Test(testVals[i]))
+	}
+	require.Equal(t, uint64(len(testVals)), orig.EstimatedCount())
+
+	// Remove a value and make sure the others remain
+	require.NoError(t, orig.Remove(testVals[0]))
+	require.False(t, orig.Test(testVals[0]))
+	for i := 1; i < len(testVals); i++ {
+		require.True(t, orig.Test(testVals[i]))
+	}
+	require.Equal(t, uint64(len(testVals)-1), orig.EstimatedCount())
+
+	// Removing a value that isn't there fails without changing the filter
+	require.ErrorIs(t, orig.Remove(testVals[0]), ErrNotInFilter)
+	require.Equal(t, uint64(len(testVals)-1), orig.EstimatedCount())
+
+	// Now check encryption
+	metadata := []byte{42, 69}
+	ciphertext, err := orig.Seal(metadata)
+	require.NoError(t, err)
+	require.Equal(t, emptySize, len(ciphertext))
+	receivedMetadata, err := unsealed.Unseal(ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, metadata, receivedMetadata)
+	require.Equal(t, orig, unsealed)
+
+	for i := 1; i < len(testVals); i++ {
+		require.True(t, unsealed.Test(testVals[i]))
+		require.NoError(t, unsealed.Remove(testVals[i]))
+	}
+	require.Equal(t, uint64(0), unsealed.EstimatedCount())
+
+	unsealed.Reset()
+	require.Equal(t, uint64(0), unsealed.EstimatedCount())
+}
+
+// Tests that SealedCounting.EstimatedCount is close to the number of elements
+// once counters saturate.
+func TestSealedCounting_EstimatedCount_Saturated(t *testing.T) {
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+
+	filter, err := InitCountingByParameters(key[:], nonce[:24], 2000, 3, 0)
+	require.NoError(t, err)
+
+	const elements = 4000
+	for i := 0; i < elements; i++ {
+		filter.Add([]byte(fmt.Sprintf("element %d", i)))
+	}
+	sc := filter.(*sealedCounting)
+	saturated := false
+	for i := uint64(0); i < sc.size; i++ {
+		saturated = saturated || sc.counter(i) == counterMax
+	}
+	require.True(t, saturated, "No counter saturated.")
+
+	require.InDelta(t, elements, filter.EstimatedCount(), elements*0.1)
+
+	// Saturated counters are never decremented, so every element can still
+	// be removed and no remaining element is lost
+	for i := 0; i < elements; i += 2 {
+		require.NoError(t, filter.Remove([]byte(fmt.Sprintf("element %d", i))))
+	}
+	for i := 1; i < elements; i += 2 {
+		require.True(t, filter.Test([]byte(fmt.Sprintf("element %d", i))))
+	}
+}
+
+// Tests that SealedCounting.Merge combines the elements of two filters and
+// rejects filters with different parameters.
+func TestSealedCounting_Merge(t *testing.T) {
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+
+	a, err := InitCountingByParameters(key[:], nonce[:24], 201, 4, 0)
+	require.NoError(t, err)
+	b, err := InitCountingByParameters(key[:], nonce[:24], 201, 4, 0)
+	require.NoError(t, err)
+
+	a.Add([]byte("a"))
+	b.Add([]byte("b"))
+	require.NoError(t, a.Merge(b))
+	require.True(t, a.Test([]byte("a")))
+	require.True(t, a.Test([]byte("b")))
+	require.Equal(t, uint64(2), a.EstimatedCount())
+
+	require.NoError(t, a.Remove([]byte("b")))
+	require.True(t, a.Test([]byte("a")))
+
+	c, err := InitCountingByParameters(key[:], nonce[:24], 200, 4, 0)
+	require.NoError(t, err)
+	require.ErrorIs(t, a.Merge(c), ErrIncompatibleFilters)
+}
+
+// Tests that a filter resealed after SealedCounting.SetNonce produces a
+// different ciphertext that only unseals under the new nonce.
+func TestSealedCounting_SetNonce(t *testing.T) {
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+	newNonce := blake2b.Sum256(nonce[:])
+
+	orig, err := InitCounting(key[:], nonce[:24], 10, 0.01, 0)
+	require.NoError(t, err)
+	orig.Add([]byte("revoked"))
+	ciphertext1, err := orig.Seal(nil)
+	require.NoError(t, err)
+
+	require.Error(t, orig.SetNonce(newNonce[:10]))
+	require.NoError(t, orig.SetNonce(newNonce[:24]))
+	ciphertext2, err := orig.Seal(nil)
+	require.NoError(t, err)
+	require.NotEqual(t, ciphertext1, ciphertext2)
+
+	unsealed, err := InitCounting(key[:], newNonce[:24], 10, 0.01, 0)
+	require.NoError(t, err)
+	_, err = unsealed.Unseal(ciphertext2)
+	require.NoError(t, err)
+	require.True(t, unsealed.Test([]byte("revoked")))
+}
+
+// Error path: tests that invalid parameters, metadata, and ciphertexts are
+// rejected.
+func TestSealedCounting_Errors(t *testing.T) {
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+
+	_, err := InitCounting(key[:], nonce[:24], 0, 0.01, 0)
+	require.Error(t, err)
+	_, err = InitCounting(key[:], nonce[:24], 10, 1, 0)
+	require.Error(t, err)
+	_, err = InitCountingByParameters(key[:], nonce[:24], 0, 3, 0)
+	require.Error(t, err)
+	_, err = InitCountingByParameters(key[:], nonce[:23], 10, 3, 0)
+	require.Error(t, err)
+	_, err = InitCountingByParameters(key[:31], nonce[:24], 10, 3, 0)
+	require.Error(t, err)
+
+	filter, err := InitCountingByParameters(key[:], nonce[:24], 10, 3, 2)
+	require.NoError(t, err)
+	_, err = filter.Seal([]byte{1})
+	require.Error(t, err)
+	_, err = filter.Unseal(make([]byte, filter.SealedSize()+1))
+	require.Error(t, err)
+}
+
+// Tests that the locations of an element are all distinct for the prime size
+// chosen by InitCounting and for a power of two size, where a step that is
+// even or zero modulo the size would repeat locations.
+func TestSealedCounting_locations(t *testing.T) {
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+
+	prime, err := InitCounting(key[:], nonce[:24], 50, 0.01, 0)
+	require.NoError(t, err)
+	require.Equal(t, nextPrime(prime.GetSize()), prime.GetSize())
+	powerOfTwo, err := InitCountingByParameters(key[:], nonce[:24], 64, 16, 0)
+	require.NoError(t, err)
+
+	for _, filter := range []SealedCounting{prime, powerOfTwo} {
+		for i := 0; i < 1000; i++ {
+			locations := filter.(*sealedCounting).locations(
+				[]byte(fmt.Sprintf("value %d", i)))
+			seen := make(map[uint64]struct{}, len(locations))
+			for _, location := range locations {
+				require.NotContains(t, seen, location,
+					"size %d value %d", filter.GetSize(), i)
+				seen[location] = struct{}{}
+			}
+		}
+	}
+}
+
+// Tests that nextPrime returns the smallest prime at least n.
+func Test_nextPrime(t *testing.T) {
+	for n, expected := range map[uint64]uint64{
+		0: 2, 1: 2, 2: 2, 3: 3, 4: 5, 8: 11, 14: 17, 480: 487, 7919: 7919} {
+		require.Equal(t, expected, nextPrime(n), "n = %d", n)
+	}
+}
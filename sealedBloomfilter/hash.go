@@ -0,0 +1,109 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package bloomfilter
+
+// The hashing here is the same as that of gitlab.com/elixxir/bloomfilter,
+// which does not export it, so that the bit positions of data can be found
+// without adding it to a filter. Unlike the library, it does not allocate.
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// 128-bit MurmurHash3 constants.
+const (
+	murmur64c1 uint64 = 0x87c37b91114253d5
+	murmur64c2 uint64 = 0x4cf5ad432745937f
+	murmur64c3 uint64 = 0x52dce729
+	murmur64c4 uint64 = 0x38495ab5
+	murmur64c5 uint64 = 0xff51afd7ed558ccd
+	murmur64c6 uint64 = 0xc4ceb9fe1a85ec53
+)
+
+// multiHash returns the four 64-bit hashes from which the bit positions of
+// the data are derived: the 128-bit MurmurHash3 of the data and of the data
+// followed by a one byte. The scratch buffer is used to append the byte and is
+// returned so that it can be reused.
+func multiHash(data, scratch []byte) (hash [4]uint64, newScratch []byte) {
+	hash[0], hash[1] = murmur128(data)
+	scratch = append(append(scratch[:0], data...), 1)
+	hash[2], hash[3] = murmur128(scratch)
+	return hash, scratch
+}
+
+// bitPosition returns the bit of the nth hash operation in a filter of the
+// given size.
+func bitPosition(hash [4]uint64, n, size uint64) uint64 {
+	index := 2 + (((n + (n % 2)) % 4) / 2)
+	return (hash[n%2] + n*hash[index]) % size
+}
+
+// murmur128 returns the two 64-bit halves of the 128-bit MurmurHash3 of the
+// data with a seed of zero, as computed by the library.
+func murmur128(data []byte) (h1, h2 uint64) {
+	var k1, k2 uint64
+	blocks := len(data) / 16
+	for i := 0; i < blocks; i++ {
+		k1 = mixK1(binary.LittleEndian.Uint64(data[i*16:]))
+		h1 ^= k1
+		h1 = bits.RotateLeft64(h1, 27) + h2
+		h1 = h1*5 + murmur64c3
+
+		k2 = mixK2(binary.LittleEndian.Uint64(data[i*16+8:]))
+		h2 ^= k2
+		h2 = bits.RotateLeft64(h2, 31) + h1
+		h2 = h2*5 + murmur64c4
+	}
+
+	// The tail is read as little endian words padded with zeros. As in the
+	// library, it is mixed into the words of the last block rather than into
+	// zero, which differs from the reference MurmurHash3.
+	var tail [16]byte
+	tailLen := copy(tail[:], data[blocks*16:])
+	if tailLen > 8 {
+		k2 = mixK2(k2 ^ binary.LittleEndian.Uint64(tail[8:]))
+		h2 ^= k2
+	}
+	if tailLen > 0 {
+		k1 = mixK1(k1 ^ binary.LittleEndian.Uint64(tail[:8]))
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(len(data))
+	h2 ^= uint64(len(data))
+	h1 += h2
+	h2 += h1
+	h1 = fmix(h1)
+	h2 = fmix(h2)
+	h1 += h2
+	h2 += h1
+	return h1, h2
+}
+
+func mixK1(k1 uint64) uint64 {
+	k1 *= murmur64c1
+	k1 = bits.RotateLeft64(k1, 31)
+	return k1 * murmur64c2
+}
+
+func mixK2(k2 uint64) uint64 {
+	k2 *= murmur64c2
+	k2 = bits.RotateLeft64(k2, 33)
+	return k2 * murmur64c1
+}
+
+// fmix is the 64-bit MurmurHash3 finalizer.
+func fmix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= murmur64c5
+	h ^= h >> 33
+	h *= murmur64c6
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,43 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package bloomfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	bloomfilter "gitlab.com/elixxir/bloomfilter"
+)
+
+// Tests that the bit positions from multiHash and bitPosition are the bits set
+// by gitlab.com/elixxir/bloomfilter for data of every tail length.
+func Test_bitPosition(t *testing.T) {
+	const size, hashFunctions = 1021, 7
+	var scratch []byte
+	for length := 0; length < 50; length++ {
+		data := make([]byte, length)
+		for i := range data {
+			data[i] = byte(length*31 + i)
+		}
+
+		filter, err := bloomfilter.InitByParameters(size, hashFunctions)
+		require.NoError(t, err)
+		filter.Add(data)
+		expected, err := filter.MarshalStorage()
+		require.NoError(t, err)
+
+		var hash [4]uint64
+		hash, scratch = multiHash(data, scratch)
+		received := make([]byte, len(expected))
+		for n := uint64(0); n < hashFunctions; n++ {
+			index := bitPosition(hash, n, size)
+			received[index/8] |= 1 << (index % 8)
+		}
+		require.Equal(t, expected, received, "length %d", length)
+	}
+}
@@ -8,6 +8,8 @@
 package bloomfilter
 
 import (
+	"crypto/subtle"
+
 	"github.com/pkg/errors"
 	bloomfilter "gitlab.com/elixxir/bloomfilter"
 	"golang.org/x/crypto/chacha20"
@@ -19,6 +21,7 @@ var ErrInvalidMetadataLen = errors.Errorf("Metadata size is incorrect, " +
 	"does not match passed size")
 var ErrInvalidSealedLen = errors.Errorf("Sealed data size is incorrect, " +
 	"does not match the expected size")
+var ErrBufferSize = errors.Errorf("buffer must be at least the sealed size")
 
 type Sealed interface {
 	// Seal encrypts the filter in order to hide metadata, specifically
@@ -66,6 +69,35 @@ type Sealed interface {
 	SealedSize() int
 }
 
+// SealedInPlace is a Sealed filter that can be reused to unseal many payloads
+// without allocating and tested in constant time. The filters returned by Init
+// and InitByParameters implement it.
+type SealedInPlace interface {
+	Sealed
+
+	// UnsealInto is Unseal without allocating. It decrypts into buf, which
+	// must be at least SealedSize() bytes, and returns the metadata as a
+	// slice of buf. The metadata is only valid until buf is reused, so a
+	// caller unsealing many filters can use the same buf for all of them.
+	UnsealInto(ciphertext, buf []byte) ([]byte, error)
+
+	// SetNonce replaces the nonce used by Seal and Unseal so that the filter
+	// can be reused for another sealed payload under the same key, such as
+	// the next message sent to the same pickup ID.
+	SetNonce(nonce []byte) error
+
+	// TestConstantTime is Test in constant time. Test returns at the first
+	// unset bit, so its timing reveals how many of the bits of the data are
+	// set. TestConstantTime always checks every bit of the filter.
+	//
+	// Once the filter has been tested, it does not allocate until the filter
+	// changes by any means other than UnsealInto or Unseal. It reuses buffers
+	// held by the filter, so it must not be called concurrently.
+	TestConstantTime(data []byte) bool
+}
+
+var _ SealedInPlace = (*sealed)(nil)
+
 type sealed struct {
 	// NOTE: we can't put the cipher here, because the object doesn't
 	// allow rollbacks that are needed for the unseal operation.
@@ -79,6 +111,12 @@ type sealed struct {
 	// all the underlying functions, particularly the marshallers,
 	// which will not work as expected.
 	filter bloomfilter.Bloom
+
+	// bits is a copy of the bit array of the filter for TestConstantTime,
+	// which is only valid while bitsValid is set. probe and hashBuf are
+	// scratch buffers for TestConstantTime.
+	bits, probe, hashBuf []byte
+	bitsValid            bool
 }
 
 // Init initializes and returns a new sealed bloom filter, or an
@@ -186,18 +224,51 @@ func (s *sealed) Unseal(ciphertext []byte) ([]byte, error) {
 	if len(ciphertext) != s.SealedSize() {
 		return nil, errors.WithStack(ErrInvalidSealedLen)
 	}
-	plaintext := make([]byte, len(ciphertext))
+	return s.UnsealInto(ciphertext, make([]byte, len(ciphertext)))
+}
+
+// UnsealInto is Unseal without allocating. It decrypts into buf, which
+// must be at least SealedSize() bytes, and returns the metadata as a
+// slice of buf. The metadata is only valid until buf is reused, so a
+// caller unsealing many filters can use the same buf for all of them.
+func (s *sealed) UnsealInto(ciphertext, buf []byte) ([]byte, error) {
+	if len(ciphertext) != s.SealedSize() {
+		return nil, errors.WithStack(ErrInvalidSealedLen)
+	}
+	if len(buf) < len(ciphertext) {
+		return nil, errors.WithStack(ErrBufferSize)
+	}
+	plaintext := buf[:len(ciphertext)]
+
+	// NOTE: the cipher does not escape, so it is allocated on the stack
 	cipher, err := chacha20.NewUnauthenticatedCipher(s.key, s.nonce)
 	if err != nil {
 		return nil, err
 	}
 	cipher.XORKeyStream(plaintext, ciphertext)
-	return plaintext[s.filter.BufferSize():],
-		s.filter.UnmarshalStorage(plaintext[:s.filter.BufferSize()])
+
+	filterBits := plaintext[:s.filter.BufferSize()]
+	if err = s.filter.UnmarshalStorage(filterBits); err != nil {
+		s.bitsValid = false
+		return nil, err
+	}
+
+	// Refresh the copy of the bits if TestConstantTime has made one
+	s.bitsValid = copy(s.bits, filterBits) == len(filterBits)
+	return plaintext[len(filterBits):], nil
+}
+
+func (s *sealed) SetNonce(nonce []byte) error {
+	if len(nonce) != chacha20.NonceSizeX {
+		return errors.WithStack(ErrNonceSize)
+	}
+	s.nonce = nonce
+	return nil
 }
 
 func (s *sealed) Add(data []byte) {
 	s.filter.Add(data)
+	s.bitsValid = false
 }
 
 func (s *sealed) GetSize() uint64 {
@@ -210,17 +281,57 @@ func (s *sealed) GetHashOpCount() uint64 {
 
 func (s *sealed) Reset() {
 	s.filter.Reset()
+	s.bitsValid = false
 }
 
 func (s *sealed) Test(data []byte) bool {
 	return s.filter.Test(data)
 }
 
+// TestConstantTime is Test in constant time. It sets the bits of the data in
+// an empty probe the size of the filter and checks, across the whole filter,
+// that every bit set in the probe is also set in the filter.
+func (s *sealed) TestConstantTime(data []byte) bool {
+	if !s.bitsValid {
+		filterBits, err := s.filter.MarshalStorage()
+		if err != nil {
+			return false
+		}
+		s.bits, s.bitsValid = filterBits, true
+	}
+
+	if len(s.probe) != len(s.bits) {
+		s.probe = make([]byte, len(s.bits))
+	} else {
+		for i := range s.probe {
+			s.probe[i] = 0
+		}
+	}
+
+	var hash [4]uint64
+	hash, s.hashBuf = multiHash(data, s.hashBuf)
+	size := s.filter.GetSize()
+	for n := uint64(0); n < s.filter.GetHashOpCount(); n++ {
+		index := bitPosition(hash, n, size)
+		s.probe[index/8] |= 1 << (index % 8)
+	}
+
+	var missing byte
+	for i := range s.probe {
+		missing |= s.probe[i] &^ s.bits[i]
+	}
+	return subtle.ConstantTimeByteEq(missing, 0) == 1
+}
+
 func (s *sealed) Merge(m Sealed) error {
+	s.bitsValid = false
 	return s.filter.Merge(m.Bloom())
 }
 
+// Bloom returns the underlying filter. Since the caller may change it, the
+// copy of its bits held for TestConstantTime is no longer trusted.
 func (s *sealed) Bloom() *bloomfilter.Bloom {
+	s.bitsValid = false
 	return &s.filter
 }
 
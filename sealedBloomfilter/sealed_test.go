@@ -8,6 +8,7 @@
 package bloomfilter
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -97,3 +98,185 @@ func TestSealedFuncs(t *testing.T) {
 	}
 
 }
+
+// Tests that UnsealInto unseals the same filter and metadata as Unseal, without
+// allocating, reusing the same buffer for many filters.
+func TestSealed_UnsealInto(t *testing.T) {
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+
+	orig, err := InitByParameters(key[:], nonce[:24], 184, 10, 2)
+	require.NoError(t, err)
+	unsealed, err := InitByParameters(key[:], nonce[:24], 184, 10, 2)
+	require.NoError(t, err)
+	sealedInto, err := InitByParameters(key[:], nonce[:24], 184, 10, 2)
+	require.NoError(t, err)
+	into := sealedInto.(SealedInPlace)
+
+	buf := make([]byte, into.SealedSize()+10)
+	for i := 0; i < 10; i++ {
+		orig.Add([]byte{byte(i)})
+		metadata := []byte{byte(i), 69}
+		ciphertext, err := orig.Seal(metadata)
+		require.NoError(t, err)
+
+		expected, err := unsealed.Unseal(ciphertext)
+		require.NoError(t, err)
+		received, err := into.UnsealInto(ciphertext, buf)
+		require.NoError(t, err)
+		require.Equal(t, expected, received)
+		require.Equal(t, metadata, received)
+		require.Equal(t, unsealed, into)
+	}
+
+	ciphertext, err := orig.Seal([]byte{1, 2})
+	require.NoError(t, err)
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = into.UnsealInto(ciphertext, buf)
+	})
+	require.Zero(t, allocs)
+
+	_, err = into.UnsealInto(ciphertext, buf[:len(ciphertext)-1])
+	require.ErrorIs(t, err, ErrBufferSize)
+	_, err = into.UnsealInto(ciphertext[1:], buf)
+	require.ErrorIs(t, err, ErrInvalidSealedLen)
+}
+
+// Tests that a filter reused with SetNonce unseals a payload sealed under the
+// new nonce.
+func TestSealed_SetNonce(t *testing.T) {
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+	newNonce := blake2b.Sum256(nonce[:])
+
+	orig, err := InitByParameters(key[:], newNonce[:24], 200, 10, 0)
+	require.NoError(t, err)
+	orig.Add([]byte("value"))
+	ciphertext, err := orig.Seal(nil)
+	require.NoError(t, err)
+
+	sealedReused, err := InitByParameters(key[:], nonce[:24], 200, 10, 0)
+	require.NoError(t, err)
+	reused := sealedReused.(SealedInPlace)
+	require.Error(t, reused.SetNonce(newNonce[:16]))
+	require.NoError(t, reused.SetNonce(newNonce[:24]))
+	_, err = reused.Unseal(ciphertext)
+	require.NoError(t, err)
+	require.True(t, reused.Test([]byte("value")))
+}
+
+// Tests that TestConstantTime agrees with Test on values that were and were
+// not added.
+func TestSealed_TestConstantTime(t *testing.T) {
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+
+	sealedFilter, err := InitByParameters(key[:], nonce[:24], 184, 5, 0)
+	require.NoError(t, err)
+	filter := sealedFilter.(SealedInPlace)
+	for i := 0; i < 20; i++ {
+		filter.Add([]byte(fmt.Sprintf("added %d", i)))
+	}
+
+	for i := 0; i < 20; i++ {
+		data := []byte(fmt.Sprintf("added %d", i))
+		require.True(t, filter.TestConstantTime(data))
+	}
+	for i := 0; i < 1000; i++ {
+		data := []byte(fmt.Sprintf("absent %d", i))
+		require.Equal(t, filter.Test(data), filter.TestConstantTime(data))
+	}
+
+	// The filter is tested again after it changes
+	filter.Add([]byte("absent 0"))
+	require.True(t, filter.TestConstantTime([]byte("absent 0")))
+	filter.Reset()
+	require.False(t, filter.TestConstantTime([]byte("added 0")))
+}
+
+// Tests that TestConstantTime does not allocate once the filter has been
+// tested, including after the filter is unsealed again with UnsealInto.
+func TestSealed_TestConstantTime_Allocs(t *testing.T) {
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+
+	orig, err := InitByParameters(key[:], nonce[:24], 184, 28, 2)
+	require.NoError(t, err)
+	orig.Add([]byte("value"))
+	ciphertext, err := orig.Seal([]byte{1, 2})
+	require.NoError(t, err)
+
+	sealedFilter, err := InitByParameters(key[:], nonce[:24], 184, 28, 2)
+	require.NoError(t, err)
+	filter := sealedFilter.(SealedInPlace)
+	buf := make([]byte, filter.SealedSize())
+
+	value, other := []byte("value"), []byte("other value")
+	var found, absent bool
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = filter.UnsealInto(ciphertext, buf)
+		found = filter.TestConstantTime(value)
+		absent = filter.TestConstantTime(other)
+	})
+	require.Zero(t, allocs)
+	require.True(t, found)
+	require.False(t, absent)
+}
+
+// newBenchmarkSealed returns a filter the size of a compressed SIH and a
+// payload sealed under it.
+func newBenchmarkSealed(b *testing.B) (SealedInPlace, []byte) {
+	key := blake2b.Sum256([]byte("Hello World!"))
+	nonce := blake2b.Sum256(key[:])
+	filter, err := InitByParameters(key[:], nonce[:24], 184, 28, 2)
+	if err != nil {
+		b.Fatal(err)
+	}
+	filter.Add([]byte("value"))
+	ciphertext, err := filter.Seal([]byte{1, 2})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return filter.(SealedInPlace), ciphertext
+}
+
+func BenchmarkSealed_Unseal(b *testing.B) {
+	filter, ciphertext := newBenchmarkSealed(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := filter.Unseal(ciphertext); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSealed_UnsealInto(b *testing.B) {
+	filter, ciphertext := newBenchmarkSealed(b)
+	buf := make([]byte, filter.SealedSize())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := filter.UnsealInto(ciphertext, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSealed_Test(b *testing.B) {
+	filter, _ := newBenchmarkSealed(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filter.Test([]byte("value"))
+	}
+}
+
+func BenchmarkSealed_TestConstantTime(b *testing.B) {
+	filter, _ := newBenchmarkSealed(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filter.TestConstantTime([]byte("value"))
+	}
+}
@@ -0,0 +1,149 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package sih
+
+// EvaluateCompressedSIH derives the filter key, unseals the filter, and hashes
+// the identifier preimage on every call. A notification server checking many
+// identities against every message repeats most of that work. A BatchEvaluator
+// instead derives the filter key of every pickup ID and the preimage of every
+// identifier once, then for each message unseals the filter once per pickup ID
+// and tests every identity sharing that pickup ID against it. Tags shared by
+// several identities are only tested once per filter.
+
+import (
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// SIHIdentity is an identity to check compressed SIHs for, with its filter key
+// and identifier preimage computed ahead of time.
+type SIHIdentity struct {
+	pickup     *id.ID
+	identifier []byte
+	tags       []string
+
+	// preimage is MakePreimage(identifier, compressedTag).
+	preimage Preimage
+}
+
+// NewSIHIdentity creates an identity that looks for compressed SIHs sent to
+// the pickup ID with the given identifier and checks them for the given tags.
+func NewSIHIdentity(
+	pickup *id.ID, identifier []byte, tags []string) *SIHIdentity {
+	return &SIHIdentity{
+		pickup:     pickup,
+		identifier: identifier,
+		tags:       tags,
+		preimage:   MakePreimage(identifier, compressedTag),
+	}
+}
+
+// Pickup returns the pickup ID of the identity.
+func (si *SIHIdentity) Pickup() *id.ID {
+	return si.pickup
+}
+
+// Identifier returns the identifier of the identity.
+func (si *SIHIdentity) Identifier() []byte {
+	return si.identifier
+}
+
+// Tags returns the tags the identity checks for.
+func (si *SIHIdentity) Tags() []string {
+	return si.tags
+}
+
+// BatchMatch is an identity whose identifier was found in a compressed SIH.
+type BatchMatch struct {
+	Identity *SIHIdentity
+
+	// MatchedTags are the tags of the identity found in the SIH.
+	MatchedTags map[string]struct{}
+
+	// Metadata is the metadata stored in the SIH.
+	Metadata []byte
+}
+
+// BatchEvaluator evaluates compressed SIHs for many identities at once. It is
+// equivalent to calling EvaluateCompressedSIH for every identity.
+//
+// A BatchEvaluator is safe for concurrent use, but the identities must not be
+// modified after it is created.
+type BatchEvaluator struct {
+	groups []*batchGroup
+}
+
+// batchGroup holds the identities that share a pickup ID, and so a filter.
+type batchGroup struct {
+	key        []byte
+	identities []*SIHIdentity
+}
+
+// NewBatchEvaluator creates a BatchEvaluator for the given identities.
+func NewBatchEvaluator(identities []*SIHIdentity) *BatchEvaluator {
+	groups := make(map[id.ID]*batchGroup)
+	be := &BatchEvaluator{}
+	for _, identity := range identities {
+		group, exists := groups[*identity.pickup]
+		if !exists {
+			group = &batchGroup{key: makeFilterKey(identity.pickup)}
+			groups[*identity.pickup] = group
+			be.groups = append(be.groups, group)
+		}
+		group.identities = append(group.identities, identity)
+	}
+
+	return be
+}
+
+// Evaluate checks the compressed SIH of the message with the given hash for
+// every identity. It returns a BatchMatch for every identity whose identifier
+// is found. Matches are grouped by pickup ID, in the order each pickup ID first
+// appears in the identities passed to NewBatchEvaluator.
+func (be *BatchEvaluator) Evaluate(
+	msgHash, compressedSIH []byte) ([]BatchMatch, error) {
+	var matches []BatchMatch
+	for _, group := range be.groups {
+		filter, err := makeFilterFromKey(group.key, msgHash)
+		if err != nil {
+			return nil, err
+		}
+		metadata, err := filter.Unseal(compressedSIH)
+		if err != nil {
+			return nil, err
+		}
+
+		// Results of testing tags that more than one identity checks for
+		tested := make(map[string]bool)
+		for _, identity := range group.identities {
+			entry := HashFromMessageHash(identity.preimage, msgHash)
+			if !filter.Test(entry) {
+				continue
+			}
+
+			matchedTags := make(map[string]struct{}, len(identity.tags))
+			for _, tag := range identity.tags {
+				found, exists := tested[tag]
+				if !exists {
+					found = filter.Test([]byte(tag))
+					tested[tag] = found
+				}
+				if found {
+					matchedTags[tag] = struct{}{}
+				}
+			}
+
+			matches = append(matches, BatchMatch{
+				Identity:    identity,
+				MatchedTags: matchedTags,
+				Metadata:    metadata,
+			})
+		}
+	}
+
+	return matches, nil
+}
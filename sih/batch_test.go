@@ -0,0 +1,150 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package sih
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// newBatchTestIdentities creates numIdentities identities spread over
+// numPickups pickup IDs. Every identity checks for a tag shared by all
+// identities and a tag of its own.
+func newBatchTestIdentities(numIdentities, numPickups int,
+	prng *rand.Rand) []*SIHIdentity {
+	pickups := make([]*id.ID, numPickups)
+	for i := range pickups {
+		pickups[i] = &id.ID{}
+		binary.BigEndian.PutUint64(pickups[i][:], uint64(i))
+		pickups[i].SetType(id.User)
+	}
+
+	identities := make([]*SIHIdentity, numIdentities)
+	for i := range identities {
+		identifier := make([]byte, 32)
+		prng.Read(identifier)
+		identities[i] = NewSIHIdentity(pickups[i%numPickups], identifier,
+			[]string{"shared", fmt.Sprintf("tag %d", i)})
+	}
+	return identities
+}
+
+// Tests that BatchEvaluator.Evaluate returns the same results as calling
+// EvaluateCompressedSIH for every identity.
+func TestBatchEvaluator_Evaluate(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	identities := newBatchTestIdentities(200, 3, prng)
+	be := NewBatchEvaluator(identities)
+
+	for _, recipient := range []int{0, 7, 101, 199} {
+		msgHash := make([]byte, 32)
+		prng.Read(msgHash)
+		r := identities[recipient]
+		compressedSIH, err := MakeCompressedSIH(r.Pickup(), msgHash,
+			r.Identifier(), []string{r.Tags()[1]}, []byte{1, 2})
+		require.NoError(t, err)
+
+		matches, err := be.Evaluate(msgHash, compressedSIH)
+		require.NoError(t, err)
+
+		expected := make(map[*SIHIdentity]map[string]struct{})
+		for _, identity := range identities {
+			matchedTags, metadata, found, err := EvaluateCompressedSIH(
+				identity.Pickup(), msgHash, identity.Identifier(),
+				identity.Tags(), compressedSIH)
+			require.NoError(t, err)
+			if found {
+				expected[identity] = matchedTags
+				require.NotNil(t, metadata)
+			}
+		}
+		require.Contains(t, expected, r)
+
+		require.Len(t, matches, len(expected))
+		for _, match := range matches {
+			require.Equal(t, expected[match.Identity], match.MatchedTags)
+			if match.Identity == r {
+				require.Contains(t, match.MatchedTags, r.Tags()[1])
+				require.Equal(t, []byte{1, 2}, match.Metadata)
+			}
+		}
+	}
+}
+
+// Error path: tests that BatchEvaluator.Evaluate returns an error for an SIH
+// of the wrong size.
+func TestBatchEvaluator_Evaluate_InvalidSIH(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	be := NewBatchEvaluator(newBatchTestIdentities(10, 2, prng))
+	msgHash := make([]byte, 32)
+
+	_, err := be.Evaluate(msgHash, make([]byte, 10))
+	require.Error(t, err)
+}
+
+func benchmarkSIH(b *testing.B, identities []*SIHIdentity) ([]byte, []byte) {
+	msgHash := make([]byte, 32)
+	rand.New(rand.NewSource(42)).Read(msgHash)
+	r := identities[len(identities)/2]
+	compressedSIH, err := MakeCompressedSIH(r.Pickup(), msgHash,
+		r.Identifier(), r.Tags(), []byte{1, 2})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return msgHash, compressedSIH
+}
+
+func BenchmarkEvaluateCompressedSIH_1000Identities(b *testing.B) {
+	identities := newBatchTestIdentities(
+		1000, 1, rand.New(rand.NewSource(42)))
+	msgHash, compressedSIH := benchmarkSIH(b, identities)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, identity := range identities {
+			_, _, _, err := EvaluateCompressedSIH(identity.Pickup(), msgHash,
+				identity.Identifier(), identity.Tags(), compressedSIH)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkBatchEvaluator_Evaluate_1000Identities(b *testing.B) {
+	identities := newBatchTestIdentities(
+		1000, 1, rand.New(rand.NewSource(42)))
+	msgHash, compressedSIH := benchmarkSIH(b, identities)
+	be := NewBatchEvaluator(identities)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := be.Evaluate(msgHash, compressedSIH); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBatchEvaluator_Evaluate_1000Pickups(b *testing.B) {
+	identities := newBatchTestIdentities(
+		1000, 1000, rand.New(rand.NewSource(42)))
+	msgHash, compressedSIH := benchmarkSIH(b, identities)
+	be := NewBatchEvaluator(identities)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := be.Evaluate(msgHash, compressedSIH); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package sih
+
+// MakeCompressedSIH always uses numHashOps, which is tuned for about five
+// entries. Messages carrying many tags fill the filter and match tags they do
+// not contain far more often. The functions here let the sender choose the
+// number of hash ops for the number of tags it adds or the false positive rate
+// it wants. The choice is sealed inside the filter alongside the metadata, so
+// the receiver does not need to know it ahead of time.
+//
+// Parameterized SIHs are the same size as compressed SIHs but give up one byte
+// of the filter to hold the number of hash ops. They are not interchangeable
+// with compressed SIHs: an SIH made with MakeCompressedSIHWithParams must be
+// evaluated with EvaluateCompressedSIHWithParams.
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	ring "gitlab.com/elixxir/bloomfilter"
+	"gitlab.com/elixxir/primitives/format"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+const (
+	// paramsSize is the size of the parameters sealed before the metadata.
+	paramsSize = 1
+
+	// paramsFilterSize is the filter size of a parameterized SIH, which is the
+	// SIH less the metadata and parameters.
+	paramsFilterSize = uint64((format.SIHLen - metadataSize - paramsSize) * 8)
+
+	// MaxCompressedSIHHashOps is the largest number of hash ops that can be
+	// stored in a parameterized SIH.
+	MaxCompressedSIHHashOps = math.MaxUint8
+)
+
+var ErrInvalidHashOps = errors.Errorf("number of hash ops must be between "+
+	"1 and %d", MaxCompressedSIHHashOps)
+var ErrInvalidFalsePositive = errors.Errorf(
+	"false positive rate must be between 0 and 1")
+
+// CompressedSIHParams are the filter parameters of a parameterized SIH.
+type CompressedSIHParams struct {
+	// HashOps is the number of hash ops run on every entry added to and tested
+	// against the filter.
+	HashOps uint8
+}
+
+// NewCompressedSIHParamsForTags returns the parameters with the lowest false
+// positive rate for an SIH containing the given number of tags. The identifier
+// entry is counted on top of the tags.
+func NewCompressedSIHParamsForTags(numTags int) CompressedSIHParams {
+	// The optimal number of hash ops is (m / n) * ln(2), where m is the number
+	// of bits and n is the number of entries
+	entries := float64(numTags + 1)
+	hashOps := math.Round(float64(paramsFilterSize) / entries * math.Ln2)
+	return CompressedSIHParams{HashOps: clampHashOps(hashOps)}
+}
+
+// NewCompressedSIHParamsForFalsePositive returns the parameters that fit the
+// most tags into an SIH while keeping the false positive rate at or below the
+// given rate. Returns an error if the rate is not between 0 and 1, exclusive.
+// Use CompressedSIHParams.FalsePositiveRate to check the rate reached for a
+// given number of tags.
+func NewCompressedSIHParamsForFalsePositive(
+	falsePositive float64) (CompressedSIHParams, error) {
+	if !(falsePositive > 0 && falsePositive < 1) {
+		return CompressedSIHParams{}, errors.WithStack(ErrInvalidFalsePositive)
+	}
+
+	// The number of hash ops that fits the most entries for a false positive
+	// rate p is -log2(p)
+	hashOps := math.Ceil(-math.Log2(falsePositive))
+	return CompressedSIHParams{HashOps: clampHashOps(hashOps)}, nil
+}
+
+// FalsePositiveRate returns the estimated probability that a tag or identifier
+// not in an SIH containing the given number of tags is reported as present.
+func (p CompressedSIHParams) FalsePositiveRate(numTags int) float64 {
+	// The false positive rate is (1 - e^(-kn/m))^k, where k is the number of
+	// hash ops, n is the number of entries, and m is the number of bits
+	k := float64(p.HashOps)
+	entries := float64(numTags + 1)
+	return math.Pow(
+		1-math.Exp(-k*entries/float64(paramsFilterSize)), k)
+}
+
+// MakeCompressedSIHWithParams creates an SIH like MakeCompressedSIH, using the
+// given filter parameters and sealing them into the SIH. It returns the
+// estimated false positive rate of the SIH.
+func MakeCompressedSIHWithParams(pickup *id.ID, msgHash, identifier []byte,
+	tags []string, metadata []byte, params CompressedSIHParams) (
+	sih []byte, falsePositive float64, err error) {
+	if params.HashOps == 0 {
+		return nil, 0, errors.WithStack(ErrInvalidHashOps)
+	}
+
+	filter, err := makeParamsFilter(pickup, msgHash, params.HashOps)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter.Add(makeSIHEntry(msgHash, identifier))
+	for i := 0; i < len(tags); i++ {
+		filter.Add([]byte(tags[i]))
+	}
+
+	sealedMetadata := append([]byte{params.HashOps}, metadata...)
+	sih, err = filter.Seal(sealedMetadata)
+	if err != nil {
+		return nil, 0, err
+	}
+	return sih, params.FalsePositiveRate(len(tags)), nil
+}
+
+// EvaluateCompressedSIHWithParams evaluates an SIH made with
+// MakeCompressedSIHWithParams like EvaluateCompressedSIH. The filter
+// parameters are read from the SIH. It also returns the parameters, which the
+// receiver can use to estimate the false positive rate of the matched tags.
+func EvaluateCompressedSIHWithParams(pickup *id.ID, msgHash, identifier []byte,
+	tags []string, sih []byte) (matchedTags map[string]struct{},
+	metadata []byte, params CompressedSIHParams, identifierFound bool,
+	err error) {
+	key := makeFilterKey(pickup)
+
+	// Unsealing does not depend on the number of hash ops, so unseal into a
+	// filter with one hash op to read them, then load the unsealed bits into a
+	// filter that uses them
+	filter, err := makeParamsFilterFromKey(key, msgHash, 1)
+	if err != nil {
+		return nil, nil, params, false, err
+	}
+	sealedMetadata, err := filter.Unseal(sih)
+	if err != nil {
+		return nil, nil, params, false, err
+	}
+
+	// An SIH sealed under another pickup ID decrypts to random parameters,
+	// which may be invalid
+	params.HashOps = sealedMetadata[0]
+	if params.HashOps == 0 {
+		return nil, nil, CompressedSIHParams{}, false, nil
+	}
+
+	bits, err := filter.Bloom().MarshalStorage()
+	if err != nil {
+		return nil, nil, CompressedSIHParams{}, false, err
+	}
+	bloom, err := ring.InitByParameters(
+		paramsFilterSize, uint64(params.HashOps))
+	if err != nil {
+		return nil, nil, CompressedSIHParams{}, false, err
+	}
+	if err = bloom.UnmarshalStorage(bits); err != nil {
+		return nil, nil, CompressedSIHParams{}, false, err
+	}
+
+	// If the identifier entry doesn't exist, skip processing tags
+	if !bloom.Test(makeSIHEntry(msgHash, identifier)) {
+		return nil, nil, CompressedSIHParams{}, false, nil
+	}
+
+	matchedTags = make(map[string]struct{}, len(tags))
+	for i := 0; i < len(tags); i++ {
+		curTag := tags[i]
+		if bloom.Test([]byte(curTag)) {
+			matchedTags[curTag] = struct{}{}
+		}
+	}
+	return matchedTags, sealedMetadata[paramsSize:], params, true, nil
+}
+
+// clampHashOps rounds the number of hash ops into the range that can be
+// stored in a parameterized SIH.
+func clampHashOps(hashOps float64) uint8 {
+	return uint8(math.Max(1, math.Min(hashOps, MaxCompressedSIHHashOps)))
+}
@@ -0,0 +1,146 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package sih
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/elixxir/primitives/format"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+func TestCompressedWithParams(t *testing.T) {
+	identifier := []byte("MyIdentifier")
+	// Few enough tags that the false positive rate is negligible, so the bad
+	// identifier below is reliably not found
+	numTags := 5
+	tags := make([]string, numTags)
+	for i := 0; i < numTags; i++ {
+		tags[i] = fmt.Sprintf("Tag: %d", i)
+	}
+
+	lookFor := []string{tags[1], tags[3], tags[4]}
+
+	pickup := &id.DummyUser
+	msgHash := []byte("8675309 This IS a dummy message hash")
+	metaData := []byte{1, 2}
+	params := NewCompressedSIHParamsForTags(numTags)
+	sih, fp, err := MakeCompressedSIHWithParams(
+		pickup, msgHash, identifier, tags, metaData, params)
+	require.NoError(t, err)
+	require.Equal(t, format.SIHLen, len(sih))
+	require.Equal(t, params.FalsePositiveRate(numTags), fp)
+	require.Less(t, fp, 1e-5)
+
+	matchedTags, receivedMetadata, receivedParams, identifierFound, err :=
+		EvaluateCompressedSIHWithParams(
+			pickup, msgHash, identifier, lookFor, sih)
+	require.NoError(t, err)
+	require.True(t, identifierFound)
+	require.Equal(t, metaData, receivedMetadata)
+	require.Equal(t, params, receivedParams)
+
+	require.Equal(t, len(lookFor), len(matchedTags))
+	for i := 0; i < len(lookFor); i++ {
+		require.Contains(t, matchedTags, lookFor[i])
+	}
+
+	// Make sure it doesn't work when the identifier is wrong
+	badIdentifier := []byte("BadIdentifier")
+	matchedTags, receivedMetadata, _, identifierFound, err =
+		EvaluateCompressedSIHWithParams(
+			pickup, msgHash, badIdentifier, lookFor, sih)
+	require.NoError(t, err)
+	require.False(t, identifierFound)
+	require.Equal(t, 0, len(matchedTags))
+	require.Equal(t, 0, len(receivedMetadata))
+
+	// Make sure it doesn't work when the pickup ID is wrong
+	_, _, _, identifierFound, err = EvaluateCompressedSIHWithParams(
+		&id.ZeroUser, msgHash, identifier, lookFor, sih)
+	require.NoError(t, err)
+	require.False(t, identifierFound)
+}
+
+// Tests that parameters picked for a tag count give a lower false positive
+// rate for that many tags than the fixed numHashOps does, and that the
+// estimate matches the measured rate.
+func TestNewCompressedSIHParamsForTags(t *testing.T) {
+	const numTags = 20
+	params := NewCompressedSIHParamsForTags(numTags)
+	fixed := CompressedSIHParams{HashOps: uint8(numHashOps)}
+	require.Less(t,
+		params.FalsePositiveRate(numTags), fixed.FalsePositiveRate(numTags))
+	require.Equal(t, uint8(1), NewCompressedSIHParamsForTags(1000).HashOps)
+	require.Equal(t, uint8(MaxCompressedSIHHashOps),
+		NewCompressedSIHParamsForTags(-1).HashOps)
+
+	tags := make([]string, numTags)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("Tag: %d", i)
+	}
+	const trials = 200
+	falsePositives := 0
+	for i := 0; i < trials; i++ {
+		msgHash := []byte(fmt.Sprintf("message hash %d ------------", i))
+		sih, _, err := MakeCompressedSIHWithParams(&id.DummyUser, msgHash,
+			[]byte("identifier"), tags, []byte{0, 0}, params)
+		require.NoError(t, err)
+
+		absent := make([]string, 50)
+		for j := range absent {
+			absent[j] = fmt.Sprintf("Absent: %d", j)
+		}
+		matchedTags, _, _, found, err := EvaluateCompressedSIHWithParams(
+			&id.DummyUser, msgHash, []byte("identifier"), absent, sih)
+		require.NoError(t, err)
+		require.True(t, found)
+		falsePositives += len(matchedTags)
+	}
+
+	measured := float64(falsePositives) / (trials * 50)
+	require.InDelta(t, params.FalsePositiveRate(numTags), measured, 0.05)
+}
+
+// Tests that parameters picked for a false positive rate stay under that rate
+// for the number of tags they fit.
+func TestNewCompressedSIHParamsForFalsePositive(t *testing.T) {
+	for _, target := range []float64{0.5, 0.1, 0.01, 0.001} {
+		params, err := NewCompressedSIHParamsForFalsePositive(target)
+		require.NoError(t, err)
+
+		// Optimal capacity is m * ln(2)^2 / -ln(p) entries, less the
+		// identifier
+		capacity := int(float64(paramsFilterSize)*math.Ln2*math.Ln2/
+			-math.Log(target)) - 1
+		require.LessOrEqual(t, params.FalsePositiveRate(capacity), target,
+			"target %f", target)
+	}
+
+	for _, invalid := range []float64{0, 1, -0.5, 2, math.NaN()} {
+		_, err := NewCompressedSIHParamsForFalsePositive(invalid)
+		require.Error(t, err, "rate %f", invalid)
+	}
+}
+
+// Error path: tests that MakeCompressedSIHWithParams rejects zero hash ops and
+// metadata of the wrong size.
+func TestMakeCompressedSIHWithParams_Errors(t *testing.T) {
+	msgHash := []byte("8675309 This IS a dummy message hash")
+	_, _, err := MakeCompressedSIHWithParams(&id.DummyUser, msgHash,
+		[]byte("identifier"), nil, []byte{1, 2}, CompressedSIHParams{})
+	require.Error(t, err)
+
+	_, _, err = MakeCompressedSIHWithParams(&id.DummyUser, msgHash,
+		[]byte("identifier"), nil, []byte{1},
+		NewCompressedSIHParamsForTags(5))
+	require.Error(t, err)
+}
@@ -86,12 +86,31 @@ func EvaluateCompressedSIH(pickup *id.ID, msgHash, identifier []byte,
 }
 
 func makeFilter(pickup *id.ID, msgHash []byte) (bloomfilter.Sealed, error) {
-	key := makeFilterKey(pickup)
+	return makeFilterFromKey(makeFilterKey(pickup), msgHash)
+}
+
+// makeFilterFromKey makes the filter using a key already derived with
+// makeFilterKey.
+func makeFilterFromKey(key, msgHash []byte) (bloomfilter.Sealed, error) {
 	nonce := makeFilterNonce(msgHash)
 	return bloomfilter.InitByParameters(key, nonce, filterSize,
 		numHashOps, metadataSize)
 }
 
+func makeParamsFilter(
+	pickup *id.ID, msgHash []byte, hashOps uint8) (bloomfilter.Sealed, error) {
+	return makeParamsFilterFromKey(makeFilterKey(pickup), msgHash, hashOps)
+}
+
+// makeParamsFilterFromKey makes the filter of a parameterized SIH, which seals
+// the parameters along with the metadata.
+func makeParamsFilterFromKey(
+	key, msgHash []byte, hashOps uint8) (bloomfilter.Sealed, error) {
+	nonce := makeFilterNonce(msgHash)
+	return bloomfilter.InitByParameters(key, nonce, paramsFilterSize,
+		uint64(hashOps), paramsSize+metadataSize)
+}
+
 func makeFilterKey(pickup *id.ID) []byte {
 	blake := hasher()
 	blake.Write(pickup.Bytes())